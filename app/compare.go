@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// How a file of the first tree of a comparison is found in the second.
+const (
+	CompareIdentical = "identical"
+	CompareRenamed   = "renamed"
+	CompareMissing   = "missing"
+	// CompareUnreadable is a file of the first tree that could not be hashed, so was never checked.
+	CompareUnreadable = "unreadable"
+)
+
+// compareResult is how a file of the first tree is found in the second, by path relative to its root.
+type compareResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// Matches are the files of the second tree with identical content under another path.
+	Matches []string `json:"matches,omitempty"`
+	// Error is why an unreadable file could not be hashed.
+	Error string `json:"error,omitempty"`
+}
+
+// compareTrees hashes the media files of both trees at once and classifies every file of treeA as
+// identical when treeB has the same content at the same relative path, renamed when it has the
+// content only elsewhere, missing, or unreadable when it could not be hashed. The results are
+// ordered by path.
+func compareTrees(treeA, treeB string, opts hash.Options) ([]compareResult, error) {
+	opts.PathStyle = hash.PathsRelative
+
+	var indexA, indexB hash.Index
+	var resultA, resultB hash.Result
+	var errA, errB error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		indexA, resultA, errA = hash.BuildIndex(treeA, opts)
+	}()
+	go func() {
+		defer wg.Done()
+		indexB, resultB, errB = hash.BuildIndex(treeB, opts)
+	}()
+	wg.Wait()
+
+	if errA != nil {
+		return nil, fmt.Errorf("failed to hash %s: %v", treeA, errA)
+	}
+	if errB != nil {
+		return nil, fmt.Errorf("failed to hash %s: %v", treeB, errB)
+	}
+
+	var results []compareResult
+	for _, hashStr := range indexA.Hashes() {
+		matches := indexB.Paths(hashStr)
+
+		for _, path := range indexA.Paths(hashStr) {
+			result := compareResult{Path: path, Status: CompareMissing}
+			if hashB, found := indexB.Hash(path); found && hashB == hashStr {
+				result.Status = CompareIdentical
+			} else if len(matches) > 0 {
+				result.Status, result.Matches = CompareRenamed, matches
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	results = append(results, unreadableFiles(resultA)...)
+
+	// A file of treeA whose copy in treeB could not be read is listed missing, which the warning explains.
+	if unreadableB := len(unreadableFiles(resultB)); unreadableB > 0 {
+		logger(LoggerTypeWarning, fmt.Sprintf("%d files of %s could not be read, files they hold are listed as missing.", unreadableB, treeB))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+
+	return results, nil
+}
+
+// unreadableFiles returns the files a scan left out of its index as unreadable, with the reason.
+func unreadableFiles(result hash.Result) []compareResult {
+	var unreadable []compareResult
+	add := func(path, reason string) {
+		unreadable = append(unreadable, compareResult{Path: path, Status: CompareUnreadable, Error: reason})
+	}
+
+	for _, path := range result.Unstable {
+		add(path, "file changed while hashing")
+	}
+	for _, path := range result.TimedOut {
+		add(path, "file read timed out")
+	}
+	for _, path := range result.Vanished {
+		add(path, "file deleted while scanning")
+	}
+	for _, panicErr := range result.Panicked {
+		add(panicErr.Path, panicErr.Error())
+	}
+	for _, fileErr := range result.Failed {
+		add(fileErr.Path, fileErr.Error())
+	}
+
+	return unreadable
+}
+
+// runCompare implements `mediarizer2 compare [-json] [-workers <n>] <dirA> <dirB>`.
+func runCompare(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Write how every file is found as a JSON array")
+	workers := flags.Int("workers", 0, "Number of files of each tree hashed at once, 0 uses four per CPU")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 || *workers < 0 {
+		logger(LoggerTypeFatal, "usage: mediarizer2 compare [-json] [-workers <n>] <dirA> <dirB>")
+	}
+
+	// The JSON on stdout stays parseable, so everything else is written to stderr.
+	if *asJSON {
+		setLogOutput(os.Stderr)
+	}
+
+	treeA, treeB := flags.Arg(0), flags.Arg(1)
+	for _, tree := range []string{treeA, treeB} {
+		if info, err := os.Stat(tree); err != nil {
+			logger(LoggerTypeFatal, fmt.Sprintf("failed to open directory %s: %v", tree, err))
+		} else if !info.IsDir() {
+			logger(LoggerTypeFatal, fmt.Sprintf("%s is not a directory", tree))
+		}
+	}
+
+	results, err := compareTrees(treeA, treeB, hash.Options{MaxConcurrency: *workers})
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if err := printCompareResult(os.Stdout, results, *asJSON); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	logger(LoggerTypeInfo, fmt.Sprintf("%d identical, %d renamed, %d missing from %s, %d unreadable.", counts[CompareIdentical], counts[CompareRenamed], counts[CompareMissing], treeB, counts[CompareUnreadable]))
+
+	// Missing and unreadable files fail the command, so scripts can tell a complete backup apart.
+	if counts[CompareMissing] > 0 || counts[CompareUnreadable] > 0 {
+		os.Exit(1)
+	}
+}
+
+// printCompareResult writes a line per file to w, with the status, the path and where renamed files are.
+func printCompareResult(w io.Writer, results []compareResult, asJSON bool) error {
+	if asJSON {
+		if results == nil {
+			results = []compareResult{}
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return fmt.Errorf("failed to write compare result: %v", err)
+		}
+		return nil
+	}
+
+	for _, result := range results {
+		fmt.Fprintf(w, "%-10s  %s", result.Status, result.Path)
+		for _, match := range result.Matches {
+			fmt.Fprintf(w, " -> %s", match)
+		}
+		if result.Error != "" {
+			fmt.Fprintf(w, " (%s)", result.Error)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// configFileNames are the config files looked for in the working directory when -config is not given.
+var configFileNames = []string{"mediarizer.yaml", "mediarizer.yml", "mediarizer.toml"}
+
+// configSkipped are the flags a config file can not set.
+var configSkipped = []string{"config", "help", "version"}
+
+// configAliases are the names a config file may give options by other than their flag name, such
+// as the plural of a flag given once per item.
+var configAliases = map[string]string{"sources": "source"}
+
+// configSections group the options of the config file template, the options of no section following
+// under "Other options".
+var configSections = []struct {
+	title string
+	flags []string
+}{
+	{"Input and output", []string{"input", "source", "output", "types", "photo", "video", "unknown", "copy"}},
+	{"Layout", []string{"layout", "format", "name", "flat", "camera", "location", "route", "camera-aliases", "date-sources", "time-offset", "assume-timezone", "camera-offsets"}},
+	{"Filters", []string{"exclude-glob", "include-glob", "min-size", "max-size", "after", "before", "follow-symlinks"}},
+	{"Duplicates", []string{"duplicate", "duplicate-folder", "dedupe", "keep", "equality", "hash-algo", "ignore", "ignore-skip", "permanent-delete"}},
+	{"Concurrency", []string{"workers", "max-open-files", "bytes-per-second", "polite", "read-timeout", "retries", "retry-backoff"}},
+	{"Notifications", []string{"notify-webhook", "notify-email", "notify-on", "notify-interval", "smtp-server", "smtp-user", "smtp-from"}},
+}
+
+// findConfigFile returns the config file of the working directory, or an empty path when it has none.
+func findConfigFile() string {
+	for _, name := range configFileNames {
+		if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// loadConfig reads the options of the config file at path, as TOML when it ends in .toml and as YAML
+// otherwise, keyed by flag name. Lists are joined by commas like the flags take them, and so are
+// tables as key=value pairs, such as the offsets of camera-offsets. Lists of tables and the list of
+// sources, of tables or plain paths, are joined by semicolons.
+func loadConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	var raw map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value := value.(type) {
+		case map[string]any:
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			items := make([]string, len(keys))
+			for i, key := range keys {
+				switch value[key].(type) {
+				case map[string]any, []any:
+					return nil, fmt.Errorf("invalid option %q in config file %s, options are not nested further than key = value", name, path)
+				}
+				items[i] = key + "=" + configString(value[key])
+			}
+			values[name] = strings.Join(items, ",")
+		case []any:
+			// A list of tables, such as sources, is written like the flag given once per table. The
+			// sources are always separated by semicolons, so a list of plain paths is one source per path.
+			isSources := name == "source" || configAliases[name] == "source"
+			separator := ","
+			if isSources {
+				separator = ";"
+			}
+			items := make([]string, len(value))
+			for i, item := range value {
+				table, isTable := item.(map[string]any)
+				if !isTable {
+					items[i] = configString(item)
+					if isSources {
+						items[i] = quoteSourceValue(items[i])
+					}
+					continue
+				}
+				separator = ";"
+
+				pairs, err := configTable(name, path, table)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = pairs
+			}
+			values[name] = strings.Join(items, separator)
+		default:
+			values[name] = configString(value)
+		}
+	}
+
+	return values, nil
+}
+
+// configTable formats a table of a list of tables as comma separated key=value pairs, a list value
+// repeating its key for every item. Values holding commas or semicolons are quoted like those of a source.
+func configTable(name, path string, table map[string]any) (string, error) {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		switch value := table[key].(type) {
+		case map[string]any:
+			return "", fmt.Errorf("invalid option %q in config file %s, options are not nested further than a list of tables", name, path)
+		case []any:
+			for _, item := range value {
+				pairs = append(pairs, key+"="+quoteSourceValue(configString(item)))
+			}
+		default:
+			pairs = append(pairs, key+"="+quoteSourceValue(configString(value)))
+		}
+	}
+
+	return strings.Join(pairs, ","), nil
+}
+
+// configString formats a value of a config file the way its flag is written.
+func configString(value any) string {
+	if date, ok := value.(time.Time); ok {
+		return date.Format(pipeline.FilterDateLayout)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// applyConfig sets the flags of flags to the values of the config file at path, except those given on
+// the command line, which override the file.
+func applyConfig(flags *flag.FlagSet, path string, values map[string]string) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for name, value := range values {
+		if alias, found := configAliases[name]; found {
+			name = alias
+		}
+		if flags.Lookup(name) == nil || slices.Contains(configSkipped, name) {
+			return fmt.Errorf("unknown option %q in config file %s", name, path)
+		}
+		if given[name] {
+			continue
+		}
+
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q of option %s in config file %s: %v", value, name, path, err)
+		}
+	}
+
+	return nil
+}
+
+// configTemplate writes every option of flags with its description and default, commented out, as YAML
+// or with asTOML as TOML.
+func configTemplate(flags *flag.FlagSet, asTOML bool) []byte {
+	var template bytes.Buffer
+	template.WriteString("# Mediarizer 2 options, named like their flags. Flags given on the command line override them.\n")
+
+	listed := make(map[string]bool)
+	writeSection := func(title string, names []string) {
+		fmt.Fprintf(&template, "\n# %s\n", title)
+		for _, name := range names {
+			f := flags.Lookup(name)
+			if f == nil || listed[name] || slices.Contains(configSkipped, name) {
+				continue
+			}
+			listed[name] = true
+
+			separator := ": "
+			if asTOML {
+				separator = " = "
+			}
+			fmt.Fprintf(&template, "\n# %s\n# %s%s%s\n", f.Usage, f.Name, separator, configDefault(f))
+		}
+	}
+
+	for _, section := range configSections {
+		writeSection(section.title, section.flags)
+	}
+
+	var others []string
+	flags.VisitAll(func(f *flag.Flag) {
+		others = append(others, f.Name)
+	})
+	writeSection("Other options", others)
+
+	return template.Bytes()
+}
+
+// configDefault formats the default of f, quoting all but numbers and booleans.
+func configDefault(f *flag.Flag) string {
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch getter.Get().(type) {
+		case bool, int, int64, uint, uint64, float64:
+			return f.DefValue
+		}
+	}
+
+	return strconv.Quote(f.DefValue)
+}
+
+// runConfig implements `mediarizer2 config init [<path>]`, writing a config file template to path,
+// mediarizer.yaml by default, as TOML when it ends in .toml.
+func runConfig(args []string) {
+	if len(args) == 0 || args[0] != "init" || len(args) > 2 {
+		logger(LoggerTypeFatal, "usage: mediarizer2 config init [<path>]")
+	}
+
+	path := configFileNames[0]
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		logger(LoggerTypeFatal, fmt.Sprintf("config file %s already exists", path))
+	}
+
+	template := configTemplate(flag.CommandLine, strings.EqualFold(filepath.Ext(path), ".toml"))
+	err := atomicfile.Write(path, func(w io.Writer) error {
+		_, err := w.Write(template)
+		return err
+	})
+	if err != nil {
+		logger(LoggerTypeFatal, fmt.Sprintf("failed to write config file %s: %v", path, err))
+	}
+
+	logger(LoggerTypeInfo, fmt.Sprintf("Config file written to %s.", path))
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/duplicate"
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/lockfile"
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// Actions the duplicates command takes on the copies that are not kept.
+const (
+	DuplicatesTrash  = "trash"
+	DuplicatesDelete = "delete"
+	DuplicatesReview = "review"
+)
+
+// duplicateDecision is the file picked to keep of a duplicate group in review.
+type duplicateDecision struct {
+	group duplicate.DuplicateGroup
+	keep  string
+}
+
+// remove returns the copies of the group that are not kept.
+func (decision duplicateDecision) remove() []string {
+	var remove []string
+	for _, path := range decision.group.Paths {
+		if path != decision.keep {
+			remove = append(remove, path)
+		}
+	}
+
+	return remove
+}
+
+// resolver returns a Resolver keeping the file picked.
+func (decision duplicateDecision) resolver() duplicate.Resolver {
+	return func(duplicate.DuplicateGroup) (string, []string, error) {
+		return decision.keep, decision.remove(), nil
+	}
+}
+
+// printDuplicateGroup writes a numbered line per file of the group to w, with its size and capture
+// date, marking suggested with a star.
+func printDuplicateGroup(w io.Writer, index, total int, group duplicate.DuplicateGroup, suggested string) {
+	fmt.Fprintf(w, "\nGroup %d/%d, %d copies of %.2fMb (%s):\n", index+1, total, len(group.Paths), float64(group.Size)/1024.0/1024.0, group.Hash[:min(12, len(group.Hash))])
+
+	for i, path := range group.Paths {
+		marker := " "
+		if path == suggested {
+			marker = "*"
+		}
+
+		date := "unknown date"
+		if captured, source, err := metadata.ResolveCaptureDate(path, metadata.DefaultDateSources); err == nil {
+			date = fmt.Sprintf("%s (%s)", captured.Format(time.DateTime), source)
+		}
+
+		fmt.Fprintf(w, "  %d) %s %s  %s\n", i+1, marker, path, date)
+	}
+}
+
+// reviewDuplicateGroups asks on answers which file of every group to keep, suggesting the one policy
+// keeps, and returns the groups a file was picked for. Skipped groups and those left when quitting
+// are left out, so nothing is done to them.
+func reviewDuplicateGroups(answers *bufio.Scanner, out io.Writer, groups []duplicate.DuplicateGroup, policy duplicate.KeepPolicy) []duplicateDecision {
+	var decisions []duplicateDecision
+	acceptAll := false
+
+	for i := 0; i < len(groups); i++ {
+		group := groups[i]
+
+		suggested, _, err := policy.Keep(group)
+		if err != nil {
+			fmt.Fprintf(out, "\nGroup %d/%d skipped: %v\n", i+1, len(groups), err)
+			continue
+		}
+
+		if acceptAll {
+			decisions = append(decisions, duplicateDecision{group: group, keep: suggested})
+			continue
+		}
+
+		printDuplicateGroup(out, i, len(groups), group, suggested)
+		fmt.Fprintf(out, "Keep [1-%d, enter keeps *, s skips, a keeps * of this and every later group, first/oldest/shortest/largest suggests by rule, q quits]: ", len(group.Paths))
+
+		if !answers.Scan() {
+			fmt.Fprintln(out)
+			return decisions
+		}
+
+		answer := strings.TrimSpace(answers.Text())
+		if number, err := strconv.Atoi(answer); err == nil && number >= 1 && number <= len(group.Paths) {
+			decisions = append(decisions, duplicateDecision{group: group, keep: group.Paths[number-1]})
+			continue
+		} else if rule, found := pipeline.ParseKeepPolicy(answer); found {
+			// The group is shown again with the suggestion of the new rule.
+			policy = rule
+			i--
+			continue
+		}
+
+		switch answer {
+		case "":
+			decisions = append(decisions, duplicateDecision{group: group, keep: suggested})
+		case "s":
+		case "a":
+			acceptAll = true
+			decisions = append(decisions, duplicateDecision{group: group, keep: suggested})
+		case "q":
+			return decisions
+		default:
+			fmt.Fprintf(out, "invalid choice %q\n", answer)
+			i--
+		}
+	}
+
+	return decisions
+}
+
+// unchangedGroup checks that every file of group still has the content it was grouped by. Files with
+// the size and modification time they were hashed with are served from hashCache, the others hashed again.
+func unchangedGroup(group duplicate.DuplicateGroup, hashCache hash.Map, algorithm hash.HashAlgorithm) error {
+	for _, path := range group.Paths {
+		hashValue, err := hash.GetFileHashWithAlgorithm(path, hashCache, algorithm)
+		if err != nil {
+			return fmt.Errorf("failed to get file hash for %s: %v", path, err)
+		}
+		if hex.EncodeToString(hashValue) != group.Hash {
+			return fmt.Errorf("%s changed since it was scanned", path)
+		}
+	}
+
+	return nil
+}
+
+// applyDuplicateDecisions trashes, deletes or moves into the review directory of root the copies that
+// are not kept, returning the number of copies removed, the groups skipped and those that failed.
+// Groups with a file that changed since it was hashed into hashCache are skipped, so no copy is removed
+// for a kept file it no longer matches.
+func applyDuplicateDecisions(decisions []duplicateDecision, action, root string, journal *pipeline.Journal, hashCache hash.Map, algorithm hash.HashAlgorithm) (int, int, []*duplicate.GroupError, error) {
+	var removed, skipped int
+	var failed []*duplicate.GroupError
+
+	for _, decision := range decisions {
+		if err := unchangedGroup(decision.group, hashCache, algorithm); err != nil {
+			logger(LoggerTypeWarning, fmt.Sprintf("skipped group of %s: %v", decision.keep, err))
+			skipped++
+			continue
+		}
+
+		groups := []duplicate.DuplicateGroup{decision.group}
+
+		switch action {
+		case DuplicatesReview:
+			reviewed, groupFailures, err := pipeline.MoveDuplicatesForReview(groups, decision.resolver(), filepath.Join(root, pipeline.ReviewDirectoryName), false, journal, nil)
+			removed += len(reviewed)
+			failed = append(failed, groupFailures...)
+			if err != nil {
+				return removed, skipped, failed, err
+			}
+		case DuplicatesDelete:
+			resolution := duplicate.DeleteDuplicates(groups, decision.resolver())
+			removed += len(resolution.Removed)
+			failed = append(failed, resolution.Failed...)
+		default:
+			resolution := duplicate.TrashDuplicates(groups, decision.resolver())
+			removed += len(resolution.Removed)
+			failed = append(failed, resolution.Failed...)
+		}
+	}
+
+	return removed, skipped, failed, nil
+}
+
+// saveDuplicateSnapshot saves hashCache to cachePath and groups to the snapshot next to it, returning
+// groups, or with newOnly only those new or with copies added since the snapshot saved by the last run.
+func saveDuplicateSnapshot(cachePath string, hashCache hash.Map, groups []duplicate.DuplicateGroup, newOnly bool) []duplicate.DuplicateGroup {
+	if err := hash.SaveCache(cachePath, hashCache); err != nil {
+		logger(LoggerTypeError, err.Error())
+	}
+
+	snapshotPath := duplicate.SnapshotPath(cachePath)
+	var previous []duplicate.DuplicateGroup
+	if newOnly {
+		var err error
+		if previous, err = duplicate.LoadSnapshot(snapshotPath); err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+	if err := duplicate.SaveSnapshot(snapshotPath, groups); err != nil {
+		logger(LoggerTypeError, err.Error())
+	}
+
+	if !newOnly {
+		return groups
+	}
+
+	added := duplicate.NewGroups(groups, previous)
+	logger(LoggerTypeInfo, fmt.Sprintf("%d of %d duplicate groups are new since the last run.", len(added), len(groups)))
+
+	return added
+}
+
+// runDuplicates implements `mediarizer2 duplicates [-interactive] [options] <dir>`, listing the groups
+// of identical media files under dir and, with -interactive, removing the copies confirmed for removal.
+func runDuplicates(args []string) {
+	const usage = "usage: mediarizer2 duplicates [-interactive] [-keep <rule>] [-action trash|delete|review] [-journal <path>] [-cache <path> [-new-only]] <dir>"
+
+	flags := flag.NewFlagSet("duplicates", flag.ExitOnError)
+	interactive := flags.Bool("interactive", false, "Pick the file to keep of every group and confirm before any copy is removed")
+	keepRule := flags.String("keep", "first", "Rule suggesting the file to keep of every group (first, oldest, shortest, largest)")
+	action := flags.String("action", DuplicatesTrash, "What is done to the copies not kept (trash, delete, review), review moving them into the duplicates folder of dir")
+	hashAlgorithmName := flags.String("hash-algo", "sha256", "Hash function files are compared by (sha256, sha512/256, xxhash64, blake3)")
+	journalPath := flags.String("journal", "", "Path to record the moves of -action review to, which `mediarizer2 undo` reverts")
+	waitForLock := flags.Bool("wait-lock", false, "Wait for other runs on dir to finish instead of failing")
+	cachePath := flags.String("cache", "", "Path to persistent hash cache file reused between runs, with the duplicate groups found kept next to it for -new-only")
+	newOnly := flags.Bool("new-only", false, "Only list and review the groups that are new, or gained copies, since the last run with the same -cache")
+	flags.Parse(args)
+
+	policy, found := pipeline.ParseKeepPolicy(*keepRule)
+	if !found {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid keep rule %q (first, oldest, shortest, largest)", *keepRule))
+	}
+	if *action != DuplicatesTrash && *action != DuplicatesDelete && *action != DuplicatesReview {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid action %q (%s, %s, %s)", *action, DuplicatesTrash, DuplicatesDelete, DuplicatesReview))
+	}
+	algorithm, err := hash.ParseHashAlgorithm(*hashAlgorithmName)
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+	if *journalPath != "" && *action != DuplicatesReview {
+		logger(LoggerTypeFatal, "journal requires -action review, trashed and deleted copies can not be undone")
+	}
+	if *newOnly && *cachePath == "" {
+		logger(LoggerTypeFatal, "new-only requires -cache, next to which the groups of the last run are kept")
+	}
+
+	root := openLibrary(flags, usage)
+
+	// Copies are removed by what the scan found, so no other run may change the directory from the
+	// scan on. Listing the groups changes nothing and needs no lock.
+	var lock *lockfile.Lock
+	if *interactive {
+		lock, err = lockfile.Acquire(root, *waitForLock)
+		if errors.Is(err, lockfile.ErrLocked) {
+			logger(LoggerTypeFatal, "another run is already organising the directory, use -wait-lock to wait for it")
+		} else if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		defer lock.Release()
+	}
+
+	hashCache := &sync.Map{}
+	if *cachePath != "" {
+		if err := hash.LoadCacheInto(*cachePath, hashCache); err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+
+	logger(LoggerTypeInfo, fmt.Sprintf("Finding duplicates in %s.", root))
+	groups, err := duplicate.FindDuplicates(libraryFiles(root), duplicate.Options{Algorithm: algorithm}, hashCache)
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if *cachePath != "" {
+		groups = saveDuplicateSnapshot(*cachePath, hashCache, groups, *newOnly)
+	}
+
+	var wasted int64
+	for _, group := range groups {
+		wasted += group.WastedBytes()
+	}
+	logger(LoggerTypeInfo, fmt.Sprintf("%d duplicate groups found, %.2fMb held by redundant copies.", len(groups), float64(wasted)/1024.0/1024.0))
+
+	if !*interactive {
+		for i, group := range groups {
+			suggested, _, err := policy.Keep(group)
+			if err != nil {
+				logger(LoggerTypeWarning, err.Error())
+			}
+			printDuplicateGroup(os.Stdout, i, len(groups), group, suggested)
+		}
+		return
+	}
+
+	if len(groups) == 0 {
+		return
+	}
+
+	answers := bufio.NewScanner(os.Stdin)
+	decisions := reviewDuplicateGroups(answers, os.Stdout, groups, policy)
+
+	var copies int
+	for _, decision := range decisions {
+		copies += len(decision.remove())
+	}
+	if copies == 0 {
+		logger(LoggerTypeInfo, "No copies confirmed for removal, nothing changed.")
+		return
+	}
+
+	verb := map[string]string{DuplicatesTrash: "trashed", DuplicatesDelete: "deleted for good", DuplicatesReview: "moved to " + filepath.Join(root, pipeline.ReviewDirectoryName)}[*action]
+	fmt.Fprintf(os.Stdout, "\n%d copies of %d groups will be %s. Proceed? [y/N]: ", copies, len(decisions), verb)
+	if !answers.Scan() || !strings.EqualFold(strings.TrimSpace(answers.Text()), "y") {
+		logger(LoggerTypeInfo, "Cancelled, nothing changed.")
+		return
+	}
+
+	var journal *pipeline.Journal
+	if *journalPath != "" {
+		if journal, err = pipeline.OpenJournal(*journalPath, &sync.Map{}); err != nil {
+			lock.Release()
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+
+	removed, skipped, failed, err := applyDuplicateDecisions(decisions, *action, root, journal, hashCache, algorithm)
+	if err != nil {
+		logger(LoggerTypeError, err.Error())
+	}
+	for _, groupErr := range failed {
+		logger(LoggerTypeWarning, groupErr.Error())
+	}
+	logger(LoggerTypeInfo, fmt.Sprintf("%d copies %s, %d groups skipped as changed, %d groups failed.", removed, verb, skipped, len(failed)))
+
+	if journal != nil {
+		if err := journal.Close(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+	if err := lock.Release(); err != nil {
+		logger(LoggerTypeError, err.Error())
+	}
+
+	if err != nil || len(failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/geo"
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/library"
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// syncLibraryIndex brings index in line with the files under destinationPath, reading the metadata of
+// the files that are new or changed since they were indexed and forgetting those no longer there.
+// Hidden files, such as the lock and partial copies, and the index itself are left out. It returns the
+// number of files indexed and removed.
+func syncLibraryIndex(index *library.Index, indexPath, destinationPath string, dateSources []metadata.DateSource, correction pipeline.DateCorrection, hashCache hash.Map) (int, int, error) {
+	absIndexPath, _ := filepath.Abs(indexPath)
+	seen := make(map[string]bool)
+	indexed := 0
+
+	err := filepath.WalkDir(destinationPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logger(LoggerTypeWarning, fmt.Sprintf("failed to index %s: %v", path, err))
+			return nil
+		}
+		if path != destinationPath && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if absPath, err := filepath.Abs(path); err == nil && strings.HasPrefix(absPath, absIndexPath) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			logger(LoggerTypeWarning, fmt.Sprintf("failed to index %s: %v", path, err))
+			return nil
+		}
+		seen[path] = true
+
+		existing, found, err := index.Lookup(path)
+		if err != nil {
+			return err
+		} else if found && existing.Size == info.Size() && existing.Modified.Equal(info.ModTime()) {
+			return nil
+		}
+
+		file, err := describeLibraryFile(path, info, dateSources, correction, hashCache)
+		if err != nil {
+			logger(LoggerTypeWarning, fmt.Sprintf("failed to index %s: %v", path, err))
+			return nil
+		}
+
+		if err := index.Put(file); err != nil {
+			return err
+		}
+		indexed++
+
+		return nil
+	})
+	if err != nil {
+		return indexed, 0, err
+	}
+
+	paths, err := index.Paths()
+	if err != nil {
+		return indexed, 0, err
+	}
+
+	removed := 0
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+
+		if err := index.Remove(path); err != nil {
+			return indexed, removed, err
+		}
+		removed++
+	}
+
+	return indexed, removed, nil
+}
+
+// describeLibraryFile reads what the index records of the file at path.
+func describeLibraryFile(path string, info fs.FileInfo, dateSources []metadata.DateSource, correction pipeline.DateCorrection, hashCache hash.Map) (library.File, error) {
+	hashValue, err := hash.GetFileHash(path, hashCache)
+	if err != nil {
+		return library.File{}, fmt.Errorf("failed to get file hash for %s: %v", path, err)
+	}
+
+	file := library.File{
+		Path:     path,
+		Hash:     hex.EncodeToString(hashValue),
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+		Type:     "other",
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if pipeline.IsPhoto(ext) {
+		file.Type = "image"
+	} else if pipeline.IsVideo(ext) {
+		file.Type = "video"
+	}
+
+	captured, dateSource, err := pipeline.GetCreatedTime(path, dateSources, correction)
+	if err != nil {
+		captured, dateSource = info.ModTime(), metadata.DateModTime
+	}
+	file.Captured, file.DateSource = captured, dateSource.String()
+
+	if file.Type == "other" {
+		return file, nil
+	}
+
+	file.Make, file.Model, _ = metadata.ExtractCamera(path)
+	file.City, _ = metadata.ExtractCity(path)
+
+	if latitude, longitude, err := metadata.ExtractLocation(path); err == nil {
+		file.HasLocation, file.Latitude, file.Longitude = true, latitude, longitude
+		if file.Country, _, err = geo.Country(latitude, longitude); err != nil {
+			return library.File{}, err
+		}
+	}
+
+	return file, nil
+}
+
+// runQuery implements `mediarizer2 query -index <index> [filters]`.
+func runQuery(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	indexPath := flags.String("index", "", "Path to the library index to query")
+	year := flags.Int("year", 0, "Only list files captured in this year")
+	camera := flags.String("camera", "", "Only list files whose camera make or model contains this, e.g. X-T3")
+	country := flags.String("country", "", "Only list files taken in this country")
+	city := flags.String("city", "", "Only list files taken in this city")
+	fileType := flags.String("type", "", "Only list files of this type (image, video, other)")
+	duplicates := flags.Bool("duplicates", false, "Only list files whose hash exists more than once, grouped by hash")
+	asJSON := flags.Bool("json", false, "Write the matching files with all they are indexed by as a JSON array")
+	flags.Parse(args)
+
+	if *indexPath == "" || flags.NArg() > 0 {
+		logger(LoggerTypeFatal, "usage: mediarizer2 query -index <index> [-year <year>] [-camera <camera>] [-country <country>] [-city <city>] [-type <type>] [-duplicates] [-json]")
+	}
+
+	if _, err := os.Stat(*indexPath); err != nil {
+		logger(LoggerTypeFatal, fmt.Sprintf("failed to open index %s: %v", *indexPath, err))
+	}
+
+	index, err := library.Open(*indexPath)
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+	defer index.Close()
+
+	files, err := index.Find(library.Query{Year: *year, Camera: *camera, Country: *country, City: *city, Type: *fileType, Duplicates: *duplicates})
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if err := printQueryResult(os.Stdout, files, *duplicates, *asJSON); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+}
+
+// printQueryResult writes the path of every file to w, a blank line separating the groups of duplicates.
+func printQueryResult(w io.Writer, files []library.File, duplicates, asJSON bool) error {
+	if asJSON {
+		if files == nil {
+			files = []library.File{}
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(files); err != nil {
+			return fmt.Errorf("failed to write query result: %v", err)
+		}
+		return nil
+	}
+
+	for i, file := range files {
+		if duplicates && i > 0 && files[i-1].Hash != file.Hash {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, file.Path)
+	}
+
+	return nil
+}
@@ -1,20 +1,83 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/pipeline"
 )
 
 const (
-	LoggerTypeInfo    = "info"
-	LoggerTypeVerbose = "verbose"
-	LoggerTypeWarning = "warning"
-	LoggerTypeError   = "error"
+	LoggerTypeInfo    = pipeline.LoggerTypeInfo
+	LoggerTypeVerbose = pipeline.LoggerTypeVerbose
+	LoggerTypeWarning = pipeline.LoggerTypeWarning
+	LoggerTypeError   = pipeline.LoggerTypeError
 	LoggerTypeFatal   = "fatal"
 )
 
+// logLevel is the least severe level logged to the console and the log file, -verbose also showing
+// verbose lines on the console.
+var logLevel = slog.LevelInfo
+
+// structuredLog, when -log-file is set, receives every log line and the result of every file as JSON.
+var structuredLog *slog.Logger
+
+// colorCodePattern matches the terminal colour codes of console lines, which the log file leaves out.
+var colorCodePattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// parseLogLevel returns the level named debug, info, warn or error.
+func parseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+
+	return 0, fmt.Errorf("invalid log level %q (debug, info, warn, error)", name)
+}
+
+// openLogFile appends JSON records of logLevel and above to the file at path, durations written
+// like 1.5s, and returns the file to close once the run is done.
+func openLogFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file %s: %v", path, err)
+	}
+
+	structuredLog = slog.New(slog.NewJSONHandler(file, &slog.HandlerOptions{
+		Level: logLevel,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Value.Kind() == slog.KindDuration {
+				return slog.String(attr.Key, attr.Value.Duration().String())
+			}
+			return attr
+		},
+	}))
+
+	return file, nil
+}
+
+// logStructured writes a record to the log file, when there is one.
+func logStructured(level slog.Level, message string, args ...any) {
+	if structuredLog == nil {
+		return
+	}
+
+	structuredLog.Log(context.Background(), level, strings.TrimSpace(colorCodePattern.ReplaceAllString(message, "")), args...)
+}
+
 func startLoggerHandlers(wg *sync.WaitGroup, infoQueue, warnQueue chan string, errorQueue chan error) {
 	wg.Add(3)
 
@@ -36,6 +99,14 @@ func startLoggerHandlers(wg *sync.WaitGroup, infoQueue, warnQueue chan string, e
 
 func errorHandler(errorQueue chan error) {
 	for err := range errorQueue {
+		// Errors of a file are logged with its path, so the log file can be searched by it.
+		var fileErr *hash.FileError
+		if errors.As(err, &fileErr) {
+			logStructured(slog.LevelError, err.Error(), "path", fileErr.Path)
+			printLog(LoggerTypeError, fmt.Sprintf("%v\n", err))
+			continue
+		}
+
 		logger(LoggerTypeError, fmt.Sprintf("%v\n", err))
 	}
 }
@@ -52,72 +123,36 @@ func infoHandler(infoQueue chan string) {
 	}
 }
 
-func logMoveAction(sourcePath, destinationDirectory string, isDuplicate bool, duplicateStrategy string) (string, error) {
-	colorCode := "\033[32m"
-	actionName := "Moved (original)"
-
-	fileName := filepath.Base(sourcePath)
-
-	if isDuplicate {
-		switch duplicateStrategy {
-		case "move":
-			colorCode = "\033[33m"
-			actionName = "Moved (duplicate)"
-		case "skip":
-			colorCode = "\033[34m"
-			actionName = "Skipped (duplicate)"
-			return fmt.Sprintf("\033[1m%s%s\033[0m %s\n", colorCode, actionName, fileName), nil
-		case "delete":
-			colorCode = "\033[31m"
-			actionName = "Deleted (duplicate)"
-			return fmt.Sprintf("\033[1m%s%s\033[0m %s\n", colorCode, actionName, fileName), nil
-		default:
-			colorCode = "\033[35m"
-			actionName = "Unknown Operation"
-		}
-	}
-
-	const maxPathLength = 90
-	var source, destination string
-
-	fileInfo, err := os.Stat(sourcePath)
-	if err != nil {
-		return "", err
-	}
-
-	fileSizeMB := float64(fileInfo.Size()) / 1024.0 / 1024.0
-	fileSizeStr := fmt.Sprintf("%.2fMb", fileSizeMB)
-
-	sourceDir := filepath.Dir(sourcePath)
-	if len(sourceDir) > maxPathLength {
-		source = "..." + sourceDir[len(sourceDir)-maxPathLength:]
-	} else {
-		source = sourceDir
-	}
-
-	if len(destinationDirectory) > maxPathLength {
-		destination = "..." + destinationDirectory[len(destinationDirectory)-maxPathLength:]
-	} else {
-		destination = destinationDirectory
+func logger(loggerType string, message string) {
+	switch loggerType {
+	case LoggerTypeVerbose:
+		logStructured(slog.LevelDebug, message)
+	case LoggerTypeInfo:
+		logStructured(slog.LevelInfo, message)
+	case LoggerTypeWarning:
+		logStructured(slog.LevelWarn, message)
+	default:
+		logStructured(slog.LevelError, message)
 	}
 
-	log := fmt.Sprintf(
-		"\033[1m[%s] %s%s\033[0m %s\n └─ from %s%s\033[0m\n └─── to %s%s\033[0m\n",
-		fileSizeStr, colorCode, actionName, fileName, colorCode, source, colorCode, destination,
-	)
-	return log, nil
+	printLog(loggerType, message)
 }
 
-func logger(loggerType string, message string) {
+// printLog writes message to the console, unless it is less severe than logLevel.
+func printLog(loggerType string, message string) {
 	switch loggerType {
 	case LoggerTypeInfo:
-		InfoLogger.Println(message)
+		if logLevel <= slog.LevelInfo {
+			InfoLogger.Println(message)
+		}
 	case LoggerTypeVerbose:
-		if *verbose {
+		if *verbose || logLevel <= slog.LevelDebug {
 			VerboseLogger.Println(message)
 		}
 	case LoggerTypeWarning:
-		WarningLogger.Println(message)
+		if logLevel <= slog.LevelWarn {
+			WarningLogger.Println(message)
+		}
 	case LoggerTypeError:
 		ErrorLogger.Println(message)
 	case LoggerTypeFatal:
@@ -1,24 +1,117 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/keybraker/mediarizer-2/atomicfile"
+	"github.com/keybraker/mediarizer-2/duplicate"
 	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/library"
+	"github.com/keybraker/mediarizer-2/lockfile"
+	"github.com/keybraker/mediarizer-2/mediatype"
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+	"github.com/keybraker/mediarizer-2/pipeline"
+	"github.com/keybraker/mediarizer-2/progress"
+	"github.com/keybraker/mediarizer-2/report"
 )
 
 var (
 	inputPath         *string
+	sources           sourceList
 	outputPath        *string
 	duplicateStrategy *string
+	duplicateFolder   *string
+	ignoreHashesPath  *string
+	cameraAliasesPath *string
+	skipIgnored       *bool
+	cachePath         *string
+	renameOnly        *bool
+	copyFiles         *bool
+	copyThenDelete    *bool
+	onCollision       *string
+	excludeGlobs      *string
+	followSymlinks    *bool
+	includeGlobs      *string
+	minSize           *string
+	maxSize           *string
+	modifiedAfter     *string
+	modifiedBefore    *string
+	jsonlPath         *string
+	estimateOnly      *bool
+	readTimeout       *time.Duration
+	nameTemplate      *string
+	organiseFlat      *bool
+	cameraMode        *string
+	rawPairs          *bool
+	rawPrimary        *string
+	sidecarFiles      *bool
+	livePhotos        *bool
+	discardLiveVideos *bool
+	burstFrames       *bool
+	waitForLock       *bool
+	checkExtensions   *bool
+	fixExtensions     *bool
+	politeReads       *bool
+	workers           *int
+	maxOpenFiles      *int
+	spillAfter        *int
+	spillDir          *string
+	bytesPerSecond    *int64
+	retries           *int
+	retryBackoff      *time.Duration
+	quarantinePath    *string
+	verifyMedia       *bool
+	quarantineCorrupt *bool
+	permanentDelete   *bool
+	dedupeSource      *bool
+	keepCopy          *string
+	reviewDuplicates  *bool
+	equalityName      *string
+	fuzzyDuplicates   *bool
+	fuzzyDistance     *int
+	fastHash          *bool
+	hashAlgorithmName *string
+	dryRun            *bool
+	planPath          *string
+	dateSourceList    *string
+	timeOffset        *time.Duration
+	assumeTimezone    *string
+	cameraOffsetList  *string
+	folderLayout      *string
+	routeRules        *string
+	journalPath       *string
+	organiseFiles     *bool
+	summaryPath       *string
+	checkpointPath    *string
+	resumePath        *string
+	indexPath         *string
+	failFast          *bool
+	watch             *bool
+	watchDebounce     *time.Duration
+	reportPath        *string
+	notifyWebhooks    *string
+	notifyEmails      *string
+	notifyOn          *string
+	notifyInterval    *time.Duration
+	smtpServer        *string
+	smtpUser          *string
+	smtpFrom          *string
 	moveUnknown       *bool
 	geoLocation       *bool
 	fileTypesString   *string
@@ -27,7 +120,11 @@ var (
 	format            *string
 	showHelp          *bool
 	verbose           *bool
+	quiet             *bool
+	logLevelName      *string
+	logFilePath       *string
 	showVersion       *bool
+	configPath        *string
 
 	InfoLogger    *log.Logger
 	VerboseLogger *log.Logger
@@ -40,16 +137,107 @@ func main() {
 	l1 := "  /  |/  /__ ___/ (_)__ _____(_)__ ___ ____   |_  |"
 	l2 := " / /|_/ / -_) _  / / _ `/ __/ /_ // -_) __/  / __/ "
 	l3 := "/_/  /_/\\__/\\_,_/_/\\_,_/_/ /_//__/\\__/_/    /____/ (v1.0.1)"
-	fmt.Println("\n" + l0 + "\n" + l1 + "\n" + l2 + "\n" + l3 + "\n\n\t\t\t\tby Keybraker\n")
 
 	start := time.Now()
 
+	if len(os.Args) > 1 && os.Args[1] == "undo" {
+		runUndo(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		runQuery(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		runCompare(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reorganize" {
+		runReorganize(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "duplicates" {
+		runDuplicates(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfig(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
+
+	// Options of the config file apply unless given on the command line.
+	if *configPath == "" {
+		*configPath = findConfigFile()
+	}
+	if *configPath != "" {
+		values, err := loadConfig(*configPath)
+		if err == nil {
+			err = applyConfig(flag.CommandLine, *configPath, values)
+		}
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+
+	// A summary on stdout keeps stdout parseable, so everything else is written to stderr.
+	if *summaryPath == "-" || *planPath == "-" {
+		setLogOutput(os.Stderr)
+	}
+
+	// Quiet runs only report warnings and errors.
+	if *quiet {
+		InfoLogger.SetOutput(io.Discard)
+	} else {
+		fmt.Fprintln(logOutput, "\n"+l0+"\n"+l1+"\n"+l2+"\n"+l3+"\n\n\t\t\t\tby Keybraker\n")
+	}
 	fileTypes := flagProcessor()
 
-	sourcePath, destinationPath := validatePaths(*inputPath, *outputPath)
+	// Every input is a source, -input being one that only takes the options of the flags.
+	var sourceRules []sourceRule
+	if *inputPath != "" {
+		sourceRules = append(sourceRules, sourceRule{Path: *inputPath})
+	}
+	sourceRules = append(sourceRules, sources...)
+
+	var destinationPath string
+	sourcePaths := make([]string, len(sourceRules))
+	for i := range sourceRules {
+		sourceRules[i].Path, destinationPath = validatePaths(sourceRules[i].Path, *outputPath)
+		sourcePaths[i] = sourceRules[i].Path
+	}
+	for i, path := range sourcePaths {
+		for _, other := range sourcePaths[i+1:] {
+			if pathsafe.Within(path, other) || pathsafe.Within(other, path) {
+				logger(LoggerTypeFatal, fmt.Sprintf("sources %s and %s overlap, their files would be ingested twice", path, other))
+			}
+		}
+	}
+	sourcePath := sourceRules[0].Path
+	summaryInput := strings.Join(sourcePaths, ", ")
+
+	logLevel, _ = parseLogLevel(*logLevelName)
+	if *logFilePath != "" {
+		logFile, err := openLogFile(*logFilePath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		defer logFile.Close()
+
+		logStructured(slog.LevelInfo, "run started", "input", summaryInput, "output", destinationPath)
+	}
 
-	fileQueue := make(chan FileInfo, 100)
 	infoQueue := make(chan string, 50)
 	warnQueue := make(chan string, 10)
 	errorQueue := make(chan error, 50)
@@ -58,168 +246,674 @@ func main() {
 
 	startLoggerHandlers(&wg, infoQueue, warnQueue, errorQueue)
 
+	if *checkExtensions || *fixExtensions {
+		reportExtensionMismatches(sourcePath, *fixExtensions)
+		return
+	}
+
+	if *quarantinePath != "" {
+		logger(LoggerTypeInfo, "Moving corrupt files to the quarantine path.")
+		quarantined, err := pipeline.QuarantineCorruptFiles(sourcePath, *quarantinePath)
+		for _, quarantinedPath := range quarantined {
+			logger(LoggerTypeWarning, fmt.Sprintf("corrupt file quarantined: %v", quarantinedPath))
+		}
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		logger(LoggerTypeInfo, fmt.Sprintf("%d corrupt files quarantined.", len(quarantined)))
+	}
+
+	// An output directory nested inside the input holds already organised files, which are not scanned again.
+	var excludePath string
+	if sourcePath != destinationPath && pathsafe.Within(sourcePath, destinationPath) {
+		excludePath = destinationPath
+	}
+
+	walkFilter, _ := pipeline.ParseWalkFilter(*excludeGlobs, *includeGlobs, *minSize, *maxSize, *modifiedAfter, *modifiedBefore)
+	routes, _ := pipeline.ParseRoutes(*routeRules)
+
+	transfer := flagTransfer()
+
 	logger(LoggerTypeInfo, "Counting files in path.")
-	totalFilesToMove := countFiles(sourcePath, fileTypes, *organisePhotos, *organiseVideos)
+	totalFilesToMove := 0
+	for _, rule := range sourceRules {
+		ruleOptions := sourcePipelineOptions(pipeline.Options{DestinationPath: destinationPath}, rule, transfer)
+		totalFilesToMove += pipeline.CountFiles(rule.Path, ruleOptions.ExcludePath, ruleOptions.Filter, *followSymlinks, fileTypes, *organisePhotos, *organiseVideos)
+	}
 
-	if totalFilesToMove == 0 {
+	if totalFilesToMove == 0 && !*watch {
 		logger(LoggerTypeInfo, "No files in path, exiting.")
 		return
 	} else {
 		logger(LoggerTypeInfo, fmt.Sprintf("%d files to be processed.", totalFilesToMove))
 	}
 
-	hashCache := &sync.Map{}
+	var ignoreHashes map[string]bool
+	if *ignoreHashesPath != "" {
+		var err error
+		ignoreHashes, err = duplicate.LoadIgnoreHashes(*ignoreHashesPath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		logger(LoggerTypeInfo, fmt.Sprintf("%d hashes will be ignored.", len(ignoreHashes)))
+	}
 
-	logger(LoggerTypeInfo, "Creating file hash-map on the destination path.")
-	totalFilesInDestination := countFiles(destinationPath, fileTypes, *organisePhotos, *organiseVideos)
+	if *cameraAliasesPath != "" {
+		var err error
+		pipeline.CameraAliases, err = pipeline.LoadCameraAliases(*cameraAliasesPath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
 
-	var hashedFiles int64
-	stopHashSpinner := make(chan bool)
-	go spinner(stopHashSpinner, "Hashing:", &hashedFiles, totalFilesInDestination)
+	if *estimateOnly {
+		estimateHashing(destinationPath)
+		return
+	}
 
-	fileHashMap, err := hash.HashImagesInPath(destinationPath, hashCache, &hashedFiles)
-	if err != nil {
-		stopHashSpinner <- true
-		logger(LoggerTypeInfo, "Failed to create file hash map.")
-		logger(LoggerTypeFatal, err.Error())
+	// A dry run changes nothing, so it neither needs nor takes the lock of the destination path.
+	var destinationLock *lockfile.Lock
+	if !*dryRun {
+		if *waitForLock {
+			logger(LoggerTypeInfo, "Waiting for other runs on the destination path to finish.")
+		}
+
+		var err error
+		destinationLock, err = lockfile.Acquire(destinationPath, *waitForLock)
+		if errors.Is(err, lockfile.ErrLocked) {
+			logger(LoggerTypeFatal, "another run is already organising the destination path, use -wait-lock to wait for it")
+		} else if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		defer destinationLock.Release()
 	}
 
-	stopHashSpinner <- true
-	elapsed := time.Since(start)
-	logger(LoggerTypeInfo, fmt.Sprintf("File hash-map created in %.2f seconds.", elapsed.Seconds()))
-
-	var processedFiles int64
-
-	stopSpinner := make(chan bool)
-	go spinner(stopSpinner, "Processing:", &processedFiles, totalFilesToMove)
-
-	done := make(chan struct{})
-
-	go creator(
-		sourcePath,
-		fileQueue,
-		warnQueue,
-		errorQueue,
-		*geoLocation,
-		*moveUnknown,
-		fileTypes,
-		*organisePhotos,
-		*organiseVideos,
-		*duplicateStrategy,
-		fileHashMap,
-		hashCache,
-	)
-
-	go consumer(
-		destinationPath,
-		fileQueue,
-		errorQueue,
-		*geoLocation,
-		*format,
-		*verbose,
-		*duplicateStrategy,
-		&processedFiles,
-		done,
-	)
-
-	<-done
-	stopSpinner <- true
-
-	elapsed = time.Since(start)
-	elapsedString := formatElapsedTime(elapsed)
-
-	logger(LoggerTypeInfo, strconv.Itoa(totalFilesToMove)+" files processed.")
-	logger(LoggerTypeInfo, fmt.Sprintf("Processing completed in %s.", elapsedString))
-}
+	var plan *pipeline.Plan
+	if *dryRun {
+		plan = pipeline.NewPlan()
+	}
 
-func formatElapsedTime(elapsed time.Duration) string {
-	seconds := int(elapsed.Seconds())
-	minutes := seconds / 60
-	seconds = seconds % 60
+	// Resuming keeps checkpointing to the same file, unless another one is given.
+	var checkpoint *pipeline.Checkpoint
+	if *resumePath != "" {
+		var err error
+		checkpoint, err = pipeline.LoadCheckpoint(*resumePath, sourcePath, destinationPath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		if *checkpointPath != "" {
+			checkpoint.Path = *checkpointPath
+		}
+		logger(LoggerTypeInfo, fmt.Sprintf("Resuming from %s, %d completed files will be skipped.", *resumePath, checkpoint.Completed()))
+	} else if *checkpointPath != "" {
+		checkpoint = pipeline.NewCheckpoint(*checkpointPath, sourcePath, destinationPath)
+	}
 
-	if minutes > 0 {
-		if minutes == 1 {
-			return fmt.Sprintf("%d minute and %d seconds", minutes, seconds)
+	var libraryIndex *library.Index
+	if *indexPath != "" {
+		var err error
+		libraryIndex, err = library.Open(*indexPath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
 		}
-		return fmt.Sprintf("%d minutes and %d seconds", minutes, seconds)
+		defer libraryIndex.Close()
 	}
 
-	return fmt.Sprintf("%.2f seconds", elapsed.Seconds())
-}
+	var hashCache hash.Map = &sync.Map{}
+	if *cachePath != "" {
+		// A bounded cache is decoded into the spill map entry by entry rather than into memory.
+		if *spillAfter > 0 {
+			cacheSpill, err := hash.NewSpillMap(*spillDir, *spillAfter)
+			if err != nil {
+				logger(LoggerTypeFatal, err.Error())
+			}
+			defer cacheSpill.Close()
+			hashCache = cacheSpill
+		}
+
+		if err := hash.LoadCacheInto(*cachePath, hashCache); err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+
+		issues, err := hash.ValidateCache(hashCache, true)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		for _, issue := range issues {
+			logger(LoggerTypeVerbose, fmt.Sprintf("pruned cache entry %v", issue))
+		}
+		if len(issues) > 0 {
+			logger(LoggerTypeInfo, fmt.Sprintf("%d invalid hash cache entries pruned.", len(issues)))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The first interrupt lets the run wind down, a second one ends the program at once.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	finished := make(chan struct{})
+	go checkpoint.SaveEvery(pipeline.CheckpointInterval, finished)
+
+	hashAlgorithm, _ := hash.ParseHashAlgorithm(*hashAlgorithmName)
+	hashOptions := hash.Options{ReadTimeout: *readTimeout, Algorithm: hashAlgorithm}
+	if *politeReads {
+		hashOptions.Preset = hash.Polite
+	}
+
+	var jsonlFile *atomicfile.File
+	if *jsonlPath != "" {
+		var err error
+		jsonlFile, err = atomicfile.Create(*jsonlPath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		defer jsonlFile.Abort()
+
+		hashOptions.JSONL = hash.NewJSONLWriter(jsonlFile)
+	}
+
+	var journal *pipeline.Journal
+	if *journalPath != "" {
+		var err error
+		journal, err = pipeline.OpenJournal(*journalPath, hashCache)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		defer journal.Close()
+	}
+
+	keepPolicy, _ := pipeline.ParseKeepPolicy(*keepCopy)
+	var duplicateFolderPath string
+	if *duplicateFolder != "" {
+		duplicateFolderPath = filepath.Clean(*duplicateFolder)
+	}
+	dateSources, _ := metadata.ParseDateSources(*dateSourceList)
+	dateCorrection, _ := pipeline.ParseDateCorrection(*timeOffset, *assumeTimezone, *cameraOffsetList)
+	equality, _ := pipeline.ParseEquality(*equalityName)
+
+	var runReport *report.Report
+	if *reportPath != "" {
+		runReport = report.New()
+	}
+
+	pipelineOptions := pipeline.Options{
+		SourcePath:        sourcePath,
+		DestinationPath:   destinationPath,
+		ExcludePath:       excludePath,
+		Filter:            walkFilter,
+		FollowSymlinks:    *followSymlinks,
+		FileTypes:         fileTypes,
+		Photos:            *organisePhotos,
+		Videos:            *organiseVideos,
+		Dedupe:            *dedupeSource,
+		Keep:              keepPolicy,
+		ReviewDuplicates:  *reviewDuplicates,
+		Equality:          equality,
+		FuzzyDuplicates:   *fuzzyDuplicates,
+		FuzzyDistance:     *fuzzyDistance,
+		FastHash:          *fastHash,
+		Plan:              plan,
+		Journal:           journal,
+		Organise:          *organiseFiles,
+		HashOptions:       hashOptions,
+		IgnoreHashes:      ignoreHashes,
+		SkipIgnored:       *skipIgnored,
+		GeoLocation:       *geoLocation,
+		MoveUnknown:       *moveUnknown,
+		Format:            *format,
+		Verbose:           *verbose,
+		DuplicateStrategy: *duplicateStrategy,
+		DuplicateFolder:   duplicateFolderPath,
+		NameTemplate:      *nameTemplate,
+		RenameOnly:        *renameOnly,
+		Transfer:          transfer,
+		OnCollision:       *onCollision,
+		PermanentDelete:   *permanentDelete,
+		Flat:              *organiseFlat,
+		CameraMode:        *cameraMode,
+		Layout:            *folderLayout,
+		Routes:            routes,
+		RawPairs:          *rawPairs,
+		RawPrimary:        *rawPrimary,
+		Sidecars:          *sidecarFiles,
+		LivePhotos:        *livePhotos,
+		DiscardLiveVideos: *discardLiveVideos,
+		Bursts:            *burstFrames,
+		VerifyMedia:       *verifyMedia,
+		QuarantineCorrupt: *quarantineCorrupt,
+		DateSources:       dateSources,
+		DateCorrection:    dateCorrection,
+		Report:            runReport,
+		Checkpoint:        checkpoint,
+		FailFast:          *failFast,
+		Limits:            pipeline.IOLimits{Workers: *workers, MaxOpenFiles: *maxOpenFiles, BytesPerSecond: *bytesPerSecond, Retries: *retries, RetryBackoff: *retryBackoff},
+		SpillAfter:        *spillAfter,
+		SpillDir:          *spillDir,
+		HashCache:         hashCache,
+		WarnQueue:         warnQueue,
+		ErrorQueue:        errorQueue,
+	}
+
+	// updateIndex brings the library index in line with the output directory after every run.
+	updateIndex := func() {
+		if libraryIndex == nil {
+			return
+		}
 
-func spinner(stopSpinner chan bool, verb string, processedFiles *int64, totalFiles int) {
-	spinChars := `-\|/`
-	i := 0
-	for {
-		select {
-		case <-stopSpinner:
-			fmt.Printf("\r%s\r", strings.Repeat(" ", 80))
+		indexed, removed, err := syncLibraryIndex(libraryIndex, *indexPath, destinationPath, dateSources, dateCorrection, hashCache)
+		if err != nil {
+			logger(LoggerTypeError, err.Error())
 			return
-		default:
-			processed := atomic.LoadInt64(processedFiles)
-			percentage := float64(processed) / float64(totalFiles) * 100
-			fmt.Printf("\r%c | %s: %d/%d (%.2f%%)", spinChars[i], verb, processed, totalFiles, percentage)
-			i = (i + 1) % len(spinChars)
-			time.Sleep(100 * time.Millisecond)
 		}
+		logger(LoggerTypeInfo, fmt.Sprintf("Library index updated, %d files indexed and %d removed.", indexed, removed))
 	}
-}
 
-func displayHelp() {
-	flag.PrintDefaults()
-}
+	runNotifier := newNotifier(*notifyWebhooks, *notifyEmails, *smtpServer, *smtpUser, *smtpFrom, *notifyOn)
 
-func arrayContains(stringArray []string, stringCandidate string) bool {
-	for _, string := range stringArray {
-		if string == stringCandidate {
-			return true
+	// writeOutputs writes the plan, summary and report of the run, marked as interrupted when it was,
+	// which then list only the files it got to.
+	writeOutputs := func(result pipeline.Result, interrupted bool) {
+		if plan != nil {
+			if interrupted {
+				plan.Add(pipeline.PlannedOperation{Action: pipeline.PlanInterrupted, Source: summaryInput})
+			}
+			printPlan(logOutput, plan)
+			if *planPath != "" {
+				if err := writePlan(*planPath, plan); err != nil {
+					logger(LoggerTypeError, err.Error())
+				}
+			}
+		}
+
+		if *summaryPath != "" {
+			summary := newRunSummary(summaryInput, destinationPath, result, time.Since(start))
+			summary.Interrupted = interrupted
+			if err := writeSummary(*summaryPath, summary); err != nil {
+				logger(LoggerTypeError, err.Error())
+			}
+		}
+
+		if runReport != nil {
+			if interrupted {
+				runReport.Add(report.Entry{Source: summaryInput, Action: report.ActionInterrupted})
+			}
+			if err := runReport.WriteFile(*reportPath); err != nil {
+				logger(LoggerTypeError, err.Error())
+			}
 		}
 	}
 
-	return false
-}
+	pipelineResult, err := runSources(ctx, pipelineOptions, sourceRules, transfer)
+	if err != nil && ctx.Err() != nil {
+		writeOutputs(pipelineResult, true)
+		summary := newRunSummary(summaryInput, destinationPath, pipelineResult, time.Since(start))
+		summary.Interrupted = true
+		runNotifier.notify(summary, nil)
+		exitInterrupted(hashCache, destinationLock, checkpoint, journal, jsonlFile)
+	} else if err != nil {
+		// The files completed before the error are skipped when the run is resumed.
+		if err := checkpoint.Save(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+		runNotifier.notify(newRunSummary(summaryInput, destinationPath, pipelineResult, time.Since(start)), err)
+		logger(LoggerTypeFatal, err.Error())
+	}
+	updateIndex()
+
+	// Watch runs are notified of in digests, of the runs since the last one was sent.
+	digest, digestStart := pipelineResult, start
 
-func countFiles(rootPath string, fileTypes []string, organisePhotos bool, organiseVideos bool) int {
-	count := 0
+	if *watch {
+		logger(LoggerTypeInfo, fmt.Sprintf("Watching %s for new files, interrupt to stop.", sourcePath))
+		err := watchSource(ctx, sourcePath, excludePath, *watchDebounce, func() {
+			result, err := runPipeline(ctx, pipelineOptions)
+			if err != nil && ctx.Err() != nil {
+				// The files the interrupted run did not get to are left for the next one.
+				pipelineResult.Add(result)
+				digest.Add(result)
+				return
+			} else if err != nil {
+				logger(LoggerTypeError, err.Error())
+				return
+			}
+			logger(LoggerTypeInfo, fmt.Sprintf("%d new files processed.", result.Processed))
+			pipelineResult.Add(result)
+			updateIndex()
 
-	filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			digest.Add(result)
+			if *notifyInterval > 0 && time.Since(digestStart) >= *notifyInterval {
+				runNotifier.notify(newRunSummary(summaryInput, destinationPath, digest, time.Since(digestStart)), nil)
+				digest, digestStart = pipeline.Result{}, time.Now()
+			}
+		})
 		if err != nil {
-			return err
+			logger(LoggerTypeFatal, err.Error())
 		}
+	}
+
+	if hashOptions.JSONL != nil {
+		if err := hashOptions.JSONL.Close(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		} else if err := jsonlFile.Commit(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
 
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(path))
+	if *dedupeSource {
+		if *reviewDuplicates {
+			logger(LoggerTypeInfo, fmt.Sprintf("%d duplicate input files moved to %s for review.", len(pipelineResult.Reviewed), filepath.Join(destinationPath, pipeline.ReviewDirectoryName)))
+		} else {
+			logger(LoggerTypeInfo, fmt.Sprintf("%d duplicate input files removed.", len(pipelineResult.Removed)))
+		}
+	}
 
-			if (organisePhotos && isPhoto(ext) || organiseVideos && isVideo(ext)) &&
-				(len(fileTypes) == 0 || arrayContains(fileTypes, ext)) {
-				count++
+	// Every stage looks files up in the cache, not only the hashing of the destination path.
+	if *cachePath != "" {
+		cacheHits, cacheMisses := hash.CacheStats()
+		logger(LoggerTypeInfo, fmt.Sprintf("Hash cache served %d lookups, %d files hashed.", cacheHits, cacheMisses))
+	}
+
+	close(finished)
+
+	// A checkpoint is only worth keeping while there are failed files left to retry.
+	if len(pipelineResult.Failed) > 0 {
+		if err := checkpoint.Save(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	} else if err := checkpoint.Remove(); err != nil {
+		logger(LoggerTypeError, err.Error())
+	}
+
+	if *cachePath != "" {
+		if err := hash.SaveCache(*cachePath, hashCache); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	elapsedString := formatElapsedTime(time.Since(start))
+
+	if *organiseFiles {
+		logger(LoggerTypeInfo, strconv.Itoa(pipelineResult.Processed)+" files processed.")
+	}
+	if *renameOnly {
+		logger(LoggerTypeInfo, fmt.Sprintf("%d files renamed in place.", pipelineResult.Renamed))
+	}
+	if len(pipelineResult.Failed) > 0 {
+		transient := 0
+		for _, failed := range pipelineResult.Failed {
+			if failed.Kind == report.ErrorTransient {
+				transient++
 			}
 		}
+		logger(LoggerTypeWarning, fmt.Sprintf("%d files failed and were left in place, %d of them with transient errors a later run may get past.", len(pipelineResult.Failed), transient))
+	}
+	logger(LoggerTypeInfo, fmt.Sprintf("Processing completed in %s.", elapsedString))
+	peakHeapMB := float64(pipelineResult.PeakHeapBytes) / 1024.0 / 1024.0
+	if *spillAfter > 0 {
+		logger(LoggerTypeInfo, fmt.Sprintf("Peak heap usage %.2fMb, %d hash-map entries spilled to disk.", peakHeapMB, pipelineResult.SpilledHashes))
+	} else {
+		logger(LoggerTypeInfo, fmt.Sprintf("Peak heap usage %.2fMb.", peakHeapMB))
+	}
+	logStructured(slog.LevelInfo, "run finished", "processed", pipelineResult.Processed, "failed", len(pipelineResult.Failed), "duration", time.Since(start), "peakHeapBytes", pipelineResult.PeakHeapBytes)
 
+	writeOutputs(pipelineResult, false)
+
+	runNotifier.notify(newRunSummary(summaryInput, destinationPath, digest, time.Since(digestStart)), nil)
+}
+
+// runPipeline runs the pipeline of opts once until ctx is cancelled, rendering its progress unless the run is quiet.
+func runPipeline(ctx context.Context, opts pipeline.Options) (pipeline.Result, error) {
+	opts.Progress = progress.NewTracker()
+	if !*quiet {
+		bar := progress.NewBar(logOutput, "Processing:", opts.Progress)
+		bar.Start()
+		defer bar.Stop()
+	}
+
+	return pipeline.Run(ctx, opts)
+}
+
+// estimateHashing logs how long creating the hash-map of the destination path is expected to take.
+func estimateHashing(destinationPath string) {
+	fileCount, totalBytes, err := hash.EstimateScan(destinationPath, hash.Options{})
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	bytesPerSecond, err := hash.MeasureHashRate(destinationPath, hash.Options{}, 20)
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	totalMB := float64(totalBytes) / 1024.0 / 1024.0
+	estimate := hash.EstimateDuration(totalBytes, bytesPerSecond)
+
+	logger(LoggerTypeInfo, fmt.Sprintf("%d files (%.2fMb) to hash on the destination path, estimated %s.", fileCount, totalMB, formatElapsedTime(estimate)))
+}
+
+// reportExtensionMismatches logs the files in sourcePath whose content does not match their extension,
+// renaming them to the extension of their content when fix is set.
+func reportExtensionMismatches(sourcePath string, fix bool) {
+	var paths []string
+	err := filepath.WalkDir(sourcePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
 		return nil
 	})
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	mismatches, err := mediatype.FindMismatches(paths)
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	for _, mismatch := range mismatches {
+		logger(LoggerTypeWarning, fmt.Sprintf("%s is %s but named as %s", mismatch.Path, mismatch.Detected, mismatch.Claimed))
+		if !fix {
+			continue
+		}
+
+		correctedPath, err := mismatch.CorrectedPath()
+		if err != nil {
+			logger(LoggerTypeError, err.Error())
+			continue
+		}
+
+		correctedPath, err = pipeline.GenerateUniquePathName(correctedPath)
+		if err != nil {
+			logger(LoggerTypeError, err.Error())
+			continue
+		}
 
-	return count
+		if err := os.Rename(mismatch.Path, correctedPath); err != nil {
+			logger(LoggerTypeError, fmt.Sprintf("failed to rename %s to %s: %v", mismatch.Path, correctedPath, err))
+			continue
+		}
+		logger(LoggerTypeInfo, fmt.Sprintf("Renamed %s to %s.", mismatch.Path, correctedPath))
+	}
+
+	logger(LoggerTypeInfo, fmt.Sprintf("%d files with a mismatched extension.", len(mismatches)))
+}
+
+// exitInterrupted persists the partial hash cache and checkpoint of an interrupted run, flushes the
+// journal, discards the unfinished hash records, releases the lock, if any, and exits.
+func exitInterrupted(hashCache hash.Map, destinationLock *lockfile.Lock, checkpoint *pipeline.Checkpoint, journal *pipeline.Journal, jsonlFile *atomicfile.File) {
+	fmt.Fprintf(logOutput, "\r%s\r", strings.Repeat(" ", 80))
+	logger(LoggerTypeInfo, "Interrupted, flushing hash cache.")
+
+	if *cachePath != "" {
+		if err := hash.FlushCache(*cachePath, hashCache, 5*time.Second); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	// Exiting skips the deferred removal of the spilled cache entries.
+	if cacheSpill, ok := hashCache.(*hash.SpillMap); ok {
+		if err := cacheSpill.Close(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	if err := checkpoint.Save(); err != nil {
+		logger(LoggerTypeError, err.Error())
+	} else if checkpoint != nil {
+		logger(LoggerTypeInfo, fmt.Sprintf("Checkpoint written, resume with -resume %s.", checkpoint.Path))
+	}
+
+	if journal != nil {
+		if err := journal.Close(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	if jsonlFile != nil {
+		if err := jsonlFile.Abort(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	if destinationLock != nil {
+		if err := destinationLock.Release(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	os.Exit(130)
+}
+
+func formatElapsedTime(elapsed time.Duration) string {
+	seconds := int(elapsed.Seconds())
+	minutes := seconds / 60
+	seconds = seconds % 60
+
+	if minutes > 0 {
+		if minutes == 1 {
+			return fmt.Sprintf("%d minute and %d seconds", minutes, seconds)
+		}
+		return fmt.Sprintf("%d minutes and %d seconds", minutes, seconds)
+	}
+
+	return fmt.Sprintf("%.2f seconds", elapsed.Seconds())
+}
+
+func displayHelp() {
+	flag.PrintDefaults()
 }
 
 func init() {
+	configPath = flag.String("config", "", "Path to a YAML or TOML file of options, mediarizer.yaml, mediarizer.yml or mediarizer.toml in the working directory by default")
 	inputPath = flag.String("input", "", "Path to source file or directory")
+	flag.Var(&sources, "source", "Input directory with its own options, e.g. /media/sd,transfer=copy-then-delete, given once per input to ingest several in one run, a path holding commas double quoted (transfer, duplicate, exclude-glob, include-glob, min-size, max-size, after, before)")
 	outputPath = flag.String("output", "", "Path to destination directory")
-	duplicateStrategy = flag.String("duplicate", "move", "Duplication handling, default \"move\" (move, skip, delete)")
+	duplicateStrategy = flag.String("duplicate", "move", "Duplication handling, default \"move\" (move, skip, delete, hardlink)")
+	duplicateFolder = flag.String("duplicate-folder", "", "Directory duplicates are moved to, keeping their organised relative path, instead of a DUPLICATE folder next to each original")
+	ignoreHashesPath = flag.String("ignore", "", "Path to file with hashes (one per line) to exclude from duplicate detection")
+	cameraAliasesPath = flag.String("camera-aliases", "", "Path to file of \"raw make or model = alias\" lines renaming cameras in folders and file names")
+	skipIgnored = flag.Bool("ignore-skip", false, "Leave files with an ignored hash out of the output entirely")
+	cachePath = flag.String("cache", "", "Path to persistent hash cache file reused between runs, files whose size or modification time changed are hashed again")
+	renameOnly = flag.Bool("rename-only", false, "Only ever rename files in place, fail instead of copying across devices")
+	copyFiles = flag.Bool("copy", false, "Copy the input files into the output directory instead of moving them, verifying every copy by its SHA-256")
+	copyThenDelete = flag.Bool("copy-then-delete", false, "Copy the input files like -copy, deleting each only once its copy is verified")
+	onCollision = flag.String("on-collision", pipeline.CollisionRenameSuffix, "Handling of a destination path taken by another file (rename-suffix, rename-hash, skip, overwrite-if-identical)")
+	jsonlPath = flag.String("jsonl", "", "Path to write the destination file hashes to as JSON Lines")
+	estimateOnly = flag.Bool("estimate", false, "Estimate the time needed to hash the destination path and exit")
+	readTimeout = flag.Duration("read-timeout", 0, "Abandon hashing a file when its reads stall for this long, e.g. 30s (0 disables)")
 	moveUnknown = flag.Bool("unknown", true, "Move files with no metadata to undetermined folder")
-	geoLocation = flag.Bool("location", false, "Organize files based on their geo location")
-	fileTypesString = flag.String("types", "", "Comma separated file extensions to organize (.jpg, .png, .gif, .mp4, .avi, .mov, .mkv)")
+	geoLocation = flag.Bool("location", false, "Organize files into folders of the country their GPS coordinates lie in, looked up offline")
+	fileTypesString = flag.String("types", "", "Comma separated file extensions to organize (.jpg, .png, .gif, .heic, .heif, .webp, .avif, .cr2, .cr3, .nef, .arw, .dng, .orf, .raf, .rw2, .mp4, .avi, .mov, .mkv)")
+	excludeGlobs = flag.String("exclude-glob", "", "Comma separated glob patterns of input files and folders to leave out, matched against their name, or relative path with a slash, e.g. \"@eaDir,.thumbnails\"")
+	includeGlobs = flag.String("include-glob", "", "Comma separated glob patterns, matched like exclude-glob, of the only input files to organise")
+	minSize = flag.String("min-size", "", "Leave out input files smaller than this size, e.g. 50KB (B, KB, MB, GB)")
+	maxSize = flag.String("max-size", "", "Leave out input files larger than this size, e.g. 2GB (B, KB, MB, GB)")
+	modifiedAfter = flag.String("after", "", "Only organise input files modified on or after this date (YYYY-MM-DD)")
+	modifiedBefore = flag.String("before", "", "Only organise input files modified before this date (YYYY-MM-DD)")
+	followSymlinks = flag.Bool("follow-symlinks", false, "Walk into symlinked input folders, entering each folder once, and organise the targets of symlinked input files")
 	organisePhotos = flag.Bool("photo", true, "Organise only photos")
 	organiseVideos = flag.Bool("video", true, "Organise only videos")
 	format = flag.String("format", "word", "Naming format for month folders, default \"word\" (word, number, combined)")
+	nameTemplate = flag.String("name", "", "Template for renaming files with EXIF data, e.g. \"{date:20060102_150405}_{camera}{ext}\" (date, camera, make, model, name, ext)")
+	organiseFlat = flag.Bool("flat", false, "Collapse all files into the output directory named \"{date}_{hashprefix}{ext}\", duplicates handled by duplicate as in any other layout")
+	folderLayout = flag.String("layout", "", "Template of the output folders, such as \"{year}/{month}/{day}\" ({year}, {month}, {day}, {date:layout}, {type}, {camera-model}, {make}, {model}, {country}, {city})")
+	routeRules = flag.String("route", "", "Comma separated kind=layout rules sending screenshots, messaging app media, downloads, photos, animated images, screen recordings and videos to layouts of their own, the first matching rule applying, e.g. \"screenshot=Screenshots/{year},messaging=WhatsApp/{year}\" (screenshot, messaging, download, photo, animated, screen-recording, video)")
+	cameraMode = flag.String("camera", "off", "Organise files into camera model folders, default \"off\" (off, camera, date)")
+	rawPairs = flag.Bool("raw-pairs", false, "Keep RAW files together with the JPEG of the same name")
+	rawPrimary = flag.String("raw-primary", "jpeg", "File of a RAW+JPEG pair whose capture date places the pair, default \"jpeg\" (jpeg, raw)")
+	sidecarFiles = flag.Bool("sidecars", true, "Move XMP, AAE, THM and SRT sidecar files together with the media file of the same name")
+	livePhotos = flag.Bool("live-photos", false, "Keep the MOV of an iPhone Live Photo together with the HEIC or JPEG still of the same name")
+	discardLiveVideos = flag.Bool("discard-live-videos", false, "Remove the MOV of a Live Photo once its still is organised instead of moving it along, requires live-photos")
+	burstFrames = flag.Bool("bursts", false, "Place every photo of a burst by the capture date of its cover or first photo, so the burst stays together")
+	waitForLock = flag.Bool("wait-lock", false, "Wait for another run on the same output directory to finish instead of exiting")
+	checkExtensions = flag.Bool("check-ext", false, "Report input files whose content does not match their extension and exit")
+	fixExtensions = flag.Bool("fix-ext", false, "Rename input files whose content does not match their extension and exit")
+	politeReads = flag.Bool("polite", false, "Hash with few workers and a capped read rate, gentler on external and USB drives but slower")
+	workers = flag.Int("workers", 0, "Number of files hashed and moved at once, 0 uses half the CPUs (four per CPU for hashing the output)")
+	maxOpenFiles = flag.Int("max-open-files", 0, "Maximum number of files held open at once across all workers (0 disables)")
+	spillAfter = flag.Int("spill-after", 0, "Number of hash-map and hash cache entries held in memory, spilling the rest to disk, for libraries of millions of files (0 disables)")
+	spillDir = flag.String("spill-dir", "", "Directory the entries spill-after spills are written to, the temporary directory by default")
+	bytesPerSecond = flag.Int64("bytes-per-second", 0, "Maximum combined rate in bytes per second the output is hashed and input files are copied at (0 disables)")
+	retries = flag.Int("retries", 3, "Number of times reading, hashing or moving a file is retried after a transient error, such as a network share timing out")
+	retryBackoff = flag.Duration("retry-backoff", 500*time.Millisecond, "Wait before the first retry of a file, doubling before every next one")
+	quarantinePath = flag.String("quarantine", "", "Validate input photos before organising and move the ones that fail to decode to this directory, keeping their relative paths")
+	verifyMedia = flag.Bool("verify-media", false, "Decode input images and probe the containers of input videos while scanning, leaving the corrupt ones in place as failed")
+	quarantineCorrupt = flag.Bool("quarantine-corrupted", false, "Move the files verify-media finds corrupt while organising into the Corrupted folder of the output directory, keeping their relative paths, requires verify-media")
+	permanentDelete = flag.Bool("permanent-delete", false, "Delete duplicates and discarded files for good instead of moving them to the trash")
+	dedupeSource = flag.Bool("dedupe", false, "Delete all but one copy of identical input files before organising them")
+	keepCopy = flag.String("keep", "first", "Copy of identical input files kept by -dedupe, default \"first\" (first, oldest, shortest, largest)")
+	equalityName = flag.String("equality", "bytes", "Files -dedupe considers identical, default \"bytes\" (bytes, pixels)")
+	fuzzyDuplicates = flag.Bool("fuzzy-duplicates", false, "Also treat visually alike input images as duplicates in -dedupe, such as resized or re-encoded copies")
+	fuzzyDistance = flag.Int("fuzzy-distance", hash.DefaultPerceptualDistance, "Differing bits of the perceptual hashes up to which -fuzzy-duplicates considers images alike (0-64)")
+	fastHash = flag.Bool("fast-hash", false, "Fingerprint input files by size and their first and last megabyte in -dedupe, fully hashing only colliding files")
+	hashAlgorithmName = flag.String("hash-algo", "sha256", "Hash function files are compared by to find duplicates, copies are always verified with SHA-256 (sha256, sha512/256, xxhash64, blake3)")
+	dateSourceList = flag.String("date-sources", "exif,xmp,filename,mtime", "Comma separated sources capture dates are read from in order (exif, xmp, filename, mtime)")
+	timeOffset = flag.Duration("time-offset", 0, "Correction added to the capture dates read from files for a camera clock that was off, e.g. -3h or 1h30m")
+	assumeTimezone = flag.String("assume-timezone", "", "Timezone, e.g. Europe/Athens, capture dates without one were taken in and all other dates are converted to")
+	cameraOffsetList = flag.String("camera-offsets", "", "Comma separated camera=offset corrections added to the capture dates of single cameras, by model or make and model")
+	journalPath = flag.String("journal", "", "Path to append every move to, so \"mediarizer2 undo <journal>\" can put the files back")
+	dryRun = flag.Bool("dry-run", false, "Print the moves, skips and duplicates of the run without changing any files")
+	planPath = flag.String("plan", "", "Path to write the operations of -dry-run to as JSON, \"-\" writes them to stdout")
+	reviewDuplicates = flag.Bool("review-duplicates", false, "Move the copies -dedupe would delete into a \"duplicates\" directory of the output, recording the original each matches")
+	organiseFiles = flag.Bool("organise", true, "Move the input files into the output directory, disable to only run -dedupe")
+	checkpointPath = flag.String("checkpoint", "", "Path to write the files the run has completed to every 30 seconds and when interrupted, so -resume can carry on from there")
+	resumePath = flag.String("resume", "", "Path to the checkpoint of an interrupted run to resume, skipping the files it completed and checkpointing there again")
+	indexPath = flag.String("index", "", "Path to the SQLite index of the output directory to update after the run, which \"mediarizer2 query\" searches")
+	summaryPath = flag.String("summary", "", "Path to write a JSON summary of the run to, \"-\" writes it to stdout and logs to stderr")
+	failFast = flag.Bool("fail-fast", false, "Stop at the first input or output file that can not be read or hashed, instead of listing it in the summary and carrying on")
+	watch = flag.Bool("watch", false, "Keep watching the input directory after the run and organise new files as they arrive, until interrupted")
+	watchDebounce = flag.Duration("watch-debounce", 5*time.Second, "Time without changes to the input directory after which -watch treats new files as completely written")
+	reportPath = flag.String("report", "", "Path to write the result of every input file to, as CSV when it ends in .csv and as JSON otherwise")
+	notifyWebhooks = flag.String("notify-webhook", "", "Comma separated Slack, Discord or other webhook URLs to post the summary of the run to once it completes or fails")
+	notifyEmails = flag.String("notify-email", "", "Comma separated email addresses to mail the summary of the run to once it completes or fails, requires smtp-server")
+	notifyOn = flag.String("notify-on", NotifyAlways, "Runs notifications are sent for (always, failure), failure also counting interrupted runs and runs with failed files")
+	notifyInterval = flag.Duration("notify-interval", 0, "With -watch, notify with a digest of the runs since the last notification once this long has passed, e.g. 24h (0 notifies when the watch ends)")
+	smtpServer = flag.String("smtp-server", "", "host:port of the SMTP server notification emails are sent through, using STARTTLS when offered")
+	smtpUser = flag.String("smtp-user", "", "User to authenticate to the SMTP server as, with the password in "+smtpPasswordEnv)
+	smtpFrom = flag.String("smtp-from", "", "Sender address of notification emails, the SMTP user by default")
 	showHelp = flag.Bool("help", false, "Display usage guide")
 	verbose = flag.Bool("verbose", false, "Display progress information in console")
+	quiet = flag.Bool("quiet", false, "Only report warnings and errors, without the progress bar")
+	logLevelName = flag.String("log-level", "info", "Least severe level logged to the console and the log file (debug, info, warn, error)")
+	logFilePath = flag.String("log-file", "", "Path to append every log line and the result and duration of every file to, as JSON lines")
 	showVersion = flag.Bool("version", false, "Display version information")
 
-	InfoLogger = log.New(os.Stdout, "\033[1m\033[34minfo\033[0m:\t", log.Lmsgprefix)
-	VerboseLogger = log.New(os.Stdout, "\033[1m\033[36mverbose\033[0m:\t", log.Ldate|log.Ltime)
-	WarningLogger = log.New(os.Stdout, "\033[1m\033[33mwarn\033[0m:\t", log.Ldate|log.Ltime)
-	ErrorLogger = log.New(os.Stdout, "\033[1m\033[31merror\033[0m:\t", log.Ldate|log.Ltime)
+	InfoLogger = log.New(logOutput, "\033[1m\033[34minfo\033[0m:\t", log.Lmsgprefix)
+	VerboseLogger = log.New(logOutput, "\033[1m\033[36mverbose\033[0m:\t", log.Ldate|log.Ltime)
+	WarningLogger = log.New(logOutput, "\033[1m\033[33mwarn\033[0m:\t", log.Ldate|log.Ltime)
+	ErrorLogger = log.New(logOutput, "\033[1m\033[31merror\033[0m:\t", log.Ldate|log.Ltime)
+
+	// The lines and records of the pipeline are logged like those of the command.
+	pipeline.Logger = logger
+	pipeline.RecordLogger = logStructured
 }
 
 func flagProcessor() []string {
@@ -233,8 +927,8 @@ func flagProcessor() []string {
 		os.Exit(0)
 	}
 
-	if *inputPath == "" || *outputPath == "" {
-		logger(LoggerTypeFatal, "input and output paths are mandatory")
+	if *inputPath == "" && len(sources) == 0 || *outputPath == "" {
+		logger(LoggerTypeFatal, "input or source, and output paths are mandatory")
 	}
 
 	var fileTypes []string
@@ -243,10 +937,10 @@ func flagProcessor() []string {
 		fileTypes = strings.Split(*fileTypesString, ",")
 
 		for i := range fileTypes {
-			if isPhoto(strings.ToLower(fileTypes[i])) {
+			if pipeline.IsPhoto(strings.ToLower(fileTypes[i])) {
 				isValidType = true
 				break
-			} else if isVideo(strings.ToLower(fileTypes[i])) {
+			} else if pipeline.IsVideo(strings.ToLower(fileTypes[i])) {
 				isValidType = true
 				break
 			}
@@ -257,8 +951,192 @@ func flagProcessor() []string {
 		}
 	}
 
-	if *geoLocation {
-		loadFeatureCollection()
+	if *organiseFlat && (*geoLocation || *nameTemplate != "") {
+		logger(LoggerTypeFatal, "flat organisation can not be combined with location or name options")
+	}
+
+	switch *cameraMode {
+	case "off":
+	case "camera", "date":
+		if *organiseFlat || *geoLocation {
+			logger(LoggerTypeFatal, "camera organisation can not be combined with flat or location options")
+		}
+	default:
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid camera organisation %q (off, camera, date)", *cameraMode))
+	}
+
+	if *folderLayout != "" {
+		if *organiseFlat || *geoLocation || *cameraMode != "off" {
+			logger(LoggerTypeFatal, "layout can not be combined with flat, location or camera options")
+		}
+		if err := pipeline.ValidateLayout(*folderLayout); err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+
+	if _, err := pipeline.ParseRoutes(*routeRules); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if *rawPrimary != "jpeg" && *rawPrimary != "raw" {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid RAW+JPEG primary %q (jpeg, raw)", *rawPrimary))
+	}
+
+	if *quarantineCorrupt && !*verifyMedia {
+		logger(LoggerTypeFatal, "quarantine-corrupted requires verify-media")
+	}
+
+	if *discardLiveVideos && !*livePhotos {
+		logger(LoggerTypeFatal, "discard-live-videos requires live-photos")
+	}
+
+	if _, ok := pipeline.ParseKeepPolicy(*keepCopy); !ok {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid kept copy %q (first, oldest, shortest, largest)", *keepCopy))
+	}
+
+	if !pipeline.IsDuplicateStrategy(*duplicateStrategy) {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid duplicate handling %q (move, skip, delete, hardlink)", *duplicateStrategy))
+	}
+
+	if _, err := pipeline.ParseWalkFilter(*excludeGlobs, *includeGlobs, *minSize, *maxSize, *modifiedAfter, *modifiedBefore); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if !pipeline.IsCollisionStrategy(*onCollision) {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid collision handling %q (rename-suffix, rename-hash, skip, overwrite-if-identical)", *onCollision))
+	}
+
+	if *duplicateFolder != "" && *duplicateStrategy != pipeline.DuplicateMove {
+		logger(LoggerTypeFatal, "duplicate-folder requires the move duplicate handling")
+	}
+
+	if _, ok := pipeline.ParseEquality(*equalityName); !ok {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid equality %q (bytes, pixels)", *equalityName))
+	}
+
+	if *fuzzyDuplicates && !*dedupeSource {
+		logger(LoggerTypeFatal, "fuzzy-duplicates requires dedupe")
+	}
+
+	if _, err := metadata.ParseDateSources(*dateSourceList); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if _, err := pipeline.ParseDateCorrection(*timeOffset, *assumeTimezone, *cameraOffsetList); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if *journalPath != "" && *dryRun {
+		logger(LoggerTypeFatal, "journal can not be combined with dry-run, which moves nothing")
+	}
+
+	if *reportPath != "" && *dryRun {
+		logger(LoggerTypeFatal, "report can not be combined with dry-run, use plan to record its operations")
+	}
+
+	if *planPath != "" && !*dryRun {
+		logger(LoggerTypeFatal, "plan requires dry-run")
+	}
+
+	if *dryRun && (*fixExtensions || *quarantinePath != "") {
+		logger(LoggerTypeFatal, "dry-run can not be combined with fix-ext or quarantine, which change files")
+	}
+
+	if *fastHash && !*dedupeSource {
+		logger(LoggerTypeFatal, "fast-hash requires dedupe")
+	}
+
+	if _, err := hash.ParseHashAlgorithm(*hashAlgorithmName); err != nil {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid hash algorithm %q (sha256, sha512/256, xxhash64, blake3)", *hashAlgorithmName))
+	}
+
+	if *fuzzyDistance < 0 || *fuzzyDistance > 64 {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid fuzzy distance %d (0-64)", *fuzzyDistance))
+	}
+
+	if *reviewDuplicates && !*dedupeSource {
+		logger(LoggerTypeFatal, "review-duplicates requires dedupe")
+	}
+
+	if err := validateNotifications(*notifyWebhooks, *notifyEmails, *smtpServer, *notifyOn); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if *notifyInterval < 0 {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid notify interval %v, it can not be negative", *notifyInterval))
+	}
+
+	if *watch && (*dryRun || *jsonlPath != "" || *estimateOnly || *checkExtensions || *fixExtensions) {
+		logger(LoggerTypeFatal, "watch can not be combined with dry-run, jsonl, estimate, check-ext or fix-ext")
+	}
+
+	if (*copyFiles || *copyThenDelete) && *renameOnly {
+		logger(LoggerTypeFatal, "copy and copy-then-delete can not be combined with rename-only")
+	}
+
+	if *copyFiles && !*copyThenDelete && (*dedupeSource || *journalPath != "" || *watch ||
+		*duplicateStrategy == pipeline.DuplicateDelete || *duplicateStrategy == pipeline.DuplicateHardlink) {
+		logger(LoggerTypeFatal, "copy keeps the input files, so it can not be combined with dedupe, journal, watch, or delete and hardlink duplicates")
+	}
+
+	if (*checkpointPath != "" || *resumePath != "") && (*dryRun || *watch) {
+		logger(LoggerTypeFatal, "checkpoint and resume can not be combined with dry-run or watch")
+	}
+
+	if *indexPath != "" && *dryRun {
+		logger(LoggerTypeFatal, "index can not be combined with dry-run")
+	}
+
+	if *indexPath != "" && pathsafe.Within(*inputPath, *indexPath) {
+		logger(LoggerTypeFatal, fmt.Sprintf("index %s can not be inside the input path, where it would be organised", *indexPath))
+	}
+
+	if len(sources) > 0 && (*watch || *checkpointPath != "" || *resumePath != "" || *quarantinePath != "" || *checkExtensions || *fixExtensions) {
+		logger(LoggerTypeFatal, "source can not be combined with watch, checkpoint, resume, quarantine, check-ext or fix-ext, which take a single input")
+	}
+
+	for _, rule := range sources {
+		if err := validateSourceRule(rule, flagTransfer()); err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+		if *indexPath != "" && pathsafe.Within(rule.Path, *indexPath) {
+			logger(LoggerTypeFatal, fmt.Sprintf("index %s can not be inside the source %s, where it would be organised", *indexPath, rule.Path))
+		}
+	}
+
+	for _, path := range []string{*checkpointPath, *resumePath} {
+		if path != "" && pathsafe.Within(*inputPath, path) {
+			logger(LoggerTypeFatal, fmt.Sprintf("checkpoint %s can not be inside the input path, where it would be organised", path))
+		}
+	}
+
+	if *workers < 0 || *maxOpenFiles < 0 || *bytesPerSecond < 0 || *retries < 0 || *retryBackoff < 0 || *spillAfter < 0 {
+		logger(LoggerTypeFatal, "workers, max-open-files, bytes-per-second, retries, retry-backoff and spill-after can not be negative")
+	}
+
+	if *spillDir != "" {
+		if *spillAfter == 0 {
+			logger(LoggerTypeFatal, "spill-dir requires spill-after")
+		}
+		if info, err := os.Stat(*spillDir); err != nil || !info.IsDir() {
+			logger(LoggerTypeFatal, fmt.Sprintf("spill directory %s is not a directory", *spillDir))
+		}
+	}
+
+	if *watchDebounce <= 0 {
+		logger(LoggerTypeFatal, fmt.Sprintf("invalid watch debounce %v, it must be positive", *watchDebounce))
+	}
+
+	if *quiet && *verbose {
+		logger(LoggerTypeFatal, "quiet can not be combined with verbose")
+	}
+
+	if _, err := parseLogLevel(*logLevelName); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	if !*dedupeSource && !*organiseFiles {
+		logger(LoggerTypeFatal, "nothing to do, enable -dedupe or -organise")
 	}
 
 	return fileTypes
@@ -271,6 +1149,17 @@ func directoryExists(path string) error {
 	return nil
 }
 
+// flagTransfer returns how the flags transfer input files into the output directory.
+func flagTransfer() string {
+	if *copyThenDelete {
+		return pipeline.TransferCopyThenDelete
+	} else if *copyFiles {
+		return pipeline.TransferCopy
+	}
+
+	return pipeline.TransferMove
+}
+
 func validatePaths(inputPath, outputPath string) (string, string) {
 	sourcePath := filepath.Clean(inputPath)
 	destinationPath := filepath.Clean(outputPath)
@@ -279,18 +1168,21 @@ func validatePaths(inputPath, outputPath string) (string, string) {
 		logger(LoggerTypeFatal, "input and output paths must be supplied")
 	}
 
-	sourceDrive := filepath.VolumeName(sourcePath)
-	destinationDrive := filepath.VolumeName(destinationPath)
-
-	if sourceDrive == "" || destinationDrive == "" {
-		logger(LoggerTypeFatal, "input and output paths must be on drives")
-	} else if sourceDrive != destinationDrive {
-		logger(LoggerTypeFatal, fmt.Sprintf("input and output paths must be on the same drive: source drive (%s), destination drive (%s)", sourceDrive, destinationDrive))
-	} else if err := directoryExists(sourcePath); err != nil {
+	// Files are copied across drives, only rename-only needs both paths on the same device.
+	if err := directoryExists(sourcePath); err != nil {
 		logger(LoggerTypeFatal, err.Error())
 	} else if err := directoryExists(destinationPath); err != nil {
 		logger(LoggerTypeFatal, err.Error())
 	}
 
+	if *renameOnly {
+		isSameDevice, err := pipeline.SameDevice(sourcePath, destinationPath)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		} else if !isSameDevice {
+			logger(LoggerTypeFatal, "rename-only mode requires input and output paths on the same device")
+		}
+	}
+
 	return sourcePath, destinationPath
 }
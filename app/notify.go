@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Outcomes of a run notifications are sent for.
+const (
+	NotifyCompleted   = "completed"
+	NotifyFailed      = "failed"
+	NotifyInterrupted = "interrupted"
+)
+
+// Runs notifications are sent for with -notify-on.
+const (
+	NotifyAlways  = "always"
+	NotifyFailure = "failure"
+)
+
+// smtpPasswordEnv is the environment variable the password of -smtp-user is read from, so it is
+// neither written in shell history nor visible in the process list.
+const smtpPasswordEnv = "MEDIARIZER_SMTP_PASSWORD"
+
+// notifyFailedListed is the number of failed files listed in a notification, the rest are counted.
+const notifyFailedListed = 10
+
+// discordContentLimit is the longest message Discord webhooks accept.
+const discordContentLimit = 2000
+
+// notifyTimeout bounds sending a single notification, so an unreachable webhook does not hold up the run.
+const notifyTimeout = 30 * time.Second
+
+// notifier sends the summary of a run to webhooks and by email.
+type notifier struct {
+	webhooks     []string
+	emails       []string
+	smtpServer   string
+	smtpUser     string
+	smtpFrom     string
+	onlyFailures bool
+}
+
+// notification is the body posted to generic webhooks.
+type notification struct {
+	Status  string     `json:"status"`
+	Error   string     `json:"error,omitempty"`
+	Text    string     `json:"text"`
+	Summary runSummary `json:"summary"`
+}
+
+// newNotifier creates a notifier for the comma separated webhook URLs and email addresses, or
+// returns nil when neither is given.
+func newNotifier(webhooks, emails, smtpServer, smtpUser, smtpFrom, notifyOn string) *notifier {
+	n := &notifier{
+		webhooks:     splitList(webhooks),
+		emails:       splitList(emails),
+		smtpServer:   smtpServer,
+		smtpUser:     smtpUser,
+		smtpFrom:     smtpFrom,
+		onlyFailures: notifyOn == NotifyFailure,
+	}
+	if len(n.webhooks) == 0 && len(n.emails) == 0 {
+		return nil
+	}
+
+	if n.smtpFrom == "" {
+		n.smtpFrom = n.smtpUser
+	}
+	if n.smtpFrom == "" {
+		hostname, _ := os.Hostname()
+		n.smtpFrom = "mediarizer@" + hostname
+	}
+
+	return n
+}
+
+// splitList splits a comma separated list, leaving out empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// validateNotifications checks the webhooks are HTTP URLs and that email has a server to go through.
+func validateNotifications(webhooks, emails, smtpServer, notifyOn string) error {
+	for _, webhook := range splitList(webhooks) {
+		webhookURL, err := url.Parse(webhook)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			return fmt.Errorf("invalid webhook %q, expected an http or https URL", webhook)
+		}
+	}
+
+	if len(splitList(emails)) > 0 && smtpServer == "" {
+		return fmt.Errorf("notify-email requires smtp-server")
+	}
+
+	if notifyOn != NotifyAlways && notifyOn != NotifyFailure {
+		return fmt.Errorf("invalid notify-on %q (%s, %s)", notifyOn, NotifyAlways, NotifyFailure)
+	}
+
+	return nil
+}
+
+// notify sends summary to every webhook and email address, as having failed with runErr when it is
+// set or as interrupted when summary is. Notifications that can not be sent are logged as errors,
+// they never fail the run.
+func (n *notifier) notify(summary runSummary, runErr error) {
+	if n == nil {
+		return
+	}
+
+	status := NotifyCompleted
+	if runErr != nil {
+		status = NotifyFailed
+	} else if summary.Interrupted {
+		status = NotifyInterrupted
+	}
+	if n.onlyFailures && status == NotifyCompleted && len(summary.Failed) == 0 {
+		return
+	}
+
+	text := notificationText(status, summary, runErr)
+	for _, webhook := range n.webhooks {
+		if err := postWebhook(webhook, status, text, summary, runErr); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+
+	if len(n.emails) > 0 {
+		subject := fmt.Sprintf("Mediarizer 2 run %s: %d files processed, %d failed", status, summary.Processed, len(summary.Failed))
+		if err := n.sendEmail(subject, text); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+}
+
+// notificationText describes the outcome of a run in a few lines, listing the first failed files.
+func notificationText(status string, summary runSummary, runErr error) string {
+	var text strings.Builder
+
+	duplicates := len(summary.Duplicates) + len(summary.Removed) + len(summary.Reviewed)
+	elapsed := time.Duration(summary.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(&text, "Mediarizer 2 run of %s %s in %s.\n", summary.Input, status, elapsed)
+	fmt.Fprintf(&text, "%d files processed into %s, %d duplicates, %d failed.\n", summary.Processed, summary.Output, duplicates, len(summary.Failed))
+
+	if runErr != nil {
+		fmt.Fprintf(&text, "Error: %v\n", runErr)
+	}
+
+	for i, failed := range summary.Failed {
+		if i == notifyFailedListed {
+			fmt.Fprintf(&text, "... and %d more failed files.\n", len(summary.Failed)-notifyFailedListed)
+			break
+		}
+		fmt.Fprintf(&text, "- %s: %s\n", failed.Path, failed.Error)
+	}
+
+	return text.String()
+}
+
+// postWebhook posts the notification to webhook, as a message for Slack and Discord webhooks and as
+// the status, text and summary for any other.
+func postWebhook(webhook, status, text string, summary runSummary, runErr error) error {
+	// Webhook URLs hold their token, so errors only name the host they were sent to.
+	webhookURL, err := url.Parse(webhook)
+	if err != nil {
+		return errors.New("failed to send notification to webhook: invalid URL")
+	}
+
+	var payload any
+	switch {
+	case webhookURL.Host == "hooks.slack.com":
+		payload = map[string]string{"text": text}
+	case (webhookURL.Host == "discord.com" || webhookURL.Host == "discordapp.com") && strings.HasPrefix(webhookURL.Path, "/api/webhooks/"):
+		if runes := []rune(text); len(runes) > discordContentLimit {
+			text = string(runes[:discordContentLimit-3]) + "..."
+		}
+		payload = map[string]string{"content": text}
+	default:
+		body := notification{Status: status, Text: text, Summary: summary}
+		if runErr != nil {
+			body.Error = runErr.Error()
+		}
+		payload = body
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+
+	client := http.Client{Timeout: notifyTimeout}
+	response, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to send notification to webhook %s: %v", webhookURL.Host, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("failed to send notification to webhook %s: %s", response.Request.URL.Host, response.Status)
+	}
+
+	return nil
+}
+
+// sendEmail mails text to the email addresses of n through its SMTP server, which is switched to TLS
+// when it offers STARTTLS. With an SMTP user the password is read from MEDIARIZER_SMTP_PASSWORD.
+func (n *notifier) sendEmail(subject, text string) error {
+	var auth smtp.Auth
+	if n.smtpUser != "" {
+		host := n.smtpServer
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", n.smtpUser, os.Getenv(smtpPasswordEnv), host)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.smtpFrom)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.emails, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	if err := smtp.SendMail(n.smtpServer, auth, n.smtpFrom, n.emails, message.Bytes()); err != nil {
+		return fmt.Errorf("failed to send notification email through %s: %v", n.smtpServer, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// printPlan writes one line per operation of plan to w.
+func printPlan(w io.Writer, plan *pipeline.Plan) {
+	for _, operation := range plan.Operations() {
+		action := operation.Action
+		if operation.Duplicate {
+			action += " (duplicate)"
+		}
+
+		switch {
+		case operation.Destination != "":
+			fmt.Fprintf(w, "%s %s -> %s\n", action, operation.Source, operation.Destination)
+		case operation.Original != "":
+			fmt.Fprintf(w, "%s %s (copy of %s)\n", action, operation.Source, operation.Original)
+		default:
+			fmt.Fprintf(w, "%s %s\n", action, operation.Source)
+		}
+	}
+}
+
+// writePlan writes the operations of plan as a JSON array to path, or to stdout when path is "-".
+func writePlan(path string, plan *pipeline.Plan) error {
+	encode := func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan.Operations())
+	}
+
+	if path == "-" {
+		if err := encode(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write plan: %v", err)
+		}
+		return nil
+	}
+
+	if err := atomicfile.Write(path, encode); err != nil {
+		return fmt.Errorf("failed to write plan %s: %v", path, err)
+	}
+
+	return nil
+}
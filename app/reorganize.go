@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/keybraker/mediarizer-2/lockfile"
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// setAsideFolders hold the duplicates, duplicates kept for review and quarantined files of a library,
+// which reorganize and check leave where they are.
+var setAsideFolders = []string{"DUPLICATE", pipeline.ReviewDirectoryName, pipeline.CorruptedFolderName}
+
+// placement is the layout a library is organised by, set by the same options as a run.
+type placement struct {
+	layout       string
+	format       string
+	nameTemplate string
+	cameraMode   string
+	geoLocation  bool
+	dateSources  []metadata.DateSource
+	correction   pipeline.DateCorrection
+}
+
+// misplacedFile is a file of a library outside the folder its placement puts it in, by paths relative
+// to the library.
+type misplacedFile struct {
+	Path       string `json:"path"`
+	Expected   string `json:"expected"`
+	DateSource string `json:"dateSource,omitempty"`
+}
+
+// placementFlags defines the layout options of a run on flags, returning the function that validates
+// them, once flags are parsed, into a placement.
+func placementFlags(flags *flag.FlagSet) func() placement {
+	layout := flags.String("layout", "", "Template of the folders files belong in, as with a run")
+	format := flags.String("format", "word", "Naming format for month folders (word, number, combined)")
+	nameTemplate := flags.String("name", "", "Template file names are renamed by, applied to their current names")
+	cameraMode := flags.String("camera", "off", "Organize files into folders by camera model (off, camera, date)")
+	geoLocation := flags.Bool("location", false, "Organize files into folders of the country their GPS coordinates lie in")
+	cameraAliasesPath := flags.String("camera-aliases", "", "Path to file of \"raw make or model = alias\" lines renaming cameras")
+	dateSourceList := flags.String("date-sources", "exif,xmp,filename,mtime", "Comma separated sources capture dates are read from in order (exif, xmp, filename, mtime)")
+	timeOffset := flags.Duration("time-offset", 0, "Duration added to every capture date, e.g. -1h30m")
+	assumeTimezone := flags.String("assume-timezone", "", "Timezone capture dates without one were taken in, e.g. Europe/Athens")
+	cameraOffsetList := flags.String("camera-offsets", "", "Comma separated camera=offset pairs added to the capture dates of a camera")
+
+	return func() placement {
+		switch *format {
+		case "word", "number", "combined":
+		default:
+			logger(LoggerTypeFatal, fmt.Sprintf("invalid format %q (word, number, combined)", *format))
+		}
+
+		switch *cameraMode {
+		case "off":
+		case "camera", "date":
+			if *geoLocation {
+				logger(LoggerTypeFatal, "camera organisation can not be combined with the location option")
+			}
+		default:
+			logger(LoggerTypeFatal, fmt.Sprintf("invalid camera organisation %q (off, camera, date)", *cameraMode))
+		}
+
+		if *layout != "" {
+			if *geoLocation || *cameraMode != "off" {
+				logger(LoggerTypeFatal, "layout can not be combined with location or camera options")
+			}
+			if err := pipeline.ValidateLayout(*layout); err != nil {
+				logger(LoggerTypeFatal, err.Error())
+			}
+		}
+
+		dateSources, err := metadata.ParseDateSources(*dateSourceList)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+
+		correction, err := pipeline.ParseDateCorrection(*timeOffset, *assumeTimezone, *cameraOffsetList)
+		if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+
+		if *cameraAliasesPath != "" {
+			if pipeline.CameraAliases, err = pipeline.LoadCameraAliases(*cameraAliasesPath); err != nil {
+				logger(LoggerTypeFatal, err.Error())
+			}
+		}
+
+		return placement{
+			layout:       *layout,
+			format:       *format,
+			nameTemplate: *nameTemplate,
+			cameraMode:   *cameraMode,
+			geoLocation:  *geoLocation,
+			dateSources:  dateSources,
+			correction:   correction,
+		}
+	}
+}
+
+// organisedPath returns the path the file at path belongs at in the library at root, with the source
+// its date was read from.
+func (p placement) organisedPath(root, path string) (string, string, error) {
+	fileInfo := pipeline.FileInfo{Path: path, FileType: pipeline.GetFileType(path, nil, true, true)}
+
+	if fileInfo.FileType != pipeline.FileTypeUnknown {
+		if p.geoLocation {
+			country, err := pipeline.GetCountry(path)
+			if err != nil {
+				return "", "", err
+			}
+			fileInfo.Country = country
+		} else {
+			created, source, err := pipeline.GetCreatedTime(path, p.dateSources, p.correction)
+			if err != nil {
+				return "", "", err
+			}
+			fileInfo.Created, fileInfo.HasCreationDate, fileInfo.DateSource = created, source != metadata.DateModTime, source.String()
+		}
+	}
+
+	var generatedPath string
+	var err error
+	if p.layout != "" {
+		generatedPath, err = pipeline.GetLayoutDestinationPath(root, fileInfo, p.layout, p.format)
+	} else {
+		generatedPath, err = pipeline.GetDestinationPath(root, fileInfo, p.geoLocation, p.format, p.cameraMode)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	generatedPath, err = pipeline.ApplyNameTemplate(generatedPath, fileInfo, p.nameTemplate)
+	if err != nil {
+		return "", "", err
+	}
+
+	return filepath.Clean(generatedPath), fileInfo.DateSource, nil
+}
+
+// libraryFiles lists the media files of the library at root, leaving out the set aside folders. The
+// files are listed before any is moved, so none is visited twice.
+func libraryFiles(root string) []string {
+	var paths []string
+	for _, path := range pipeline.ListFiles(root, "", pipeline.WalkFilter{}, false, nil, true, true) {
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+
+		setAside := false
+		for _, folder := range strings.Split(filepath.Dir(relPath), string(filepath.Separator)) {
+			if slices.Contains(setAsideFolders, folder) {
+				setAside = true
+				break
+			}
+		}
+
+		if !setAside {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// openLibrary checks that flags were given a single library and that it is a directory, returning
+// its cleaned path.
+func openLibrary(flags *flag.FlagSet, usage string) string {
+	if flags.NArg() != 1 {
+		logger(LoggerTypeFatal, usage)
+	}
+
+	root := filepath.Clean(flags.Arg(0))
+	if info, err := os.Stat(root); err != nil {
+		logger(LoggerTypeFatal, fmt.Sprintf("failed to open directory %s: %v", root, err))
+	} else if !info.IsDir() {
+		logger(LoggerTypeFatal, fmt.Sprintf("%s is not a directory", root))
+	}
+
+	return root
+}
+
+// moveWithinLibrary renames the file at path to destination along with its sidecars, never copying,
+// and removes the folders of the library at root it leaves empty.
+func moveWithinLibrary(root, path, destination string, sidecars []string, journal *pipeline.Journal) error {
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(destination), err)
+	}
+
+	moves := [][2]string{{path, destination}}
+	for _, sidecar := range sidecars {
+		moves = append(moves, [2]string{sidecar, pipeline.CompanionPath(destination, path, sidecar)})
+	}
+
+	var renamed int64
+	for _, move := range moves {
+		var hashStr string
+		if journal != nil {
+			var err error
+			if hashStr, err = journal.HashOf(move[0]); err != nil {
+				return err
+			}
+		}
+
+		if err := pipeline.RenameFile(move[0], move[1], true, &renamed, nil); err != nil {
+			return err
+		}
+
+		if journal != nil {
+			if err := journal.Record(move[0], move[1], hashStr); err != nil {
+				return err
+			}
+		}
+	}
+
+	for dirPath := filepath.Dir(path); dirPath != root && pathsafe.Within(root, dirPath); dirPath = filepath.Dir(dirPath) {
+		if os.Remove(dirPath) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// runReorganize implements `mediarizer2 reorganize [options] <library>`, moving the files of an
+// organised library to where the given layout places them, within the library itself.
+func runReorganize(args []string) {
+	const usage = "usage: mediarizer2 reorganize [-layout <template>] [-name <template>] [-dry-run] [-journal <path>] <library>"
+
+	flags := flag.NewFlagSet("reorganize", flag.ExitOnError)
+	placementOf := placementFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "Print the moves without making any")
+	journalPath := flags.String("journal", "", "Path to record every move to, which `mediarizer2 undo` reverts")
+	waitForLock := flags.Bool("wait-lock", false, "Wait for other runs on the library to finish instead of failing")
+	flags.Parse(args)
+
+	p := placementOf()
+	root := openLibrary(flags, usage)
+
+	var lock *lockfile.Lock
+	if !*dryRun {
+		var err error
+		lock, err = lockfile.Acquire(root, *waitForLock)
+		if errors.Is(err, lockfile.ErrLocked) {
+			logger(LoggerTypeFatal, "another run is already organising the library, use -wait-lock to wait for it")
+		} else if err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+
+	var journal *pipeline.Journal
+	if *journalPath != "" && !*dryRun {
+		var err error
+		if journal, err = pipeline.OpenJournal(*journalPath, &sync.Map{}); err != nil {
+			logger(LoggerTypeFatal, err.Error())
+		}
+	}
+
+	var moved, inPlace, failed int
+	for _, path := range libraryFiles(root) {
+		destination, _, err := p.organisedPath(root, path)
+		if err != nil {
+			logger(LoggerTypeWarning, fmt.Sprintf("failed to place %s: %v", path, err))
+			failed++
+			continue
+		}
+
+		// The file and its sidecars free the paths they hold as they move, so a file renamed with a
+		// suffix before stays at its path instead of getting another.
+		sidecars := pipeline.FindSidecars(path)
+		taken := func(primaryPath string) (bool, error) {
+			paths := []string{primaryPath}
+			for _, sidecar := range sidecars {
+				paths = append(paths, pipeline.CompanionPath(primaryPath, path, sidecar))
+			}
+
+			for _, candidate := range paths {
+				if candidate == path || slices.Contains(sidecars, candidate) {
+					continue
+				}
+				if exists, err := pipeline.FileExists(candidate); err != nil || exists {
+					return exists, err
+				}
+			}
+
+			return false, nil
+		}
+
+		if destination != path {
+			destination, _, err = pipeline.ResolveCollision(path, destination, pipeline.CollisionRenameSuffix, taken)
+			if err != nil {
+				logger(LoggerTypeWarning, fmt.Sprintf("failed to place %s: %v", path, err))
+				failed++
+				continue
+			}
+		}
+
+		if destination == path {
+			inPlace++
+			continue
+		}
+
+		if *dryRun {
+			fmt.Fprintf(logOutput, "Would move %s to %s\n", path, destination)
+			moved++
+			continue
+		}
+
+		if err := moveWithinLibrary(root, path, destination, sidecars, journal); err != nil {
+			logger(LoggerTypeWarning, err.Error())
+			failed++
+			continue
+		}
+
+		logger(LoggerTypeVerbose, fmt.Sprintf("moved %s to %s", path, destination))
+		moved++
+	}
+
+	verb := "moved"
+	if *dryRun {
+		verb = "to move"
+	}
+	logger(LoggerTypeInfo, fmt.Sprintf("%d files %s, %d already in place, %d failed.", moved, verb, inPlace, failed))
+
+	if journal != nil {
+		if err := journal.Close(); err != nil {
+			logger(LoggerTypeError, err.Error())
+		}
+	}
+	if lock != nil {
+		lock.Release()
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runCheck implements `mediarizer2 check [options] [-json] <library>`, listing the files of an
+// organised library outside the folder their date, or the given layout, places them in.
+func runCheck(args []string) {
+	const usage = "usage: mediarizer2 check [-layout <template>] [-json] <library>"
+
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	placementOf := placementFlags(flags)
+	asJSON := flags.Bool("json", false, "Write the misplaced files as a JSON array")
+	flags.Parse(args)
+
+	// The JSON on stdout stays parseable, so everything else is written to stderr.
+	if *asJSON {
+		setLogOutput(os.Stderr)
+	}
+
+	p := placementOf()
+	root := openLibrary(flags, usage)
+
+	var misplaced []misplacedFile
+	files := libraryFiles(root)
+	unreadable := 0
+	for _, path := range files {
+		destination, dateSource, err := p.organisedPath(root, path)
+		if err != nil {
+			logger(LoggerTypeWarning, fmt.Sprintf("failed to place %s: %v", path, err))
+			unreadable++
+			continue
+		}
+
+		// File names differ by the suffixes of collisions, so only the folders are compared.
+		if filepath.Dir(destination) == filepath.Dir(path) {
+			continue
+		}
+
+		relPath, _ := filepath.Rel(root, path)
+		relExpected, _ := filepath.Rel(root, filepath.Dir(destination))
+		misplaced = append(misplaced, misplacedFile{Path: filepath.ToSlash(relPath), Expected: filepath.ToSlash(relExpected), DateSource: dateSource})
+	}
+
+	if err := printMisplacedFiles(os.Stdout, misplaced, *asJSON); err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+
+	logger(LoggerTypeInfo, fmt.Sprintf("%d of %d files misplaced, %d could not be placed.", len(misplaced), len(files), unreadable))
+
+	// Misplaced files fail the command, so scripts can tell a consistent library apart.
+	if len(misplaced) > 0 || unreadable > 0 {
+		os.Exit(1)
+	}
+}
+
+// printMisplacedFiles writes a line per file to w, with its path, the folder it belongs in and the
+// source of its date.
+func printMisplacedFiles(w io.Writer, misplaced []misplacedFile, asJSON bool) error {
+	if asJSON {
+		if misplaced == nil {
+			misplaced = []misplacedFile{}
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(misplaced); err != nil {
+			return fmt.Errorf("failed to write check result: %v", err)
+		}
+		return nil
+	}
+
+	for _, file := range misplaced {
+		fmt.Fprintf(w, "%s -> %s/", file.Path, file.Expected)
+		if file.DateSource != "" {
+			fmt.Fprintf(w, " (%s date)", file.DateSource)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
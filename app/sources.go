@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/pathsafe"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// sourceOptions are the options a -source entry can set for its own files, overriding the flags of
+// the same name. Filter globs given more than once add up.
+var sourceOptions = []string{"transfer", "duplicate", "exclude-glob", "include-glob", "min-size", "max-size", "after", "before"}
+
+// sourceRule is an input path of a run with the options that apply to its files only.
+type sourceRule struct {
+	Path    string
+	options map[string]string
+}
+
+// option returns the value the rule sets for name, or fallback when it sets none.
+func (rule sourceRule) option(name, fallback string) string {
+	if value, found := rule.options[name]; found {
+		return value
+	}
+
+	return fallback
+}
+
+// sourceList is the value of the -source flag, which may be given several times. A single value can
+// hold several sources separated by semicolons, the way config files write a list of them.
+// Semicolons and commas within double quotes belong to the path or value they quote.
+type sourceList []sourceRule
+
+func (list *sourceList) String() string {
+	if list == nil {
+		return ""
+	}
+
+	specs := make([]string, len(*list))
+	for i, rule := range *list {
+		specs[i] = quoteSourceValue(rule.Path)
+		for _, name := range sourceOptions {
+			if value, found := rule.options[name]; found {
+				specs[i] += "," + name + "=" + quoteSourceValue(value)
+			}
+		}
+	}
+
+	return strings.Join(specs, ";")
+}
+
+func (list *sourceList) Set(value string) error {
+	for _, spec := range splitQuoted(value, ';') {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+
+		rule, err := parseSourceRule(spec)
+		if err != nil {
+			return err
+		}
+		*list = append(*list, rule)
+	}
+
+	return nil
+}
+
+// parseSourceRule parses a source such as "/media/sd,transfer=copy-then-delete,exclude-glob=*.tmp",
+// an input path followed by options of sourceOptions. The path can also be given as path=<path>, and
+// the path or a value holding commas is double quoted, such as "/home/me/Photos, 2019",transfer=copy.
+func parseSourceRule(spec string) (sourceRule, error) {
+	rule := sourceRule{options: make(map[string]string)}
+
+	if strings.Count(spec, `"`)%2 != 0 {
+		return sourceRule{}, fmt.Errorf("source %s has an unterminated quote", spec)
+	}
+
+	for i, item := range splitQuoted(spec, ',') {
+		item = strings.TrimSpace(item)
+		name, value, _ := strings.Cut(item, "=")
+		if strings.HasPrefix(item, `"`) {
+			// A quoted path may hold an equals sign of its own.
+			name, value = "", item
+		}
+		value = unquoteSourceValue(value)
+
+		switch {
+		case name == "path":
+			rule.Path = value
+		case slices.Contains(sourceOptions, name):
+			if previous, found := rule.options[name]; found && strings.HasSuffix(name, "-glob") {
+				value = previous + "," + value
+			}
+			rule.options[name] = value
+		case i == 0:
+			rule.Path = unquoteSourceValue(item)
+		default:
+			return sourceRule{}, fmt.Errorf("invalid option %q of source %s (path, %s)", item, spec, strings.Join(sourceOptions, ", "))
+		}
+	}
+
+	if rule.Path == "" {
+		return sourceRule{}, fmt.Errorf("source %s has no path", spec)
+	}
+
+	return rule, nil
+}
+
+// splitQuoted splits s at every sep that is not within double quotes, keeping the quotes.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unquoteSourceValue returns value without the double quotes around it, a doubled quote within them
+// standing for one. A value that is not quoted is returned as it is.
+func unquoteSourceValue(value string) string {
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return value
+	}
+
+	return strings.ReplaceAll(value[1:len(value)-1], `""`, `"`)
+}
+
+// quoteSourceValue double quotes value when it holds a comma, semicolon or quote, the way
+// parseSourceRule reads it back.
+func quoteSourceValue(value string) string {
+	if !strings.ContainsAny(value, `,;"`) {
+		return value
+	}
+
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+// sourceTransfer returns how the files of rule are transferred, transfer unless the rule sets it.
+func sourceTransfer(rule sourceRule, transfer string) string {
+	return rule.option("transfer", transfer)
+}
+
+// sourceWalkFilter builds the WalkFilter of rule, the filter flags applying to the filters it does not set.
+func sourceWalkFilter(rule sourceRule) (pipeline.WalkFilter, error) {
+	return pipeline.ParseWalkFilter(
+		rule.option("exclude-glob", *excludeGlobs),
+		rule.option("include-glob", *includeGlobs),
+		rule.option("min-size", *minSize),
+		rule.option("max-size", *maxSize),
+		rule.option("after", *modifiedAfter),
+		rule.option("before", *modifiedBefore),
+	)
+}
+
+// validateSourceRule checks the overrides of rule, with transfer the transfer of the flags.
+func validateSourceRule(rule sourceRule, transfer string) error {
+	ruleTransfer := sourceTransfer(rule, transfer)
+	if ruleTransfer != pipeline.TransferMove && ruleTransfer != pipeline.TransferCopy && ruleTransfer != pipeline.TransferCopyThenDelete {
+		return fmt.Errorf("invalid transfer %q of source %s (%s, %s, %s)", ruleTransfer, rule.Path, pipeline.TransferMove, pipeline.TransferCopy, pipeline.TransferCopyThenDelete)
+	}
+
+	strategy := rule.option("duplicate", *duplicateStrategy)
+	if !pipeline.IsDuplicateStrategy(strategy) {
+		return fmt.Errorf("invalid duplicate handling %q of source %s (move, skip, delete, hardlink)", strategy, rule.Path)
+	}
+
+	if *duplicateFolder != "" && strategy != pipeline.DuplicateMove {
+		return fmt.Errorf("duplicate-folder requires duplicate handling move, source %s handles them with %s", rule.Path, strategy)
+	}
+
+	if pipeline.IsCopyTransfer(ruleTransfer) && *renameOnly {
+		return fmt.Errorf("source %s copies its files, which can not be combined with rename-only", rule.Path)
+	}
+
+	if ruleTransfer == pipeline.TransferCopy && (*dedupeSource || *journalPath != "" || strategy == pipeline.DuplicateDelete || strategy == pipeline.DuplicateHardlink) {
+		return fmt.Errorf("source %s keeps its files with copy, so it can not be combined with dedupe, journal, or delete and hardlink duplicates", rule.Path)
+	}
+
+	if _, err := sourceWalkFilter(rule); err != nil {
+		return fmt.Errorf("invalid filter of source %s: %v", rule.Path, err)
+	}
+
+	return nil
+}
+
+// sourcePipelineOptions returns opts with the input path and overrides of rule applied.
+func sourcePipelineOptions(opts pipeline.Options, rule sourceRule, transfer string) pipeline.Options {
+	opts.SourcePath = rule.Path
+	opts.Transfer = sourceTransfer(rule, transfer)
+	opts.DuplicateStrategy = rule.option("duplicate", *duplicateStrategy)
+	opts.Filter, _ = sourceWalkFilter(rule)
+
+	// An output directory nested inside the input holds already organised files, which are not scanned again.
+	opts.ExcludePath = ""
+	if rule.Path != opts.DestinationPath && pathsafe.Within(rule.Path, opts.DestinationPath) {
+		opts.ExcludePath = opts.DestinationPath
+	}
+
+	return opts
+}
+
+// runSources runs the pipeline of opts once for every source in order, with its overrides, into the
+// same destination. The destination is hashed once by the first source, and every source adds its
+// files to the hash-map, so files of a later source are found to duplicate those organised from an
+// earlier one. The results are combined, and the first source that fails ends the run with the
+// results so far.
+func runSources(ctx context.Context, opts pipeline.Options, sources []sourceRule, transfer string) (pipeline.Result, error) {
+	var combined pipeline.Result
+
+	// A run of a single input is logged like it always was.
+	if len(sources) == 1 {
+		return runPipeline(ctx, sourcePipelineOptions(opts, sources[0], transfer))
+	}
+
+	shared := &pipeline.DestinationHashes{}
+	defer shared.Close()
+	opts.DestinationHashes = shared
+
+	for _, rule := range sources {
+		logger(LoggerTypeInfo, fmt.Sprintf("Ingesting from %s.", rule.Path))
+
+		result, err := runPipeline(ctx, sourcePipelineOptions(opts, rule, transfer))
+		combined.Add(result)
+		combined.SpilledHashes = shared.Spilled()
+		if err != nil {
+			return combined, fmt.Errorf("failed to ingest from %s: %w", rule.Path, err)
+		}
+		logger(LoggerTypeInfo, fmt.Sprintf("%d files processed from %s.", result.Processed, rule.Path))
+	}
+
+	return combined, nil
+}
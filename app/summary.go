@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// logOutput receives the banner, the log lines and the progress bar.
+var logOutput io.Writer = os.Stdout
+
+// setLogOutput redirects the banner, the log lines and the progress bar to w.
+func setLogOutput(w io.Writer) {
+	logOutput = w
+	InfoLogger.SetOutput(w)
+	VerboseLogger.SetOutput(w)
+	WarningLogger.SetOutput(w)
+	ErrorLogger.SetOutput(w)
+}
+
+// runSummary is the machine readable outcome of a run written by -summary.
+type runSummary struct {
+	Input          string                      `json:"input"`
+	Output         string                      `json:"output"`
+	Processed      int                         `json:"processed"`
+	Renamed        int64                       `json:"renamed"`
+	Removed        []string                    `json:"removed"`
+	Reviewed       []pipeline.ReviewedCopy     `json:"reviewed"`
+	Duplicates     []pipeline.HandledDuplicate `json:"duplicates"`
+	Failed         []pipeline.FailedFile       `json:"failed"`
+	Unstable       []string                    `json:"unstable"`
+	TimedOut       []string                    `json:"timedOut"`
+	Vanished       []string                    `json:"vanished"`
+	CacheHits      int64                       `json:"cacheHits"`
+	CacheMisses    int64                       `json:"cacheMisses"`
+	PeakHeapBytes  uint64                      `json:"peakHeapBytes"`
+	SpilledHashes  int64                       `json:"spilledHashes"`
+	ElapsedSeconds float64                     `json:"elapsedSeconds"`
+	// Interrupted flags runs that were interrupted before every file was processed.
+	Interrupted bool `json:"interrupted"`
+}
+
+// newRunSummary builds the summary of a run from the result of its pipeline.
+func newRunSummary(sourcePath, destinationPath string, result pipeline.Result, elapsed time.Duration) runSummary {
+	summary := runSummary{
+		Input:          sourcePath,
+		Output:         destinationPath,
+		Processed:      result.Processed,
+		Renamed:        result.Renamed,
+		Removed:        result.Removed,
+		Reviewed:       result.Reviewed,
+		Duplicates:     result.Duplicates,
+		Failed:         result.Failed,
+		Unstable:       result.Hash.Unstable,
+		TimedOut:       result.Hash.TimedOut,
+		Vanished:       result.Hash.Vanished,
+		CacheHits:      result.Hash.CacheHits,
+		CacheMisses:    result.Hash.CacheMisses,
+		PeakHeapBytes:  result.PeakHeapBytes,
+		SpilledHashes:  result.SpilledHashes,
+		ElapsedSeconds: elapsed.Seconds(),
+	}
+
+	// Empty lists are written as [] rather than null so consumers can always iterate them.
+	if summary.Removed == nil {
+		summary.Removed = []string{}
+	}
+	if summary.Reviewed == nil {
+		summary.Reviewed = []pipeline.ReviewedCopy{}
+	}
+	if summary.Duplicates == nil {
+		summary.Duplicates = []pipeline.HandledDuplicate{}
+	}
+	if summary.Failed == nil {
+		summary.Failed = []pipeline.FailedFile{}
+	}
+	if summary.Unstable == nil {
+		summary.Unstable = []string{}
+	}
+	if summary.TimedOut == nil {
+		summary.TimedOut = []string{}
+	}
+	if summary.Vanished == nil {
+		summary.Vanished = []string{}
+	}
+
+	return summary
+}
+
+// writeSummary writes summary as JSON to path, or to stdout when path is "-".
+func writeSummary(path string, summary runSummary) error {
+	encode := func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summary)
+	}
+
+	if path == "-" {
+		if err := encode(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write summary: %v", err)
+		}
+		return nil
+	}
+
+	if err := atomicfile.Write(path, encode); err != nil {
+		return fmt.Errorf("failed to write summary %s: %v", path, err)
+	}
+
+	return nil
+}
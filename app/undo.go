@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/keybraker/mediarizer-2/pipeline"
+)
+
+// runUndo implements `mediarizer2 undo <journal>`.
+func runUndo(args []string) {
+	if len(args) != 1 {
+		logger(LoggerTypeFatal, "usage: mediarizer2 undo <journal>")
+	}
+
+	restored, err := pipeline.UndoJournal(args[0])
+	logger(LoggerTypeInfo, fmt.Sprintf("%d files restored.", restored))
+	if err != nil {
+		logger(LoggerTypeFatal, err.Error())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// watchSource calls run whenever files arrive under sourcePath, once nothing under it has changed for
+// debounce, so files still being written are left for the next run. Directories created meanwhile are
+// watched too, excludePath never is. It returns when ctx is cancelled, after the current run.
+func watchSource(ctx context.Context, sourcePath, excludePath string, debounce time.Duration, run func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %v", sourcePath, err)
+	}
+	defer watcher.Close()
+
+	if err := addWatches(watcher, sourcePath, excludePath); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger(LoggerTypeWarning, fmt.Sprintf("failed to watch %s: %v", sourcePath, err))
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// Files leaving the input, as the runs move them, are no new arrivals.
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addWatches(watcher, event.Name, excludePath); err != nil {
+						logger(LoggerTypeWarning, err.Error())
+					}
+				}
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(debounce)
+			settled = timer.C
+		case <-settled:
+			settled = nil
+			run()
+		}
+	}
+}
+
+// addWatches watches root and every directory below it, leaving out excludePath.
+func addWatches(watcher *fsnotify.Watcher, root, excludePath string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk %s: %v", path, err)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && pathsafe.Within(excludePath, path) {
+			return filepath.SkipDir
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package atomicfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File is a temporary file that replaces its target path only once committed,
+// so the target is always either complete or left untouched.
+type File struct {
+	*os.File
+	path string
+	done bool
+}
+
+// Create creates a temporary file next to path that becomes path on Commit.
+func Create(path string) (*File, error) {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for %s: %v", path, err)
+	}
+
+	if err := tempFile.Chmod(0644); err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return nil, fmt.Errorf("failed to set permissions of temporary file for %s: %v", path, err)
+	}
+
+	return &File{File: tempFile, path: path}, nil
+}
+
+// Commit flushes the temporary file to disk and renames it over the target path.
+func (f *File) Commit() error {
+	if f.done {
+		return fmt.Errorf("file %s already committed or aborted", f.path)
+	}
+	f.done = true
+
+	if err := f.File.Sync(); err != nil {
+		f.File.Close()
+		os.Remove(f.File.Name())
+		return fmt.Errorf("failed to sync temporary file for %s: %v", f.path, err)
+	}
+
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return fmt.Errorf("failed to close temporary file for %s: %v", f.path, err)
+	}
+
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		os.Remove(f.File.Name())
+		return fmt.Errorf("failed to replace %s: %v", f.path, err)
+	}
+
+	return nil
+}
+
+// Abort discards the temporary file, leaving the target path untouched.
+// Calling it after Commit does nothing, so it is safe to defer.
+func (f *File) Abort() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	f.File.Close()
+	if err := os.Remove(f.File.Name()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove temporary file for %s: %v", f.path, err)
+	}
+
+	return nil
+}
+
+// Write atomically replaces path with the output of write.
+func Write(path string, write func(w io.Writer) error) error {
+	file, err := Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	if err := write(file); err != nil {
+		return err
+	}
+
+	return file.Commit()
+}
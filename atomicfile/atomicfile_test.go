@@ -0,0 +1,117 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const previousContent = "previous content\n"
+
+// writeTarget writes the file an interrupted write must leave intact.
+func writeTarget(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(previousContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// checkTarget fails t unless path still holds the previous content.
+func checkTarget(t *testing.T, path string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != previousContent {
+		t.Errorf("%s holds %q after an interrupted write, want %q", path, data, previousContent)
+	}
+}
+
+func TestWriteFailureKeepsPreviousFile(t *testing.T) {
+	path := writeTarget(t)
+	errWrite := errors.New("write interrupted")
+
+	err := Write(path, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "partial"); err != nil {
+			return err
+		}
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("Write returned %v, want %v", err, errWrite)
+	}
+
+	checkTarget(t, path)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files left next to %s, want the temporary file removed", len(entries), path)
+	}
+}
+
+// TestInterruptedProcessKeepsPreviousFile kills a process halfway through writing, which neither
+// commits nor aborts, so the temporary file is left behind but the target never touched.
+func TestInterruptedProcessKeepsPreviousFile(t *testing.T) {
+	if target := os.Getenv("ATOMICFILE_INTERRUPTED_TARGET"); target != "" {
+		file, err := Create(target)
+		if err != nil {
+			os.Exit(2)
+		}
+		io.WriteString(file, "partial")
+		file.Sync()
+		os.Stdout.WriteString("written\n")
+		time.Sleep(time.Hour)
+	}
+
+	path := writeTarget(t)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInterruptedProcessKeepsPreviousFile$")
+	cmd.Env = append(os.Environ(), "ATOMICFILE_INTERRUPTED_TARGET="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process is killed once it has written part of the new content.
+	buf := make([]byte, len("written\n"))
+	if _, err := io.ReadFull(stdout, buf); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("failed to wait for the partial write: %v", err)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	checkTarget(t, path)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var temporary int
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".state.json.tmp-") {
+			temporary++
+		}
+	}
+	if temporary != 1 {
+		t.Errorf("%d temporary files next to %s, want the one the killed write left", temporary, path)
+	}
+}
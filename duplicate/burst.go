@@ -0,0 +1,176 @@
+package duplicate
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/metadata"
+)
+
+// Burst is a group of perceptually similar images captured within the same second.
+type Burst struct {
+	Captured time.Time
+	Paths    []string
+}
+
+var errNoCaptureDate = errors.New("no capture date")
+
+type burstShot struct {
+	path     string
+	captured time.Time
+	hash     uint64
+}
+
+// FindBursts clusters images that share their EXIF capture second and are within radius bits perceptually.
+// Images without a capture date are left out, bursts are ordered by capture time.
+func FindBursts(paths []string, radius int) ([]Burst, error) {
+	shots, err := collectBurstShots(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := make(map[time.Time][]burstShot)
+	for _, shot := range shots {
+		second := shot.captured.Truncate(time.Second)
+		seconds[second] = append(seconds[second], shot)
+	}
+
+	var bursts []Burst
+	for second, secondShots := range seconds {
+		if len(secondShots) < 2 {
+			continue
+		}
+
+		hashes := make(map[string]uint64, len(secondShots))
+		for _, shot := range secondShots {
+			hashes[shot.path] = shot.hash
+		}
+		index := hash.BuildPerceptualIndex(hashes)
+
+		for _, cluster := range clusterPerceptual(secondShots, hashes, index, radius) {
+			bursts = append(bursts, Burst{Captured: second, Paths: cluster})
+		}
+	}
+
+	sort.Slice(bursts, func(i, j int) bool {
+		if !bursts[i].Captured.Equal(bursts[j].Captured) {
+			return bursts[i].Captured.Before(bursts[j].Captured)
+		}
+		return bursts[i].Paths[0] < bursts[j].Paths[0]
+	})
+
+	return bursts, nil
+}
+
+// clusterPerceptual groups shots into connected components of perceptual neighbours, dropping singletons.
+func clusterPerceptual(shots []burstShot, hashes map[string]uint64, index *hash.PerceptualIndex, radius int) [][]string {
+	sort.Slice(shots, func(i, j int) bool { return shots[i].path < shots[j].path })
+
+	visited := make(map[string]bool, len(shots))
+	var clusters [][]string
+
+	for _, shot := range shots {
+		if visited[shot.path] {
+			continue
+		}
+		visited[shot.path] = true
+
+		cluster := []string{shot.path}
+		queue := []string{shot.path}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			for _, match := range index.Query(hashes[current], radius) {
+				if !visited[match.Path] {
+					visited[match.Path] = true
+					cluster = append(cluster, match.Path)
+					queue = append(queue, match.Path)
+				}
+			}
+		}
+
+		if len(cluster) > 1 {
+			sort.Strings(cluster)
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	return clusters
+}
+
+// collectBurstShots reads the capture date and perceptual hash of every path that has a capture date.
+func collectBurstShots(paths []string) ([]burstShot, error) {
+	pathChan := make(chan string)
+	shotChan := make(chan burstShot)
+	errChan := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathChan {
+				shot, err := readBurstShot(path)
+				if errors.Is(err, errNoCaptureDate) {
+					continue
+				} else if err != nil {
+					select {
+					case errChan <- err:
+					default:
+					}
+					continue
+				}
+
+				shotChan <- shot
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pathChan)
+		for _, path := range paths {
+			pathChan <- path
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(shotChan)
+	}()
+
+	var shots []burstShot
+	for shot := range shotChan {
+		shots = append(shots, shot)
+	}
+
+	select {
+	case err := <-errChan:
+		return nil, err
+	default:
+	}
+
+	return shots, nil
+}
+
+// readBurstShot reads the capture date and perceptual hash of path, turning a panicking decoder into an error.
+func readBurstShot(path string) (shot burstShot, err error) {
+	defer hash.RecoverPanic(path, &err)
+
+	captured, err := metadata.ExtractCaptureDate(path)
+	if err != nil {
+		return burstShot{}, errNoCaptureDate
+	}
+
+	perceptualHash, err := hash.GetPerceptualHash(path)
+	if err != nil {
+		return burstShot{}, fmt.Errorf("failed to get perceptual hash for %s: %v", path, err)
+	}
+
+	return burstShot{path: path, captured: captured, hash: perceptualHash}, nil
+}
@@ -1,21 +1,18 @@
 package duplicate
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/keybraker/mediarizer-2/hash"
 )
 
 // createDuplicateFolder creates a folder for storing duplicates of the file.
 func CreateDuplicateFolder(destinationPath, duplicateFileName string) (string, error) {
-	ext := filepath.Ext(duplicateFileName)
-	nameWithoutExt := strings.TrimSuffix(duplicateFileName, ext)
-	underscoreExt := strings.ReplaceAll(ext, ".", "_")
-	duplicatesFolder := filepath.Join(filepath.Dir(destinationPath), fmt.Sprintf("%s%s", nameWithoutExt, underscoreExt))
+	duplicatesFolder := DuplicateFolderPath(destinationPath, duplicateFileName)
 
 	err := os.MkdirAll(duplicatesFolder, 0755)
 	if err != nil {
@@ -25,26 +22,46 @@ func CreateDuplicateFolder(destinationPath, duplicateFileName string) (string, e
 	return duplicatesFolder, nil
 }
 
+// DuplicateFolderPath returns the folder CreateDuplicateFolder creates, without creating it.
+func DuplicateFolderPath(destinationPath, duplicateFileName string) string {
+	ext := filepath.Ext(duplicateFileName)
+	nameWithoutExt := strings.TrimSuffix(duplicateFileName, ext)
+	underscoreExt := strings.ReplaceAll(ext, ".", "_")
+
+	return filepath.Join(filepath.Dir(destinationPath), fmt.Sprintf("%s%s", nameWithoutExt, underscoreExt))
+}
+
 // isDuplicate checks if the file is a duplicate and handles it based on the strategy.
 func IsDuplicate(
 	path string,
 	duplicateStrategy string,
-	fileHashMap *sync.Map,
-	hashCache *sync.Map,
+	fileHashMap hash.Map,
+	hashCache hash.Map,
 ) (bool, error) {
-	hashValue, err := hash.GetFileHash(path, hashCache)
+	original, err := DuplicateOf(path, fileHashMap, hashCache, hash.SHA256)
+	return original != "", err
+}
+
+// DuplicateOf returns the path of the file fileHashMap holds with the same hash as the file at path,
+// or an empty path when there is none, in which case the file is added to fileHashMap itself.
+// Entries stored without a path are reported by their hash instead. The file is hashed with algo,
+// which must be the algorithm the hashes of fileHashMap were calculated with.
+func DuplicateOf(path string, fileHashMap hash.Map, hashCache hash.Map, algo hash.HashAlgorithm) (string, error) {
+	hashValue, err := hash.GetFileHashWithAlgorithm(path, hashCache, algo)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	hashStr := string(hashValue)
+	hashStr := hex.EncodeToString(hashValue)
 
-	_, exists := fileHashMap.Load(hashStr)
-	if exists {
-		return true, nil
+	original, exists := fileHashMap.LoadOrStore(hashStr, path)
+	if !exists {
+		return "", nil
 	}
 
-	fileHashMap.Store(hashStr, true)
+	if originalPath, ok := original.(string); ok {
+		return originalPath, nil
+	}
 
-	return false, nil
+	return hashStr, nil
 }
@@ -0,0 +1,53 @@
+package duplicate
+
+import (
+	"encoding/hex"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// Equality defines when two files are duplicates by reducing every file to a key, files with equal
+// keys being duplicates. Implementations other than ExactBytes can define duplicates by what they
+// show rather than the bytes they are stored as.
+type Equality interface {
+	// Key returns the key of the file at path. An empty key leaves the file out of every group.
+	Key(path string, hashCache hash.Map) (string, error)
+}
+
+// ExactBytes is the default Equality, files are duplicates when their contents hash the same.
+// It is the only Equality the Tiered and Quick strategies narrow down by bytes for, and ShortHashBytes shortens the hash of.
+type ExactBytes struct {
+	// Algorithm is the hash function contents are compared by, SHA-256 by default.
+	Algorithm hash.HashAlgorithm
+}
+
+// Key returns the hex encoded hash of the contents of the file, served from hashCache when possible.
+func (equality ExactBytes) Key(path string, hashCache hash.Map) (string, error) {
+	hashValue, err := hash.GetFileHashWithAlgorithm(path, hashCache, equality.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hashValue), nil
+}
+
+// SamePixels is the Equality of the Pixels strategy, images are duplicates when their decoded,
+// upright pixels are identical. Files that are not decodable images are left out.
+type SamePixels struct{}
+
+// Key returns the hex encoded pixel hash of the image, or an empty key when it is not an image.
+func (SamePixels) Key(path string, hashCache hash.Map) (string, error) {
+	return pixelHash(path)
+}
+
+// equality returns the Equality opts selects, ExactBytes unless Equality or the Pixels strategy is set.
+func (opts Options) equality() Equality {
+	if opts.Equality != nil {
+		return opts.Equality
+	}
+	if opts.Strategy == Pixels {
+		return SamePixels{}
+	}
+
+	return ExactBytes{Algorithm: opts.Algorithm}
+}
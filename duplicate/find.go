@@ -0,0 +1,319 @@
+package duplicate
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// Strategy selects how candidates are narrowed down before their full contents are hashed.
+type Strategy int
+
+const (
+	// FullHash groups files by size and hashes those sharing a size completely.
+	FullHash Strategy = iota
+	// Tiered groups files by size, then by a hash of their first 64KB, and only fully hashes files that still collide.
+	Tiered
+	// Pixels groups images by a hash of their decoded, upright pixels, so re-encodes with identical
+	// pixels match while any visible change does not. Files that are not decodable images are left out.
+	// It is the same as setting Equality to SamePixels.
+	Pixels
+	// Quick groups files by size, then by hash.QuickFingerprint of their first and last megabyte, and
+	// only fully hashes files that still collide, which saves reading most of large unique videos.
+	Quick
+)
+
+const tieredPrefixSize = 64 * 1024
+
+// Options configures FindDuplicates.
+type Options struct {
+	Strategy Strategy
+	// Equality defines which files are duplicates, ExactBytes when nil unless Strategy is Pixels.
+	Equality Equality
+	// Algorithm is the hash function of the default ExactBytes, SHA-256 by default.
+	Algorithm hash.HashAlgorithm
+	// MinWastedBytes leaves out groups whose reclaimable space is below this many bytes.
+	MinWastedBytes int64
+	// SampleRate is the fraction of files EstimateDuplicates hashes, values outside (0, 1) hash every file.
+	SampleRate float64
+	// SampleSeed selects which files are sampled, the same seed always picks the same files.
+	SampleSeed int64
+	// ShortHashBytes, when positive, identifies groups by the first this many bytes of their hash.
+	// Files are still grouped by their full hash, so truncation never merges different files, but two
+	// groups can share a short hash. It is ignored unless Equality is ExactBytes.
+	ShortHashBytes int
+}
+
+// DuplicateGroup is a set of files with identical content.
+type DuplicateGroup struct {
+	Hash string
+	// Size is the size of the files, or of the largest of them when they differ in size, as those of
+	// an Equality other than ExactBytes can.
+	Size int64
+	// TotalSize, when set, is the combined size of the files, for groups that may differ in size.
+	TotalSize int64
+	Paths     []string
+	// MimeType is the detected type of the files, taken from the first path when MixedTypes is set.
+	MimeType string
+	// MixedTypes flags groups whose files were detected as different types.
+	MixedTypes bool
+}
+
+// WastedBytes returns the space that would be reclaimed by keeping a single copy of the group, the
+// largest one when its files differ in size.
+func (group DuplicateGroup) WastedBytes() int64 {
+	if len(group.Paths) < 2 {
+		return 0
+	}
+
+	if group.TotalSize > 0 {
+		return group.TotalSize - group.Size
+	}
+
+	return group.Size * int64(len(group.Paths)-1)
+}
+
+// newDuplicateGroup returns the group of paths identified by key. Files that are not byte for byte
+// identical are sized one by one, so the group counts the space they actually take up.
+func newDuplicateGroup(key string, paths []string, sizes map[string]int64, exactBytes bool) DuplicateGroup {
+	group := DuplicateGroup{Hash: key, Size: sizes[paths[0]], Paths: paths}
+	if exactBytes {
+		return group
+	}
+
+	for _, path := range paths {
+		group.Size = max(group.Size, sizes[path])
+		group.TotalSize += sizes[path]
+	}
+
+	return group
+}
+
+// FindDuplicates returns the groups of files in paths that share the same content.
+func FindDuplicates(paths []string, opts Options, hashCache hash.Map) ([]DuplicateGroup, error) {
+	sizes, err := statSizes(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectGroups(paths, sizes, opts, hashCache)
+}
+
+// FindDuplicatesFunc calls fn with every duplicate group of the files in paths as soon as it is found,
+// so groups never have to be held in memory all at once. Groups are passed in no particular order
+// and the search stops at the first error fn returns.
+func FindDuplicatesFunc(paths []string, opts Options, hashCache hash.Map, fn func(group DuplicateGroup) error) error {
+	sizes, err := statSizes(paths)
+	if err != nil {
+		return err
+	}
+
+	return findDuplicates(paths, sizes, opts, hashCache, fn)
+}
+
+// FindDuplicatesInPrescan returns the duplicate groups among the files of a prescan, reusing its sizes.
+func FindDuplicatesInPrescan(prescan *hash.Prescan, opts Options, hashCache hash.Map) ([]DuplicateGroup, error) {
+	// Only identical files are of the same size, others are matched among all files.
+	if _, exactBytes := opts.equality().(ExactBytes); !exactBytes {
+		return collectGroups(prescan.Files, prescan.Sizes, opts, hashCache)
+	}
+
+	return collectGroups(prescan.SizeCandidates(), prescan.Sizes, opts, hashCache)
+}
+
+// statSizes returns the size of every path.
+func statSizes(paths []string) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file %s: %v", path, err)
+		}
+		sizes[path] = info.Size()
+	}
+
+	return sizes, nil
+}
+
+// collectGroups gathers all duplicate groups of paths, ordered by their first path.
+func collectGroups(paths []string, sizes map[string]int64, opts Options, hashCache hash.Map) ([]DuplicateGroup, error) {
+	var groups []DuplicateGroup
+	err := findDuplicates(paths, sizes, opts, hashCache, func(group DuplicateGroup) error {
+		groups = append(groups, group)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Paths[0] < groups[j].Paths[0] })
+
+	return groups, nil
+}
+
+// findDuplicates groups paths by content, using sizes for the size prefilter, and passes every group to fn.
+func findDuplicates(paths []string, sizes map[string]int64, opts Options, hashCache hash.Map, fn func(group DuplicateGroup) error) error {
+	equality := opts.equality()
+	// Narrowing down by size and bytes only holds when duplicates are byte for byte identical.
+	_, exactBytes := equality.(ExactBytes)
+
+	var narrow func(path string) ([]byte, error)
+	switch opts.Strategy {
+	case Tiered:
+		narrow = func(path string) ([]byte, error) { return hash.GetPrefixHash(path, tieredPrefixSize) }
+	case Quick:
+		narrow = hash.QuickFingerprint
+	}
+
+	// Identical files share their size, so a file of a unique size is never read, whatever the strategy.
+	candidates := [][]string{paths}
+	if exactBytes {
+		candidates = groupBySize(paths, sizes)
+	}
+	if narrow != nil && exactBytes {
+		var narrowed [][]string
+		for _, sizeGroup := range candidates {
+			prefixes, err := mapPaths(sizeGroup, func(path string) (string, error) {
+				prefixHash, err := narrow(path)
+				return string(prefixHash), err
+			})
+			if err != nil {
+				return err
+			}
+
+			narrowed = append(narrowed, groupByValue(sizeGroup, prefixes)...)
+		}
+		candidates = narrowed
+	}
+
+	for _, candidate := range candidates {
+		hashes, err := mapPaths(candidate, func(path string) (string, error) {
+			return equality.Key(path, hashCache)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, group := range groupByValue(candidate, hashes) {
+			// Files an Equality leaves out share the empty key without being alike.
+			if hashes[group[0]] == "" {
+				continue
+			}
+
+			duplicateGroup := newDuplicateGroup(hashes[group[0]], group, sizes, exactBytes)
+			if exactBytes && opts.ShortHashBytes > 0 {
+				hashValue, err := hex.DecodeString(duplicateGroup.Hash)
+				if err != nil {
+					return fmt.Errorf("invalid hash %s of %s: %v", duplicateGroup.Hash, group[0], err)
+				}
+				duplicateGroup.Hash = hash.ShortHash(hashValue, opts.ShortHashBytes)
+			}
+			if duplicateGroup.WastedBytes() < opts.MinWastedBytes {
+				continue
+			}
+
+			if err := annotateMimeType(&duplicateGroup); err != nil {
+				return err
+			}
+
+			if err := fn(duplicateGroup); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// pixelHash returns the hex encoded pixel hash of the image at path, or an empty string when it is not an image.
+func pixelHash(path string) (string, error) {
+	hashValue, err := hash.GetPixelHash(path)
+	if errors.Is(err, image.ErrFormat) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hashValue), nil
+}
+
+// groupBySize groups paths sharing the same file size, dropping groups with a single path.
+func groupBySize(paths []string, sizes map[string]int64) [][]string {
+	values := make(map[string]string, len(paths))
+	for _, path := range paths {
+		values[path] = strconv.FormatInt(sizes[path], 10)
+	}
+
+	return groupByValue(paths, values)
+}
+
+// groupByValue groups paths sharing the same value, dropping groups with a single path.
+func groupByValue(paths []string, values map[string]string) [][]string {
+	buckets := make(map[string][]string)
+	for _, path := range paths {
+		buckets[values[path]] = append(buckets[values[path]], path)
+	}
+
+	var groups [][]string
+	for _, bucket := range buckets {
+		if len(bucket) > 1 {
+			sort.Strings(bucket)
+			groups = append(groups, bucket)
+		}
+	}
+
+	return groups
+}
+
+// callRecovered calls fn for path, turning a panic into an error for that path.
+func callRecovered(path string, fn func(path string) (string, error)) (value string, err error) {
+	defer hash.RecoverPanic(path, &err)
+
+	return fn(path)
+}
+
+// mapPaths applies fn to every path concurrently and returns the results keyed by path.
+func mapPaths(paths []string, fn func(path string) (string, error)) (map[string]string, error) {
+	results := make(map[string]string, len(paths))
+	pathChan := make(chan string)
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathChan {
+				value, err := callRecovered(path, fn)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("failed to process %s: %v", path, err)
+				}
+				results[path] = value
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		pathChan <- path
+	}
+	close(pathChan)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return results, nil
+}
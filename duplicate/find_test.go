@@ -0,0 +1,206 @@
+package duplicate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// writeCorpus writes files that tell the Tiered stages apart: copies, files of the same size that
+// differ within or past the prefix, files sharing a prefix with different sizes, and empty files.
+func writeCorpus(t *testing.T, dir string) []string {
+	t.Helper()
+
+	random := rand.New(rand.NewSource(1))
+	content := func(size int) []byte {
+		data := make([]byte, size)
+		random.Read(data)
+		return data
+	}
+
+	base := content(tieredPrefixSize * 3)
+	pastPrefix := bytes.Clone(base)
+	pastPrefix[len(pastPrefix)-1] ^= 0xff
+	withinPrefix := bytes.Clone(base)
+	withinPrefix[10] ^= 0xff
+	small := content(1024)
+
+	files := map[string][]byte{
+		"base_a.bin":          base,
+		"base_b.bin":          base,
+		"base_c.bin":          base,
+		"past_prefix_a.bin":   pastPrefix,
+		"past_prefix_b.bin":   pastPrefix,
+		"within_prefix.bin":   withinPrefix,
+		"longer.bin":          append(bytes.Clone(base), 0),
+		"prefix_only.bin":     base[:tieredPrefixSize],
+		"small_a.bin":         small,
+		"small_b.bin":         small,
+		"small_other.bin":     content(1024),
+		"empty_a.bin":         nil,
+		"empty_b.bin":         nil,
+		"unique_large.bin":    content(tieredPrefixSize * 2),
+		"unique_at_size.bin":  content(tieredPrefixSize),
+		"nested/base_d.bin":   base,
+		"nested/small_c.bin":  small,
+		"nested/singular.bin": content(4096),
+	}
+
+	var paths []string
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// naiveGroups groups paths by their full SHA-256 hash, the result every strategy must agree with.
+func naiveGroups(t *testing.T, paths []string) map[string][]string {
+	t.Helper()
+
+	byHash := make(map[string][]string)
+	for _, path := range paths {
+		hashValue, err := hash.GetFileHashWithAlgorithm(path, &sync.Map{}, hash.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := hex.EncodeToString(hashValue)
+		byHash[key] = append(byHash[key], path)
+	}
+
+	groups := make(map[string][]string)
+	for key, group := range byHash {
+		if len(group) > 1 {
+			sort.Strings(group)
+			groups[key] = group
+		}
+	}
+
+	return groups
+}
+
+func TestFindDuplicatesStrategiesMatchFullHash(t *testing.T) {
+	paths := writeCorpus(t, t.TempDir())
+	want := naiveGroups(t, paths)
+
+	for _, strategy := range []Strategy{FullHash, Tiered, Quick} {
+		groups, err := FindDuplicates(paths, Options{Strategy: strategy}, &sync.Map{})
+		if err != nil {
+			t.Fatalf("strategy %v: %v", strategy, err)
+		}
+
+		got := make(map[string][]string)
+		for _, group := range groups {
+			sort.Strings(group.Paths)
+			got[group.Hash] = group.Paths
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("strategy %v found groups %v, full hashes group %v", strategy, got, want)
+		}
+	}
+}
+
+// writePNG writes img to path with the compression level, so the same pixels take up different sizes.
+func writePNG(t *testing.T, path string, img image.Image, level png.CompressionLevel) int64 {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: level}).Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return int64(buf.Len())
+}
+
+func TestFindDuplicatesSamePixelsWastedBytes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x ^ y), 255})
+		}
+	}
+
+	dir := t.TempDir()
+	var paths []string
+	var sizes []int64
+	for i, level := range []png.CompressionLevel{png.NoCompression, png.BestSpeed, png.BestCompression} {
+		path := filepath.Join(dir, string(rune('a'+i))+".png")
+		paths = append(paths, path)
+		sizes = append(sizes, writePNG(t, path, img, level))
+	}
+	if sizes[0] == sizes[1] || sizes[1] == sizes[2] {
+		t.Fatalf("compression levels wrote files of sizes %v, want them to differ", sizes)
+	}
+
+	groups, err := FindDuplicates(paths, Options{Equality: SamePixels{}}, &sync.Map{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Paths) != 3 {
+		t.Fatalf("found groups %v, want a single group of the three files", groups)
+	}
+
+	// Keeping the largest copy reclaims the space of the two others.
+	largest := max(sizes[0], sizes[1], sizes[2])
+	if want := sizes[0] + sizes[1] + sizes[2] - largest; groups[0].WastedBytes() != want {
+		t.Errorf("group wastes %d bytes, want %d", groups[0].WastedBytes(), want)
+	}
+
+	groups, err = FindDuplicates(paths, Options{Equality: SamePixels{}, MinWastedBytes: sizes[0] + sizes[1] + sizes[2]}, &sync.Map{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("found groups %v wasting less than MinWastedBytes", groups)
+	}
+}
+
+func TestFindDuplicatesFullHashSkipsUniqueSizes(t *testing.T) {
+	paths := writeCorpus(t, t.TempDir())
+	sizes, err := statSizes(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashCache := &sync.Map{}
+	if _, err := FindDuplicates(paths, Options{Strategy: FullHash}, hashCache); err != nil {
+		t.Fatal(err)
+	}
+
+	var sharedSize int
+	for _, group := range groupBySize(paths, sizes) {
+		sharedSize += len(group)
+	}
+
+	var hashed int
+	hashCache.Range(func(key, value any) bool {
+		hashed++
+		return true
+	})
+	if hashed != sharedSize {
+		t.Errorf("%d files hashed, want only the %d sharing their size with another", hashed, sharedSize)
+	}
+}
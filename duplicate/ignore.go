@@ -0,0 +1,57 @@
+package duplicate
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// LoadIgnoreHashes reads a file of hex encoded hashes, one per line, that should be ignored.
+// Empty lines and lines starting with # are skipped.
+func LoadIgnoreHashes(filePath string) (map[string]bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	ignoreHashes := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, err := hex.DecodeString(line); err != nil {
+			return nil, fmt.Errorf("invalid hash %q in ignore file %s", line, filePath)
+		}
+
+		ignoreHashes[strings.ToLower(line)] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file %s: %v", filePath, err)
+	}
+
+	return ignoreHashes, nil
+}
+
+// IsIgnored checks if the hash of the file, calculated with algo, is part of the ignored hashes.
+func IsIgnored(path string, ignoreHashes map[string]bool, hashCache hash.Map, algo hash.HashAlgorithm) (bool, error) {
+	if len(ignoreHashes) == 0 {
+		return false, nil
+	}
+
+	hashValue, err := hash.GetFileHashWithAlgorithm(path, hashCache, algo)
+	if err != nil {
+		return false, err
+	}
+
+	return ignoreHashes[hex.EncodeToString(hashValue)], nil
+}
@@ -0,0 +1,123 @@
+package duplicate
+
+import (
+	"fmt"
+	"image"
+	"os"
+)
+
+// KeepPolicy selects which file of a duplicate group is kept.
+type KeepPolicy int
+
+const (
+	// KeepFirstPath keeps the file whose path sorts first.
+	KeepFirstPath KeepPolicy = iota
+	// KeepOldest keeps the file with the oldest modification time.
+	KeepOldest
+	// KeepShortestPath keeps the file with the shortest path, usually the least nested one.
+	KeepShortestPath
+	// KeepLargestResolution keeps the image with the most pixels, ties are broken by file size.
+	// It is meant for the groups of FindVisualDuplicates, whose files differ in resolution.
+	KeepLargestResolution
+	// KeepLargest keeps the largest file. Identical files are of equal size, so it matters for
+	// groups of other equalities, such as images with the same pixels saved at different quality.
+	KeepLargest
+)
+
+// Keep returns the path of the group to keep and the paths of the redundant copies.
+// Ties are broken by path order, so the choice is stable between runs.
+func (policy KeepPolicy) Keep(group DuplicateGroup) (string, []string, error) {
+	if len(group.Paths) == 0 {
+		return "", nil, fmt.Errorf("duplicate group %s has no paths", group.Hash)
+	}
+
+	keepIndex := 0
+	switch policy {
+	case KeepFirstPath:
+		for i, path := range group.Paths {
+			if path < group.Paths[keepIndex] {
+				keepIndex = i
+			}
+		}
+	case KeepOldest:
+		var oldest os.FileInfo
+		for i, path := range group.Paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to stat file %s: %v", path, err)
+			}
+
+			if oldest == nil || info.ModTime().Before(oldest.ModTime()) ||
+				info.ModTime().Equal(oldest.ModTime()) && path < group.Paths[keepIndex] {
+				oldest = info
+				keepIndex = i
+			}
+		}
+	case KeepShortestPath:
+		for i, path := range group.Paths {
+			kept := group.Paths[keepIndex]
+			if len(path) < len(kept) || len(path) == len(kept) && path < kept {
+				keepIndex = i
+			}
+		}
+	case KeepLargestResolution:
+		var largestPixels, largestSize int64
+		for i, path := range group.Paths {
+			pixels, size, err := imageResolution(path)
+			if err != nil {
+				return "", nil, err
+			}
+
+			if i == 0 || pixels > largestPixels ||
+				pixels == largestPixels && (size > largestSize || size == largestSize && path < group.Paths[keepIndex]) {
+				largestPixels, largestSize = pixels, size
+				keepIndex = i
+			}
+		}
+	case KeepLargest:
+		var largest int64
+		for i, path := range group.Paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to stat file %s: %v", path, err)
+			}
+
+			if i == 0 || info.Size() > largest || info.Size() == largest && path < group.Paths[keepIndex] {
+				largest = info.Size()
+				keepIndex = i
+			}
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown keep policy %d", policy)
+	}
+
+	var remove []string
+	for i, path := range group.Paths {
+		if i != keepIndex {
+			remove = append(remove, path)
+		}
+	}
+
+	return group.Paths[keepIndex], remove, nil
+}
+
+// imageResolution returns the pixel count and the file size of the image at path.
+func imageResolution(path string) (int64, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read dimensions of image %s: %v", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat file %s: %v", path, err)
+	}
+
+	return int64(config.Width) * int64(config.Height), info.Size(), nil
+}
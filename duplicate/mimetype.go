@@ -0,0 +1,46 @@
+package duplicate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/mediatype"
+)
+
+// annotateMimeType detects the type of every file in the group and flags groups of mixed types.
+func annotateMimeType(group *DuplicateGroup) error {
+	group.MimeType = ""
+	group.MixedTypes = false
+
+	for _, path := range group.Paths {
+		mimeType, err := mediatype.Detect(path)
+		if err != nil {
+			return err
+		}
+
+		if group.MimeType == "" {
+			group.MimeType = mimeType
+		} else if mimeType != group.MimeType {
+			group.MixedTypes = true
+		}
+	}
+
+	return nil
+}
+
+// FilterByMimeType returns the groups whose type starts with prefix, such as "video/" or "image/jpeg".
+func FilterByMimeType(groups []DuplicateGroup, prefix string) []DuplicateGroup {
+	var filtered []DuplicateGroup
+	for _, group := range groups {
+		if strings.HasPrefix(group.MimeType, prefix) {
+			filtered = append(filtered, group)
+		}
+	}
+
+	return filtered
+}
+
+// SortByMimeType orders the groups by type, keeping the existing order within each type.
+func SortByMimeType(groups []DuplicateGroup) {
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].MimeType < groups[j].MimeType })
+}
@@ -0,0 +1,63 @@
+package duplicate
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// OriginalSelector picks the original of a duplicate group, the file reports mark as the
+// original and the one DeleteDuplicates and LinkDuplicates keep when given its Resolver.
+type OriginalSelector func(group DuplicateGroup) (string, error)
+
+// Original returns the policy as an OriginalSelector.
+func (policy KeepPolicy) Original() OriginalSelector {
+	return func(group DuplicateGroup) (string, error) {
+		keep, _, err := policy.Keep(group)
+		return keep, err
+	}
+}
+
+// Resolver returns a Resolver keeping the original selected and removing every other copy.
+func (selector OriginalSelector) Resolver() Resolver {
+	return func(group DuplicateGroup) (string, []string, error) {
+		original, err := selector(group)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var remove []string
+		for _, path := range group.Paths {
+			if path != original {
+				remove = append(remove, path)
+			}
+		}
+
+		return original, remove, nil
+	}
+}
+
+// PreferFolder selects the first file inside folder as the original, and falls back to fallback
+// for groups without a file there.
+func PreferFolder(folder string, fallback OriginalSelector) OriginalSelector {
+	return func(group DuplicateGroup) (string, error) {
+		absFolder, err := filepath.Abs(folder)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve path %s: %v", folder, err)
+		}
+
+		for _, path := range group.Paths {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve path %s: %v", path, err)
+			}
+
+			relPath, err := filepath.Rel(absFolder, absPath)
+			if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				return path, nil
+			}
+		}
+
+		return fallback(group)
+	}
+}
@@ -0,0 +1,189 @@
+package duplicate
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ReportFormat selects how a ReportWriter encodes duplicate groups.
+type ReportFormat int
+
+const (
+	// ReportJSON writes a JSON array with one object per group.
+	ReportJSON ReportFormat = iota
+	// ReportCSV writes one row per duplicate file, preceded by a header row.
+	ReportCSV
+)
+
+var reportCSVHeader = []string{"hash", "size", "wasted_bytes", "mime_type", "mixed_types", "path"}
+
+// reportGroup is a duplicate group as written to a JSON report.
+type reportGroup struct {
+	Hash        string   `json:"hash"`
+	Size        int64    `json:"size"`
+	WastedBytes int64    `json:"wasted_bytes"`
+	MimeType    string   `json:"mime_type,omitempty"`
+	MixedTypes  bool     `json:"mixed_types,omitempty"`
+	Original    string   `json:"original,omitempty"`
+	Paths       []string `json:"paths"`
+}
+
+// ReportWriter streams duplicate groups to a report one at a time, so memory use does not grow with the report.
+// The report is only complete once Close has been called.
+type ReportWriter struct {
+	buffered *bufio.Writer
+	format   ReportFormat
+	csv      *csv.Writer
+	groups   int
+	original OriginalSelector
+}
+
+// NewReportWriter creates a ReportWriter writing format to w.
+func NewReportWriter(w io.Writer, format ReportFormat) *ReportWriter {
+	writer := &ReportWriter{buffered: bufio.NewWriter(w), format: format}
+	if format == ReportCSV {
+		writer.csv = csv.NewWriter(writer.buffered)
+	}
+
+	return writer
+}
+
+// SetOriginal marks the original selector chose in every group written from now on, as an
+// "original" field in JSON and an "original" column in CSV. It must be called before the first Write.
+func (writer *ReportWriter) SetOriginal(selector OriginalSelector) {
+	writer.original = selector
+}
+
+// header returns the CSV header row.
+func (writer *ReportWriter) header() []string {
+	if writer.original != nil {
+		return append(append([]string(nil), reportCSVHeader...), "original")
+	}
+
+	return reportCSVHeader
+}
+
+// selectOriginal returns the original of group, or an empty string when no selector is set.
+func (writer *ReportWriter) selectOriginal(group DuplicateGroup) (string, error) {
+	if writer.original == nil {
+		return "", nil
+	}
+
+	original, err := writer.original(group)
+	if err != nil {
+		return "", fmt.Errorf("failed to select original of group %s: %v", group.Hash, err)
+	}
+
+	return original, nil
+}
+
+// Write appends a group to the report.
+func (writer *ReportWriter) Write(group DuplicateGroup) error {
+	defer func() { writer.groups++ }()
+
+	if writer.format == ReportCSV {
+		return writer.writeCSV(group)
+	}
+
+	return writer.writeJSON(group)
+}
+
+// Close finishes the report and flushes everything written so far.
+func (writer *ReportWriter) Close() error {
+	if writer.format == ReportCSV {
+		if writer.groups == 0 {
+			if err := writer.csv.Write(writer.header()); err != nil {
+				return fmt.Errorf("failed to write report: %v", err)
+			}
+		}
+
+		writer.csv.Flush()
+		if err := writer.csv.Error(); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+	} else {
+		closing := "\n]\n"
+		if writer.groups == 0 {
+			closing = "[]\n"
+		}
+
+		if _, err := writer.buffered.WriteString(closing); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+	}
+
+	if err := writer.buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to flush report: %v", err)
+	}
+
+	return nil
+}
+
+func (writer *ReportWriter) writeJSON(group DuplicateGroup) error {
+	original, err := writer.selectOriginal(group)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(reportGroup{
+		Hash:        group.Hash,
+		Size:        group.Size,
+		WastedBytes: group.WastedBytes(),
+		MimeType:    group.MimeType,
+		MixedTypes:  group.MixedTypes,
+		Original:    original,
+		Paths:       group.Paths,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode group %s: %v", group.Hash, err)
+	}
+
+	separator := ",\n"
+	if writer.groups == 0 {
+		separator = "[\n"
+	}
+
+	if _, err := writer.buffered.WriteString(separator); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+
+	if _, err := writer.buffered.Write(encoded); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+
+	return nil
+}
+
+func (writer *ReportWriter) writeCSV(group DuplicateGroup) error {
+	original, err := writer.selectOriginal(group)
+	if err != nil {
+		return err
+	}
+
+	if writer.groups == 0 {
+		if err := writer.csv.Write(writer.header()); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+	}
+
+	size := strconv.FormatInt(group.Size, 10)
+	wastedBytes := strconv.FormatInt(group.WastedBytes(), 10)
+	mixedTypes := strconv.FormatBool(group.MixedTypes)
+
+	for _, path := range group.Paths {
+		row := []string{group.Hash, size, wastedBytes, group.MimeType, mixedTypes, path}
+		if writer.original != nil {
+			row = append(row, strconv.FormatBool(path == original))
+		}
+
+		if err := writer.csv.Write(row); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+	}
+
+	return nil
+}
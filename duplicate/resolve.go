@@ -0,0 +1,156 @@
+package duplicate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/keybraker/mediarizer-2/trash"
+)
+
+// Resolver decides which file of a duplicate group is kept and which copies are removed.
+// Returning an error leaves every file of the group untouched.
+type Resolver func(group DuplicateGroup) (keep string, remove []string, err error)
+
+// Resolver returns the policy as a Resolver.
+func (policy KeepPolicy) Resolver() Resolver {
+	return policy.Keep
+}
+
+// GroupError is the failure to resolve a single duplicate group.
+type GroupError struct {
+	Group DuplicateGroup
+	Err   error
+}
+
+func (e *GroupError) Error() string {
+	return fmt.Sprintf("failed to resolve duplicate group %s: %v", e.Group.Hash, e.Err)
+}
+
+func (e *GroupError) Unwrap() error {
+	return e.Err
+}
+
+// Resolution is the outcome of DeleteDuplicates, LinkDuplicates or ResolveDuplicates.
+type Resolution struct {
+	// Kept lists the file kept of every resolved group.
+	Kept []string
+	// Removed lists the copies that were deleted, replaced by a link or otherwise removed.
+	Removed []string
+	// Failed lists the groups that were aborted, their files are left as they were
+	// unless the failure happened part way through removing copies.
+	Failed []*GroupError
+}
+
+// DeleteDuplicates deletes the copies resolve picks for removal from every group.
+func DeleteDuplicates(groups []DuplicateGroup, resolve Resolver) Resolution {
+	return resolveGroups(groups, resolve, func(keep, path string) error {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove duplicate %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// TrashDuplicates moves the copies resolve picks for removal from every group to the trash of the
+// user, from where they can be restored.
+func TrashDuplicates(groups []DuplicateGroup, resolve Resolver) Resolution {
+	return resolveGroups(groups, resolve, func(keep, path string) error {
+		if err := trash.Move(path); err != nil {
+			return fmt.Errorf("failed to trash duplicate %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// LinkDuplicates replaces the copies resolve picks for removal with hard links to the kept file,
+// so the space is reclaimed while every path keeps working. Files must be on the same filesystem.
+func LinkDuplicates(groups []DuplicateGroup, resolve Resolver) Resolution {
+	return resolveGroups(groups, resolve, ReplaceWithLink)
+}
+
+// ReplaceWithLink replaces the file at path with a hard link to keep. Both must be on the same filesystem.
+func ReplaceWithLink(keep, path string) error {
+	// Linking next to the copy and renaming over it never leaves the path missing.
+	tempPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".link")
+	if err := os.Link(keep, tempPath); err != nil {
+		return fmt.Errorf("failed to link %s to %s: %v", path, keep, err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace duplicate %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// ResolveDuplicates applies remove to the copies resolve picks for removal from every group,
+// for handling copies other than deleting or linking them. remove is given the kept file too.
+func ResolveDuplicates(groups []DuplicateGroup, resolve Resolver, remove func(keep, path string) error) Resolution {
+	return resolveGroups(groups, resolve, remove)
+}
+
+// resolveGroups asks resolve about every group and applies remove to the copies it picks.
+func resolveGroups(groups []DuplicateGroup, resolve Resolver, remove func(keep, path string) error) Resolution {
+	var resolution Resolution
+
+	for _, group := range groups {
+		keep, redundant, err := resolveGroup(group, resolve)
+		if err != nil {
+			resolution.Failed = append(resolution.Failed, &GroupError{Group: group, Err: err})
+			continue
+		}
+
+		if _, err := os.Stat(keep); err != nil {
+			resolution.Failed = append(resolution.Failed, &GroupError{Group: group, Err: fmt.Errorf("failed to stat kept file %s: %v", keep, err)})
+			continue
+		}
+
+		resolution.Kept = append(resolution.Kept, keep)
+		for _, path := range redundant {
+			if err := remove(keep, path); err != nil {
+				resolution.Failed = append(resolution.Failed, &GroupError{Group: group, Err: err})
+				break
+			}
+			resolution.Removed = append(resolution.Removed, path)
+		}
+	}
+
+	return resolution
+}
+
+// resolveGroup calls resolve for group and checks that its answer only names files of the group,
+// and never removes the file it keeps.
+func resolveGroup(group DuplicateGroup, resolve Resolver) (keep string, remove []string, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = fmt.Errorf("resolver panicked: %v", value)
+		}
+	}()
+
+	keep, remove, err = resolve(group)
+	if err != nil {
+		return "", nil, err
+	}
+
+	members := make(map[string]bool, len(group.Paths))
+	for _, path := range group.Paths {
+		members[path] = true
+	}
+
+	if !members[keep] {
+		return "", nil, fmt.Errorf("kept file %s is not part of the group", keep)
+	}
+
+	for _, path := range remove {
+		if !members[path] {
+			return "", nil, fmt.Errorf("removed file %s is not part of the group", path)
+		}
+		if path == keep {
+			return "", nil, fmt.Errorf("kept file %s is also marked for removal", keep)
+		}
+	}
+
+	return keep, remove, nil
+}
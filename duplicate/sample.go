@@ -0,0 +1,107 @@
+package duplicate
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// SampleEstimate holds the duplicates found in a sample of files and their extrapolation to all files.
+type SampleEstimate struct {
+	TotalFiles   int
+	SampledFiles int
+	// Groups are the duplicate groups found among the sampled files.
+	Groups []DuplicateGroup
+	// SampleDuplicateFiles is the number of redundant copies found in the sample.
+	SampleDuplicateFiles int
+	// SampleWastedBytes is the space the redundant copies of the sample take up.
+	SampleWastedBytes int64
+	// EstimatedDuplicateFiles is the expected number of redundant copies among all files.
+	EstimatedDuplicateFiles int64
+	// EstimatedWastedBytes is the expected space taken up by redundant copies among all files.
+	EstimatedWastedBytes int64
+	// EstimatedRatio is EstimatedDuplicateFiles as a fraction of TotalFiles.
+	EstimatedRatio float64
+}
+
+// EstimateDuplicates hashes a deterministic sample of opts.SampleRate of paths and extrapolates
+// how many of all paths are duplicates.
+//
+// A duplicate pair only shows up when both of its files are sampled, which happens with
+// probability SampleRate squared, so the estimate scales the sampled pairs by that factor.
+// Every pair is counted as one redundant copy, which is exact for pairs but overestimates
+// libraries with many copies of the same file. Small samples give noisy estimates, a sample
+// with a few dozen duplicate pairs is needed before the ratio means much.
+func EstimateDuplicates(paths []string, opts Options, hashCache hash.Map) (SampleEstimate, error) {
+	rate := opts.SampleRate
+	if rate <= 0 || rate >= 1 {
+		rate = 1
+	}
+
+	var sampled []string
+	for _, path := range paths {
+		if isSampled(path, opts.SampleSeed, rate) {
+			sampled = append(sampled, path)
+		}
+	}
+
+	sampleOpts := opts
+	sampleOpts.MinWastedBytes = 0
+
+	groups, err := FindDuplicates(sampled, sampleOpts, hashCache)
+	if err != nil {
+		return SampleEstimate{}, err
+	}
+
+	estimate := SampleEstimate{
+		TotalFiles:   len(paths),
+		SampledFiles: len(sampled),
+		Groups:       groups,
+	}
+
+	var samplePairs, samplePairBytes float64
+	for _, group := range groups {
+		copies := len(group.Paths)
+		estimate.SampleDuplicateFiles += copies - 1
+		estimate.SampleWastedBytes += group.WastedBytes()
+
+		pairs := float64(copies*(copies-1)) / 2
+		samplePairs += pairs
+		samplePairBytes += pairs * float64(group.Size)
+	}
+
+	if rate == 1 {
+		estimate.EstimatedDuplicateFiles = int64(estimate.SampleDuplicateFiles)
+		estimate.EstimatedWastedBytes = estimate.SampleWastedBytes
+	} else {
+		estimate.EstimatedDuplicateFiles = int64(math.Round(samplePairs / (rate * rate)))
+		estimate.EstimatedWastedBytes = int64(math.Round(samplePairBytes / (rate * rate)))
+	}
+
+	if estimate.EstimatedDuplicateFiles > int64(estimate.TotalFiles) {
+		estimate.EstimatedDuplicateFiles = int64(estimate.TotalFiles)
+	}
+
+	if estimate.TotalFiles > 0 {
+		estimate.EstimatedRatio = float64(estimate.EstimatedDuplicateFiles) / float64(estimate.TotalFiles)
+	}
+
+	return estimate, nil
+}
+
+// isSampled decides from the path and seed alone whether path is part of the sample.
+func isSampled(path string, seed int64, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	hasher := fnv.New64a()
+	var seedBytes [8]byte
+	binary.LittleEndian.PutUint64(seedBytes[:], uint64(seed))
+	hasher.Write(seedBytes[:])
+	hasher.Write([]byte(path))
+
+	return float64(hasher.Sum64()) < rate*math.MaxUint64
+}
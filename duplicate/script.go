@@ -0,0 +1,86 @@
+package duplicate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const cleanupScriptHeader = `#!/bin/sh
+# Duplicate cleanup script written by mediarizer.
+# Every command is commented out, review the groups and uncomment the lines to run.
+`
+
+// CleanupScriptWriter streams duplicate groups into a shell script that removes the redundant copies.
+// All commands are written commented out, so nothing is deleted until the user reviews the script.
+type CleanupScriptWriter struct {
+	buffered *bufio.Writer
+	policy   KeepPolicy
+	started  bool
+}
+
+// NewCleanupScriptWriter creates a CleanupScriptWriter writing to w, choosing the file to keep with policy.
+func NewCleanupScriptWriter(w io.Writer, policy KeepPolicy) *CleanupScriptWriter {
+	return &CleanupScriptWriter{buffered: bufio.NewWriter(w), policy: policy}
+}
+
+// Write appends the commands for a group to the script.
+func (writer *CleanupScriptWriter) Write(group DuplicateGroup) error {
+	if err := writer.writeHeader(); err != nil {
+		return err
+	}
+
+	keep, remove, err := writer.policy.Keep(group)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer.buffered, "\n# keep: %s\n", commentSafe(shellQuote(keep)))
+	for _, path := range remove {
+		// A newline would end the comment and leave the rest of the path as a live command.
+		if strings.ContainsAny(path, "\n\r") {
+			fmt.Fprintf(writer.buffered, "# skipped, path contains a line break: %s\n", commentSafe(fmt.Sprintf("%q", path)))
+			continue
+		}
+		fmt.Fprintf(writer.buffered, "# rm -- %s\n", shellQuote(path))
+	}
+
+	return nil
+}
+
+// Close finishes the script and flushes everything written so far.
+func (writer *CleanupScriptWriter) Close() error {
+	if err := writer.writeHeader(); err != nil {
+		return err
+	}
+
+	if err := writer.buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to flush cleanup script: %v", err)
+	}
+
+	return nil
+}
+
+func (writer *CleanupScriptWriter) writeHeader() error {
+	if writer.started {
+		return nil
+	}
+	writer.started = true
+
+	if _, err := writer.buffered.WriteString(cleanupScriptHeader); err != nil {
+		return fmt.Errorf("failed to write cleanup script: %v", err)
+	}
+
+	return nil
+}
+
+// shellQuote quotes value for a POSIX shell, so spaces and special characters are taken literally.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// commentSafe replaces line breaks so value stays within a single comment line.
+func commentSafe(value string) string {
+	return strings.NewReplacer("\n", "\\n", "\r", "\\r").Replace(value)
+}
@@ -0,0 +1,73 @@
+package duplicate
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+)
+
+// SnapshotPath returns where the duplicate group snapshot belonging to a cache file is stored.
+func SnapshotPath(cachePath string) string {
+	return cachePath + ".groups"
+}
+
+// SaveSnapshot writes the duplicate groups to filePath so the next run can report only new ones.
+func SaveSnapshot(filePath string, groups []DuplicateGroup) error {
+	return atomicfile.Write(filePath, func(w io.Writer) error {
+		if err := gob.NewEncoder(w).Encode(groups); err != nil {
+			return fmt.Errorf("failed to encode snapshot file %s: %v", filePath, err)
+		}
+		return nil
+	})
+}
+
+// LoadSnapshot reads the duplicate groups written by SaveSnapshot, a missing file results in no groups.
+func LoadSnapshot(filePath string) ([]DuplicateGroup, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	var groups []DuplicateGroup
+	if err := gob.NewDecoder(file).Decode(&groups); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot file %s: %v", filePath, err)
+	}
+
+	return groups, nil
+}
+
+// NewGroups returns the groups of current that did not exist in previous, or that gained paths since.
+func NewGroups(current, previous []DuplicateGroup) []DuplicateGroup {
+	previousPaths := make(map[string]map[string]bool, len(previous))
+	for _, group := range previous {
+		paths := make(map[string]bool, len(group.Paths))
+		for _, path := range group.Paths {
+			paths[path] = true
+		}
+		previousPaths[group.Hash] = paths
+	}
+
+	var added []DuplicateGroup
+	for _, group := range current {
+		paths, existed := previousPaths[group.Hash]
+		if !existed {
+			added = append(added, group)
+			continue
+		}
+
+		for _, path := range group.Paths {
+			if !paths[path] {
+				added = append(added, group)
+				break
+			}
+		}
+	}
+
+	return added
+}
@@ -0,0 +1,58 @@
+package duplicate
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// FindVisualDuplicates groups the images in paths whose perceptual hashes are within radius bits,
+// so resized or re-encoded copies of a photo end up together. The Hash of a group is the perceptual
+// hash of its first path and Size is the size of that file. Files that are not decodable images are left out.
+func FindVisualDuplicates(paths []string, radius int) ([]DuplicateGroup, error) {
+	values, err := mapPaths(paths, func(path string) (string, error) {
+		perceptualHash, err := hash.GetPerceptualHash(path)
+		if errors.Is(err, image.ErrFormat) {
+			return "", nil
+		}
+		return strconv.FormatUint(perceptualHash, 16), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]uint64, len(values))
+	shots := make([]burstShot, 0, len(values))
+	for path, value := range values {
+		if value == "" {
+			continue
+		}
+
+		perceptualHash, err := strconv.ParseUint(value, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse perceptual hash of %s: %v", path, err)
+		}
+		hashes[path] = perceptualHash
+		shots = append(shots, burstShot{path: path, hash: perceptualHash})
+	}
+
+	index := hash.BuildPerceptualIndex(hashes)
+
+	var groups []DuplicateGroup
+	for _, cluster := range clusterPerceptual(shots, hashes, index, radius) {
+		sizes, err := statSizes(cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, newDuplicateGroup(fmt.Sprintf("%016x", hashes[cluster[0]]), cluster, sizes, false))
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Paths[0] < groups[j].Paths[0] })
+
+	return groups, nil
+}
@@ -0,0 +1,152 @@
+package geo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// countriesJSON holds the borders of the countries of the world as a GeoJSON feature collection,
+// embedded so coordinates are reverse geocoded offline.
+//
+//go:embed countries.json
+var countriesJSON []byte
+
+// ring is a closed line of longitude and latitude pairs.
+type ring [][]float64
+
+// polygon is an outer ring followed by the rings of its holes.
+type polygon []ring
+
+// country is a country with the polygons its borders are made of and the box bounding them.
+type country struct {
+	name                                                 string
+	polygons                                             []polygon
+	minLongitude, minLatitude, maxLongitude, maxLatitude float64
+}
+
+var (
+	loadOnce  sync.Once
+	countries []country
+	loadErr   error
+)
+
+// Country returns the name of the country the point at latitude and longitude lies in, and false
+// when it lies in none, such as at sea.
+func Country(latitude, longitude float64) (string, bool, error) {
+	loadOnce.Do(func() { countries, loadErr = parseCountries(countriesJSON) })
+	if loadErr != nil {
+		return "", false, loadErr
+	}
+
+	for _, country := range countries {
+		if longitude < country.minLongitude || longitude > country.maxLongitude || latitude < country.minLatitude || latitude > country.maxLatitude {
+			continue
+		}
+
+		for _, polygon := range country.polygons {
+			if polygon.contains(longitude, latitude) {
+				return country.name, true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+// parseCountries reads the countries of a GeoJSON feature collection of Polygon and MultiPolygon borders.
+func parseCountries(data []byte) ([]country, error) {
+	var collection struct {
+		Features []struct {
+			Properties struct {
+				Name string `json:"name"`
+			} `json:"properties"`
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("failed to read country borders: %v", err)
+	}
+
+	parsed := make([]country, 0, len(collection.Features))
+	for _, feature := range collection.Features {
+		var polygons []polygon
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var single polygon
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &single); err != nil {
+				return nil, fmt.Errorf("failed to read borders of %s: %v", feature.Properties.Name, err)
+			}
+			polygons = []polygon{single}
+		case "MultiPolygon":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &polygons); err != nil {
+				return nil, fmt.Errorf("failed to read borders of %s: %v", feature.Properties.Name, err)
+			}
+		default:
+			continue
+		}
+
+		parsed = append(parsed, newCountry(feature.Properties.Name, polygons))
+	}
+
+	return parsed, nil
+}
+
+// newCountry creates a country of its name and polygons, computing the box bounding them.
+func newCountry(name string, polygons []polygon) country {
+	c := country{name: name, polygons: polygons, minLongitude: 180, minLatitude: 90, maxLongitude: -180, maxLatitude: -90}
+
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+
+		for _, point := range polygon[0] {
+			if len(point) < 2 {
+				continue
+			}
+			c.minLongitude = min(c.minLongitude, point[0])
+			c.maxLongitude = max(c.maxLongitude, point[0])
+			c.minLatitude = min(c.minLatitude, point[1])
+			c.maxLatitude = max(c.maxLatitude, point[1])
+		}
+	}
+
+	return c
+}
+
+// contains checks if the point lies inside the outer ring of the polygon and outside its holes.
+func (p polygon) contains(x, y float64) bool {
+	if len(p) == 0 || !p[0].contains(x, y) {
+		return false
+	}
+
+	for _, hole := range p[1:] {
+		if hole.contains(x, y) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contains checks if the point lies inside the ring, by counting the edges a ray from it crosses.
+func (r ring) contains(x, y float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		if len(r[i]) < 2 || len(r[j]) < 2 {
+			continue
+		}
+
+		xi, yi, xj, yj := r[i][0], r[i][1], r[j][0], r[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,111 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	stdhash "hash"
+	"io"
+	"os"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+)
+
+// HashAlgorithm selects the hash function used to fingerprint file contents.
+type HashAlgorithm int
+
+const (
+	SHA256 HashAlgorithm = iota
+	// SHA512_256 is SHA-512 truncated to 256 bits, usually faster than SHA-256 on 64-bit CPUs
+	// without SHA extensions. Its 32 byte output is the same size as SHA-256.
+	SHA512_256
+	// XXHash64 is the 64-bit xxHash, many times faster than SHA-256 as it is not cryptographic. It tells
+	// files apart as well for deduplication, but files crafted to collide with each other are not detected.
+	XXHash64
+	// BLAKE3 is a cryptographic hash several times faster than SHA-256, with a 32 byte output as well.
+	BLAKE3
+)
+
+// algorithms names every HashAlgorithm and constructs its hashers, a new algorithm only needs an entry.
+var algorithms = []struct {
+	name string
+	new  func() stdhash.Hash
+}{
+	SHA256:     {"sha256", sha256.New},
+	SHA512_256: {"sha512/256", sha512.New512_256},
+	XXHash64:   {"xxhash64", func() stdhash.Hash { return xxhash.New() }},
+	BLAKE3:     {"blake3", func() stdhash.Hash { return blake3.New(32, nil) }},
+}
+
+func (algo HashAlgorithm) String() string {
+	if algo < 0 || int(algo) >= len(algorithms) {
+		return fmt.Sprintf("HashAlgorithm(%d)", int(algo))
+	}
+
+	return algorithms[algo].name
+}
+
+// recordName returns the name of algo as written to hash records, empty for the default SHA-256.
+func (algo HashAlgorithm) recordName() string {
+	if algo == SHA256 {
+		return ""
+	}
+
+	return algo.String()
+}
+
+// ParseHashAlgorithm returns the algorithm named name, as in hash records, an empty name being SHA-256.
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	if name == "" {
+		return SHA256, nil
+	}
+
+	for algo, algorithm := range algorithms {
+		if algorithm.name == name {
+			return HashAlgorithm(algo), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unsupported hash algorithm %q", name)
+}
+
+// newHasher returns a fresh hasher for the given algorithm.
+func newHasher(algo HashAlgorithm) (stdhash.Hash, error) {
+	return newNamespacedHasher(algo, "")
+}
+
+// newNamespacedHasher returns a fresh hasher for algo, keyed as an HMAC with namespace when it is set.
+func newNamespacedHasher(algo HashAlgorithm, namespace string) (stdhash.Hash, error) {
+	if algo < 0 || int(algo) >= len(algorithms) {
+		return nil, fmt.Errorf("unsupported hash algorithm %v", algo)
+	}
+	constructor := algorithms[algo].new
+
+	if namespace == "" {
+		return constructor(), nil
+	}
+
+	return hmac.New(constructor, []byte(namespace)), nil
+}
+
+// HashOpenFile hashes an already opened file from its current offset using algo.
+// The file is not closed, that remains the responsibility of the caller.
+func HashOpenFile(f *os.File, algo HashAlgorithm) ([]byte, error) {
+	hasher, err := newHasher(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(hasher, f); err != nil {
+		return nil, fmt.Errorf("failed to calculate hash for file %s: %v", f.Name(), err)
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+// MultiHash calculates the hash of the file for every algorithm in algos while reading it only once.
+func MultiHash(filePath string, algos []HashAlgorithm) (map[HashAlgorithm][]byte, error) {
+	return calculateFileHashes(filePath, algos, Options{})
+}
@@ -0,0 +1,53 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// BenchmarkAlgorithm compares the throughput of every algorithm, SHA-512/256 meant to be faster than
+// SHA-256 on 64-bit CPUs without SHA extensions, on content in memory and on a file as scans read it.
+func BenchmarkAlgorithm(b *testing.B) {
+	for _, size := range []int{4 << 10, 8 << 20} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+
+		path := filepath.Join(b.TempDir(), "IMG_0001.jpg")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+
+		for algo := range algorithms {
+			algo := HashAlgorithm(algo)
+			// Slashes would nest the benchmark of sha512/256.
+			name := fmt.Sprintf("%s/%dKB", strings.ReplaceAll(algo.String(), "/", "_"), size>>10)
+
+			b.Run(name+"/memory", func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					hasher, err := newHasher(algo)
+					if err != nil {
+						b.Fatal(err)
+					}
+					hasher.Write(data)
+					hasher.Sum(nil)
+				}
+			})
+
+			b.Run(name+"/file", func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					if _, err := GetFileHashWithAlgorithm(path, &sync.Map{}, algo); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package hash
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/mediatype"
+)
+
+// archiveEntrySeparator joins the archive path and the entry name in the keys of archive entries.
+const archiveEntrySeparator = "!"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// HashReader calculates the SHA-256 hash of everything read from r.
+func HashReader(r io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// ArchiveEntryKey returns the key of the entry named entryName inside the archive at archivePath.
+func ArchiveEntryKey(archivePath, entryName string) string {
+	return archivePath + archiveEntrySeparator + entryName
+}
+
+// HashTarContents hashes every image and video inside the tar or gzip compressed tar at tarPath.
+// The hashes are keyed by ArchiveEntryKey, gzip compression is detected by extension or magic bytes.
+func HashTarContents(tarPath string) (map[string][]byte, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %s: %v", tarPath, err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+
+	var reader io.Reader = buffered
+	if isGzipArchive(tarPath, buffered) {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress archive %s: %v", tarPath, err)
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	}
+
+	hashes := make(map[string][]byte)
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read archive %s: %v", tarPath, err)
+		}
+
+		if header.Typeflag != tar.TypeReg || !mediatype.HasMediaExtension(header.Name) {
+			continue
+		}
+
+		hashValue, err := HashReader(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate hash for %s in archive %s: %v", header.Name, tarPath, err)
+		}
+
+		hashes[ArchiveEntryKey(tarPath, header.Name)] = hashValue
+	}
+
+	return hashes, nil
+}
+
+// isGzipArchive checks if the archive is gzip compressed by its extension or its leading bytes.
+func isGzipArchive(archivePath string, reader *bufio.Reader) bool {
+	lowerPath := strings.ToLower(archivePath)
+	if strings.HasSuffix(lowerPath, ".tar.gz") || strings.HasSuffix(lowerPath, ".tgz") {
+		return true
+	}
+
+	magic, err := reader.Peek(len(gzipMagic))
+	return err == nil && bytes.Equal(magic, gzipMagic)
+}
@@ -0,0 +1,194 @@
+package hash
+
+import (
+	"math/bits"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// PerceptualMatch is a single result of a perceptual index query.
+type PerceptualMatch struct {
+	Path     string
+	Hash     uint64
+	Distance int
+}
+
+type bkNode struct {
+	hash     uint64
+	paths    []string
+	children map[int]*bkNode
+}
+
+// PerceptualIndex is a BK-tree over 64-bit perceptual hashes, keyed by Hamming distance.
+type PerceptualIndex struct {
+	mu   sync.RWMutex
+	root *bkNode
+	size int
+}
+
+type perceptualEntry struct {
+	path string
+	hash uint64
+}
+
+// HammingDistance returns the number of differing bits between two perceptual hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// NewPerceptualIndex creates an empty perceptual index.
+func NewPerceptualIndex() *PerceptualIndex {
+	return &PerceptualIndex{}
+}
+
+// BuildPerceptualIndex builds a perceptual index from a path to hash map, constructing subtrees in parallel.
+func BuildPerceptualIndex(hashes map[string]uint64) *PerceptualIndex {
+	entries := make([]perceptualEntry, 0, len(hashes))
+	for path, hash := range hashes {
+		entries = append(entries, perceptualEntry{path: path, hash: hash})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+
+	semaphore := make(chan struct{}, runtime.NumCPU())
+
+	return &PerceptualIndex{
+		root: buildBKSubtree(entries, semaphore),
+		size: len(entries),
+	}
+}
+
+// buildBKSubtree builds the subtree for entries, handing child subtrees to other goroutines while workers are free.
+func buildBKSubtree(entries []perceptualEntry, semaphore chan struct{}) *bkNode {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	node := &bkNode{hash: entries[0].hash, paths: []string{entries[0].path}}
+
+	groups := make(map[int][]perceptualEntry)
+	for _, entry := range entries[1:] {
+		distance := HammingDistance(node.hash, entry.hash)
+		if distance == 0 {
+			node.paths = append(node.paths, entry.path)
+			continue
+		}
+		groups[distance] = append(groups[distance], entry)
+	}
+
+	if len(groups) == 0 {
+		return node
+	}
+
+	node.children = make(map[int]*bkNode, len(groups))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for distance, group := range groups {
+		select {
+		case semaphore <- struct{}{}:
+			wg.Add(1)
+			go func(distance int, group []perceptualEntry) {
+				defer wg.Done()
+				child := buildBKSubtree(group, semaphore)
+				<-semaphore
+
+				mu.Lock()
+				node.children[distance] = child
+				mu.Unlock()
+			}(distance, group)
+		default:
+			child := buildBKSubtree(group, semaphore)
+
+			mu.Lock()
+			node.children[distance] = child
+			mu.Unlock()
+		}
+	}
+
+	wg.Wait()
+
+	return node
+}
+
+// Len returns the number of paths stored in the index.
+func (index *PerceptualIndex) Len() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	return index.size
+}
+
+// Add inserts the perceptual hash of the file at path into the index.
+func (index *PerceptualIndex) Add(hash uint64, path string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	index.size++
+
+	if index.root == nil {
+		index.root = &bkNode{hash: hash, paths: []string{path}}
+		return
+	}
+
+	node := index.root
+	for {
+		distance := HammingDistance(node.hash, hash)
+		if distance == 0 {
+			node.paths = append(node.paths, path)
+			return
+		}
+
+		child, exists := node.children[distance]
+		if !exists {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[distance] = &bkNode{hash: hash, paths: []string{path}}
+			return
+		}
+
+		node = child
+	}
+}
+
+// Query returns every indexed path whose hash is within radius bits of hash, closest first.
+func (index *PerceptualIndex) Query(hash uint64, radius int) []PerceptualMatch {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	var matches []PerceptualMatch
+	if index.root == nil || radius < 0 {
+		return matches
+	}
+
+	stack := []*bkNode{index.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		distance := HammingDistance(node.hash, hash)
+		if distance <= radius {
+			for _, path := range node.paths {
+				matches = append(matches, PerceptualMatch{Path: path, Hash: node.hash, Distance: distance})
+			}
+		}
+
+		// By the triangle inequality only children within [distance-radius, distance+radius] can match.
+		for childDistance, child := range node.children {
+			if childDistance >= distance-radius && childDistance <= distance+radius {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Path < matches[j].Path
+	})
+
+	return matches
+}
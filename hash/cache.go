@@ -0,0 +1,200 @@
+package hash
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// cacheRecord is an entry of a cache file, written one at a time after the map of entries older
+// versions wrote, which is left empty so that caches can be saved without holding them in memory.
+type cacheRecord struct {
+	Path string
+	File CachedFile
+}
+
+// SaveCache writes the hash cache to filePath so that later runs can reuse it.
+func SaveCache(filePath string, hashCache Map) error {
+	return atomicfile.Write(filePath, func(w io.Writer) error {
+		encoder := gob.NewEncoder(w)
+		if err := encoder.Encode(map[string]CachedFile{}); err != nil {
+			return fmt.Errorf("failed to encode cache file %s: %v", filePath, err)
+		}
+
+		var err error
+		hashCache.Range(func(key, value any) bool {
+			err = encoder.Encode(cacheRecord{Path: key.(string), File: value.(CachedFile)})
+			return err == nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode cache file %s: %v", filePath, err)
+		}
+		return nil
+	})
+}
+
+// LoadCache reads a hash cache written by SaveCache, a missing file results in an empty cache.
+func LoadCache(filePath string) (*sync.Map, error) {
+	hashCache := &sync.Map{}
+	if err := LoadCacheInto(filePath, hashCache); err != nil {
+		return nil, err
+	}
+
+	return hashCache, nil
+}
+
+// LoadCacheInto reads a hash cache written by SaveCache into hashCache, a missing file adding nothing.
+// Entries are decoded one at a time, so a SpillMap bounds the memory loading a large cache takes.
+func LoadCacheInto(filePath string, hashCache Map) error {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open cache file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(file)
+
+	var entries map[string]CachedFile
+	if err := decoder.Decode(&entries); err != nil {
+		return fmt.Errorf("failed to decode cache file %s: %v", filePath, err)
+	}
+	for path, cachedFile := range entries {
+		hashCache.Store(path, cachedFile)
+	}
+
+	for {
+		var record cacheRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode cache file %s: %v", filePath, err)
+		}
+		hashCache.Store(record.Path, record.File)
+	}
+}
+
+// FlushCache saves the hash cache on a best-effort basis, giving up once timeout has passed.
+func FlushCache(filePath string, hashCache Map, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- SaveCache(filePath, hashCache)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %v flushing cache file %s", timeout, filePath)
+	}
+}
+
+// UpdateCache re-hashes the files under root that are new or changed since they were cached and
+// drops the entries of files under root that no longer exist. It returns the changed paths as walked
+// and the removed paths as cache keys, which are absolute.
+func UpdateCache(root string, hashCache Map, opts Options) ([]string, []string, error) {
+	opts = opts.withPreset()
+	seen := make(map[string]bool)
+	var changed []string
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve path %s: %v", root, err)
+	}
+
+	err = walkCandidates(root, opts, func(filePath string, info os.FileInfo) error {
+		seen[cacheKey(filePath)] = true
+
+		if cached, found := hashCache.Load(cacheKey(filePath)); found {
+			cachedFile := cached.(CachedFile)
+			if cachedFile.Size == info.Size() && cachedFile.ModTime.Equal(info.ModTime()) {
+				return nil
+			}
+		}
+
+		changed = append(changed, filePath)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := rehashFiles(changed, hashCache, opts); err != nil {
+		return nil, nil, err
+	}
+
+	var removed []string
+	hashCache.Range(func(key, value any) bool {
+		filePath := key.(string)
+		if !seen[filePath] && pathsafe.Within(absRoot, filePath) {
+			removed = append(removed, filePath)
+		}
+		return true
+	})
+
+	for _, filePath := range removed {
+		hashCache.Delete(filePath)
+	}
+
+	sort.Strings(changed)
+	sort.Strings(removed)
+
+	return changed, removed, nil
+}
+
+// rehashFiles hashes the given files concurrently, refreshing their cache entries.
+func rehashFiles(filePaths []string, hashCache Map, opts Options) error {
+	fileChan := make(chan string, opts.queueSize())
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	ctx := opts.context()
+
+	for i := 0; i < opts.workerCount(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range fileChan {
+				// A cancelled update leaves the remaining files as they were cached.
+				if opts.opsLimiter != nil {
+					if err := opts.opsLimiter.take(ctx); err != nil {
+						errMu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						errMu.Unlock()
+						continue
+					}
+				}
+
+				_, err := hashScannedFile(filePath, hashCache, opts)
+				if err != nil && !errors.Is(err, ErrFileChanged) && !errors.Is(err, fs.ErrNotExist) {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("failed to get file hash for %s: %v", filePath, err)
+					}
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, filePath := range filePaths {
+		fileChan <- filePath
+	}
+	close(fileChan)
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,114 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// CacheProblem is the kind of problem ValidateCache found with a cache entry.
+type CacheProblem int
+
+const (
+	// CacheBadEntry is an entry whose key or value is not of the cache types.
+	CacheBadEntry CacheProblem = iota
+	// CacheMissingFile is an entry for a file that no longer exists.
+	CacheMissingFile
+	// CacheBadHash is an entry whose hash does not have the length of its algorithm.
+	CacheBadHash
+)
+
+func (problem CacheProblem) String() string {
+	switch problem {
+	case CacheBadEntry:
+		return "bad entry"
+	case CacheMissingFile:
+		return "missing file"
+	case CacheBadHash:
+		return "bad hash"
+	default:
+		return fmt.Sprintf("CacheProblem(%d)", int(problem))
+	}
+}
+
+// CacheIssue is a single problem found in a hash cache.
+type CacheIssue struct {
+	Path    string
+	Problem CacheProblem
+	Detail  string
+}
+
+func (issue CacheIssue) String() string {
+	return fmt.Sprintf("%s: %v, %s", issue.Path, issue.Problem, issue.Detail)
+}
+
+// ValidateCache checks every entry of a hash cache, as loaded by LoadCache, and returns the issues
+// found sorted by path. With prune set the invalid entries are removed from the cache. Entries of
+// files changed since they were cached are not issues, GetFileHash already recalculates them.
+func ValidateCache(hashCache Map, prune bool) ([]CacheIssue, error) {
+	var issues []CacheIssue
+	var invalid []any
+	var firstErr error
+
+	hashCache.Range(func(key, value any) bool {
+		filePath, ok := key.(string)
+		if !ok {
+			issues = append(issues, CacheIssue{Path: fmt.Sprint(key), Problem: CacheBadEntry, Detail: fmt.Sprintf("key of type %T", key)})
+			invalid = append(invalid, key)
+			return true
+		}
+
+		cachedFile, ok := value.(CachedFile)
+		if !ok {
+			issues = append(issues, CacheIssue{Path: filePath, Problem: CacheBadEntry, Detail: fmt.Sprintf("value of type %T", value)})
+			invalid = append(invalid, key)
+			return true
+		}
+
+		hasher, err := newHasher(cachedFile.Algorithm)
+		if err != nil {
+			issues = append(issues, CacheIssue{Path: filePath, Problem: CacheBadHash, Detail: err.Error()})
+			invalid = append(invalid, key)
+			return true
+		}
+
+		if len(cachedFile.Hash) != hasher.Size() {
+			issues = append(issues, CacheIssue{
+				Path:    filePath,
+				Problem: CacheBadHash,
+				Detail:  fmt.Sprintf("%d byte %v hash, expected %d bytes", len(cachedFile.Hash), cachedFile.Algorithm, hasher.Size()),
+			})
+			invalid = append(invalid, key)
+			return true
+		}
+
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			issues = append(issues, CacheIssue{Path: filePath, Problem: CacheMissingFile, Detail: "file does not exist"})
+			invalid = append(invalid, key)
+		} else if err != nil {
+			firstErr = fmt.Errorf("failed to stat file %s: %v", filePath, err)
+			return false
+		}
+
+		return true
+	})
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if prune {
+		for _, key := range invalid {
+			hashCache.Delete(key)
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Path != issues[j].Path {
+			return issues[i].Path < issues[j].Path
+		}
+		return issues[i].Problem < issues[j].Problem
+	})
+
+	return issues, nil
+}
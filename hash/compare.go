@@ -0,0 +1,116 @@
+package hash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Are reports whether the files at aPath and bPath have identical content.
+// Files of different sizes are told apart without reading them.
+func Are(aPath, bPath string) (bool, error) {
+	aInfo, err := os.Stat(aPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file %s: %v", aPath, err)
+	}
+
+	bInfo, err := os.Stat(bPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file %s: %v", bPath, err)
+	}
+
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	if os.SameFile(aInfo, bInfo) {
+		return true, nil
+	}
+
+	aHash, err := calculateFileHash(aPath, Options{})
+	if err != nil {
+		return false, err
+	}
+
+	bHash, err := calculateFileHash(bPath, Options{})
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(aHash, bHash), nil
+}
+
+// CompareSets returns, for every file in aPaths, the files in bPaths with identical content.
+// Files without a match are left out, only files sharing a size with the other set are hashed.
+func CompareSets(aPaths, bPaths []string) (map[string][]string, error) {
+	aSizes, err := statSizes(aPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	bSizes, err := statSizes(bPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	bSizeSet := make(map[int64]bool, len(bSizes))
+	for _, size := range bSizes {
+		bSizeSet[size] = true
+	}
+
+	aSizeSet := make(map[int64]bool, len(aSizes))
+	for _, size := range aSizes {
+		aSizeSet[size] = true
+	}
+
+	bByHash := make(map[string][]string)
+	for _, bPath := range bPaths {
+		if !aSizeSet[bSizes[bPath]] {
+			continue
+		}
+
+		hashValue, err := calculateFileHash(bPath, Options{})
+		if err != nil {
+			return nil, err
+		}
+
+		hashStr := hex.EncodeToString(hashValue)
+		bByHash[hashStr] = append(bByHash[hashStr], bPath)
+	}
+
+	matches := make(map[string][]string)
+	for _, aPath := range aPaths {
+		if !bSizeSet[aSizes[aPath]] {
+			continue
+		}
+
+		hashValue, err := calculateFileHash(aPath, Options{})
+		if err != nil {
+			return nil, err
+		}
+
+		if bMatches := bByHash[hex.EncodeToString(hashValue)]; len(bMatches) > 0 {
+			sorted := append([]string(nil), bMatches...)
+			sort.Strings(sorted)
+			matches[aPath] = sorted
+		}
+	}
+
+	return matches, nil
+}
+
+// statSizes returns the size of every path.
+func statSizes(paths []string) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file %s: %v", path, err)
+		}
+		sizes[path] = info.Size()
+	}
+
+	return sizes, nil
+}
@@ -0,0 +1,73 @@
+package hash
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+var errSampleComplete = errors.New("sample complete")
+
+// EstimateScan walks root applying the same filters as HashImagesInPath, without hashing anything,
+// and returns the number of files and bytes a scan would hash. Unlike PrescanPath it does not hold
+// the files in memory, and directories below root that can not be read are left out of the counts.
+func EstimateScan(root string, opts Options) (fileCount, totalBytes int64, err error) {
+	opts.onWalkError = func(*FileError) {}
+
+	err = walkCandidates(root, opts, func(filePath string, info os.FileInfo) error {
+		fileCount++
+		totalBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return fileCount, totalBytes, nil
+}
+
+// MeasureHashRate hashes up to sampleFiles files under root and returns the observed throughput in bytes per second.
+// A rate of zero means there was nothing to sample.
+func MeasureHashRate(root string, opts Options, sampleFiles int) (float64, error) {
+	var samples []string
+	err := walkCandidates(root, opts, func(filePath string, info os.FileInfo) error {
+		if len(samples) >= sampleFiles {
+			return errSampleComplete
+		}
+		samples = append(samples, filePath)
+		return nil
+	})
+	if err != nil && err != errSampleComplete {
+		return 0, err
+	}
+
+	var hashedBytes int64
+	start := time.Now()
+	for _, filePath := range samples {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+
+		if _, err := calculateFileHash(filePath, opts); err != nil {
+			continue
+		}
+		hashedBytes += info.Size()
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if hashedBytes == 0 || elapsed == 0 {
+		return 0, nil
+	}
+
+	return float64(hashedBytes) / elapsed, nil
+}
+
+// EstimateDuration predicts how long hashing totalBytes takes at bytesPerSecond.
+func EstimateDuration(totalBytes int64, bytesPerSecond float64) time.Duration {
+	if bytesPerSecond <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(totalBytes) / bytesPerSecond * float64(time.Second))
+}
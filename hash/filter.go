@@ -0,0 +1,60 @@
+package hash
+
+import (
+	"image"
+	"os"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/mediatype"
+)
+
+// meetsMinDimensions checks if the image at filePath is at least as large as the minimum dimensions of opts.
+// Files whose header can not be decoded pass, so they are handled like any other file.
+func meetsMinDimensions(filePath string, opts Options) bool {
+	if opts.MinWidth <= 0 && opts.MinHeight <= 0 {
+		return true
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return true
+	}
+
+	return config.Width >= opts.MinWidth && config.Height >= opts.MinHeight
+}
+
+// hasAllowedMimeType checks if the sniffed type of the file is one of the allowed types of opts.
+func hasAllowedMimeType(filePath string, opts Options) (bool, error) {
+	if len(opts.AllowedMimeTypes) == 0 {
+		return true, nil
+	}
+
+	mimeType, err := mediatype.Sniff(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, allowedMimeType := range opts.AllowedMimeTypes {
+		if strings.EqualFold(mimeType, allowedMimeType) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// fileSize returns the size of the file at filePath.
+func fileSize(filePath string) (int64, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
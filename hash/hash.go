@@ -1,14 +1,18 @@
 package hash
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	stdhash "hash"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +20,231 @@ import (
 	"golang.org/x/exp/mmap"
 )
 
+// ErrFileChanged is returned when a file was modified while it was being hashed.
+var ErrFileChanged = errors.New("file changed while hashing")
+
+// FileError is the failure to read or hash a single file or directory of a scan.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+var errScanStopped = errors.New("scan stopped")
+
+// cacheHits and cacheMisses count the hash cache lookups of every GetFileHash call in the process.
+var cacheHits, cacheMisses int64
+
+// CacheStats returns how many hash lookups were served from the cache and how many had to hash the file.
+func CacheStats() (int64, int64) {
+	return atomic.LoadInt64(&cacheHits), atomic.LoadInt64(&cacheMisses)
+}
+
+// Result holds the details of a scan that are not part of the hash map.
+type Result struct {
+	// Unstable lists files that changed while being hashed and were left out of the hash map.
+	Unstable []string
+	// TimedOut lists files whose reads stalled past the read timeout and were left out of the hash map.
+	TimedOut []string
+	// Panicked lists files whose processing panicked and were left out of the hash map.
+	Panicked []*PanicError
+	// Undersized lists images below the minimum dimensions that were left out of the hash map.
+	Undersized []string
+	// Vanished lists files deleted between being found by the walk and being hashed.
+	Vanished []string
+	// Failed lists the files and directories that could not be read, unless Options.FailFast
+	// made the first of them abort the scan.
+	Failed []*FileError
+	// CacheHits and CacheMisses count the files served from the hash cache and the files that had to be hashed.
+	CacheHits   int64
+	CacheMisses int64
+	// Timings holds the hash duration percentiles when Options.RecordTimings is set.
+	Timings *Timings
+}
+
+// Options configures HashImagesInPath.
+type Options struct {
+	// JSONL, when set, receives a record for every hashed file.
+	JSONL *JSONLWriter
+	// SymlinkFiles selects how symlinked files are treated, they are skipped by default.
+	SymlinkFiles SymlinkMode
+	// Prescan, when set, provides the files to hash so the path is not walked again.
+	Prescan *Prescan
+	// HashMap, when set, is filled and returned by HashImagesInPath in place of a new *sync.Map,
+	// such as a SpillMap for paths holding more files than fit in memory.
+	HashMap Map
+	// ReadTimeout, when positive, abandons a file whose reads make no progress for this long.
+	ReadTimeout time.Duration
+	// Retry retries hashing a file whose reads fail with transient errors, such as those of a
+	// network share dropping out for a moment.
+	Retry RetryPolicy
+	// Stats, when set, is updated with live counters while hashing.
+	Stats *Stats
+	// MaxConcurrency caps the number of hashing workers, zero uses four per CPU. Setting it to 1
+	// hashes files one at a time in sorted path order, so the hash map, JSONL records and stats
+	// are filled in a reproducible sequence. It is meant for tests and slows down real scans.
+	MaxConcurrency int
+	// MaxOpenFiles, when positive, lowers the number of workers so that no more files than this
+	// are open at once, every worker reading a single file.
+	MaxOpenFiles int
+	// MinWidth and MinHeight, when positive, leave out images smaller than this many pixels.
+	// Only the image header is decoded, files whose header can not be decoded are hashed as usual.
+	MinWidth  int
+	MinHeight int
+	// ExcludePaths lists directories that are not walked, matched by absolute path prefix.
+	ExcludePaths []string
+	// AllowedMimeTypes, when set, replaces the extension filter: every file is considered and only
+	// those whose first 512 bytes sniff as one of these types are hashed.
+	AllowedMimeTypes []string
+	// MaxDepth, when positive, limits the walk to files at most this many levels below the root,
+	// so 1 only scans the files directly inside the root.
+	MaxDepth int
+	// BytesPerSecond, when positive, caps the combined read rate of all workers.
+	BytesPerSecond int64
+	// Limiter, when set, paces the reads in place of BytesPerSecond, so the rate can be shared
+	// with reads outside the scan.
+	Limiter *RateLimiter
+	// OpsPerSecond, when positive, caps how many files all workers start per second combined,
+	// for storage that charges or rate limits per operation rather than per byte.
+	OpsPerSecond float64
+	// ReadBufferSize, when positive, is the size of the chunks files are read in, 32KB by default.
+	ReadBufferSize int
+	// QueueSize is the number of walked files that may wait for a free worker, by default none do.
+	QueueSize int
+	// Preset fills in the options left unset for a common scenario.
+	Preset Preset
+	// PathStyle selects the form of the paths in the results, JSONL records and indexes.
+	// Hash cache keys are always absolute whatever the style.
+	PathStyle PathStyle
+	// Algorithm is the hash function files are fingerprinted with, SHA-256 by default.
+	// Cached hashes of another algorithm are recalculated.
+	Algorithm HashAlgorithm
+	// Namespace, when set, keys every hash as an HMAC with it, so identical content yields hashes
+	// that never match a plain hash or one of another namespace. This breaks comparing hashes with
+	// other tools by design. Cached hashes of another namespace are recalculated.
+	Namespace string
+	// RecordTimings times the hashing of every file into Result.Timings.
+	RecordTimings bool
+	// SlowestFiles is the number of slowest files listed in Result.Timings.
+	SlowestFiles int
+	// OnProgress, when set, is called from the workers with the size of every file added to the hash map.
+	OnProgress func(filePath string, size int64)
+	// FailFast aborts the scan on the first file or directory that can not be read. By default
+	// they are listed in Result.Failed and the scan carries on with the rest.
+	FailFast bool
+	// Context, when set, stops the walk, the workers and the file being read once it is cancelled,
+	// and the scan then fails with its error.
+	Context context.Context
+
+	// onHashed, when set, is called from the workers for every file added to the hash map.
+	onHashed func(filePath, hashStr string)
+	// onWalkError, when set and FailFast is not, is called for every path below the root the walk
+	// fails to read, which is then skipped instead of ending the walk.
+	onWalkError func(walkErr *FileError)
+	// limiter enforces BytesPerSecond across every file of a scan.
+	limiter *RateLimiter
+	// opsLimiter enforces OpsPerSecond across every file of a scan.
+	opsLimiter *tokenBucket
+	// timings collects the hash durations when RecordTimings is set.
+	timings *timingRecorder
+}
+
+// PathStyle selects how the paths of scanned files are reported.
+type PathStyle int
+
+const (
+	// PathsAsWalked reports paths as the walk found them, joined to the root as it was given.
+	PathsAsWalked PathStyle = iota
+	// PathsAbsolute reports clean absolute paths.
+	PathsAbsolute
+	// PathsRelative reports paths relative to the root they were found under. Such paths are
+	// ambiguous across roots, and JSONL records written with them only seed a hash cache when
+	// read from within their root.
+	PathsRelative
+)
+
+// scannedFile is a file handed to the hashing workers with the root it was found under.
+type scannedFile struct {
+	root string
+	path string
+}
+
+// outputPath returns filePath, found under root, in the form PathStyle selects.
+func (opts Options) outputPath(root, filePath string) string {
+	switch opts.PathStyle {
+	case PathsAbsolute:
+		return cacheKey(filePath)
+	case PathsRelative:
+		if relPath, err := filepath.Rel(cacheKey(root), cacheKey(filePath)); err == nil {
+			return relPath
+		}
+	}
+
+	return filePath
+}
+
+// context returns Context, or a context that is never cancelled when it is not set.
+func (opts Options) context() context.Context {
+	if opts.Context != nil {
+		return opts.Context
+	}
+
+	return context.Background()
+}
+
+// queueSize returns the capacity of the channel feeding walked files to the workers.
+func (opts Options) queueSize() int {
+	if opts.QueueSize > 0 {
+		return opts.QueueSize
+	}
+
+	return 0
+}
+
+// workerCount returns the number of hashing workers opts allows.
+func (opts Options) workerCount() int {
+	workers := runtime.NumCPU() * 4
+	if opts.MaxConcurrency > 0 {
+		workers = opts.MaxConcurrency
+	}
+
+	if opts.MaxOpenFiles > 0 && workers > opts.MaxOpenFiles {
+		return opts.MaxOpenFiles
+	}
+
+	return workers
+}
+
+// Stats holds the live counters of a running scan. Fields are updated atomically
+// and should be read with atomic.LoadInt64 or Snapshot while the scan runs.
+type Stats struct {
+	FilesTotal  int64
+	FilesHashed int64
+	BytesTotal  int64
+	BytesHashed int64
+	CacheHits   int64
+	CacheMisses int64
+}
+
+// Snapshot returns a consistent enough copy of the counters for display.
+func (stats *Stats) Snapshot() Stats {
+	return Stats{
+		FilesTotal:  atomic.LoadInt64(&stats.FilesTotal),
+		FilesHashed: atomic.LoadInt64(&stats.FilesHashed),
+		BytesTotal:  atomic.LoadInt64(&stats.BytesTotal),
+		BytesHashed: atomic.LoadInt64(&stats.BytesHashed),
+		CacheHits:   atomic.LoadInt64(&stats.CacheHits),
+		CacheMisses: atomic.LoadInt64(&stats.CacheMisses),
+	}
+}
+
 type FileMeta struct {
 	Size    int64
 	ModTime time.Time
@@ -24,6 +253,10 @@ type FileMeta struct {
 type CachedFile struct {
 	FileMeta
 	Hash []byte
+	// Algorithm is the algorithm Hash was calculated with, caches written before it existed hold SHA-256.
+	Algorithm HashAlgorithm
+	// Namespace is the namespace Hash was keyed with, empty for a plain hash.
+	Namespace string
 }
 
 type readerAtWrapper struct {
@@ -41,119 +274,391 @@ func (r *readerAtWrapper) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
-// isImageFile checks if the file is an image based on its extension.
-func isImageFile(filePath string) bool {
-	lowerFilePath := strings.ToLower(filePath)
-	return strings.HasSuffix(lowerFilePath, ".jpg") || strings.HasSuffix(lowerFilePath, ".jpeg") ||
-		strings.HasSuffix(lowerFilePath, ".png") || strings.HasSuffix(lowerFilePath, ".gif") ||
-		strings.HasSuffix(lowerFilePath, ".bmp") || strings.HasSuffix(lowerFilePath, ".tiff")
+// calculateFileHash calculates the hash of the file at the given filePath with the algorithm of opts.
+func calculateFileHash(filePath string, opts Options) ([]byte, error) {
+	hashes, err := calculateFileHashes(filePath, []HashAlgorithm{opts.Algorithm}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes[opts.Algorithm], nil
+}
+
+// calculateFileHashes calculates the hashes of the file for every algorithm in a single read.
+func calculateFileHashes(filePath string, algos []HashAlgorithm, opts Options) (map[HashAlgorithm][]byte, error) {
+	opts = opts.withPreset()
+
+	if opts.timings != nil {
+		defer opts.timings.record(filePath, time.Now())
+	}
+
+	var hashes map[HashAlgorithm][]byte
+	err := opts.Retry.Do(opts.context(), func() error {
+		var err error
+		if opts.ReadTimeout > 0 {
+			hashes, err = calculateFileHashesWatched(filePath, algos, opts)
+		} else {
+			hashes, err = readFileHashes(opts.context(), filePath, algos, nil, opts)
+		}
+		return err
+	})
+
+	return hashes, err
 }
 
-// calculateFileHash calculates the SHA-256 hash of the file at the given filePath.
-func calculateFileHash(filePath string) ([]byte, error) {
+// readFileHashes hashes the file, stopping once ctx is cancelled and signalling progress after every read.
+func readFileHashes(ctx context.Context, filePath string, algos []HashAlgorithm, progress chan<- struct{}, opts Options) (map[HashAlgorithm][]byte, error) {
+	hashers := make(map[HashAlgorithm]stdhash.Hash, len(algos))
+	writers := make([]io.Writer, 0, len(algos))
+	for _, algo := range algos {
+		if _, exists := hashers[algo]; exists {
+			continue
+		}
+
+		hasher, err := newNamespacedHasher(algo, opts.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		hashers[algo] = hasher
+		writers = append(writers, hasher)
+	}
+
 	readerAt, err := mmap.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to memory-map file %s: %v", filePath, err)
+		return nil, fmt.Errorf("failed to memory-map file %s: %w", filePath, err)
 	}
 	defer readerAt.Close()
 
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat file %s: %v", filePath, err)
+		return nil, fmt.Errorf("failed to stat file %s: %w", filePath, err)
 	}
 	fileSize := fileInfo.Size()
 
-	reader := &readerAtWrapper{
+	var reader io.Reader = &readerAtWrapper{
 		readerAt: readerAt,
 		offset:   0,
 		size:     fileSize,
 	}
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, reader); err != nil {
-		return nil, fmt.Errorf("failed to calculate hash for file %s: %v", filePath, err)
+	if progress != nil || ctx.Done() != nil {
+		reader = &watchedReader{ctx: ctx, reader: reader, progress: progress}
 	}
 
-	return hash.Sum(nil), nil
+	if opts.limiter != nil {
+		reader = &limitedReader{reader: reader, limiter: opts.limiter}
+	}
+
+	var buffer []byte
+	if opts.ReadBufferSize > 0 {
+		buffer = make([]byte, opts.ReadBufferSize)
+	}
+
+	if _, err := io.CopyBuffer(io.MultiWriter(writers...), reader, buffer); err != nil {
+		return nil, fmt.Errorf("failed to calculate hash for file %s: %w", filePath, err)
+	}
+
+	afterInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+
+	if afterInfo.Size() != fileSize || !afterInfo.ModTime().Equal(fileInfo.ModTime()) {
+		return nil, fmt.Errorf("%w: %s", ErrFileChanged, filePath)
+	}
+
+	hashes := make(map[HashAlgorithm][]byte, len(hashers))
+	for algo, hasher := range hashers {
+		hashes[algo] = hasher.Sum(nil)
+	}
+
+	return hashes, nil
+}
+
+// cacheKey returns the key of filePath in a hash cache. Keys are absolute paths, so scans of a
+// subdirectory and of the whole tree share their entries whatever form their roots were given in.
+func cacheKey(filePath string) string {
+	if absPath, err := filepath.Abs(filePath); err == nil {
+		return absPath
+	}
+
+	return filePath
 }
 
 // GetFileHash retrieves or calculates the hash of the file at filePath.
-func GetFileHash(filePath string, hashCache *sync.Map) ([]byte, error) {
+func GetFileHash(filePath string, hashCache Map) ([]byte, error) {
+	return getFileHash(filePath, hashCache, Options{})
+}
+
+// GetFileHashWithAlgorithm retrieves or calculates the hash of the file at filePath with algo.
+func GetFileHashWithAlgorithm(filePath string, hashCache Map, algo HashAlgorithm) ([]byte, error) {
+	return getFileHash(filePath, hashCache, Options{Algorithm: algo})
+}
+
+// getFileHash retrieves or calculates the hash of the file at filePath using opts.
+func getFileHash(filePath string, hashCache Map, opts Options) ([]byte, error) {
 	info, err := os.Stat(filePath)
 	if err != nil {
 		return nil, err
 	}
 	meta := FileMeta{Size: info.Size(), ModTime: info.ModTime()}
 
-	if cached, found := hashCache.Load(filePath); found {
+	if cached, found := hashCache.Load(cacheKey(filePath)); found {
 		cachedFile := cached.(CachedFile)
-		if cachedFile.Size == meta.Size && cachedFile.ModTime.Equal(meta.ModTime) {
+		if cachedFile.Algorithm == opts.Algorithm && cachedFile.Namespace == opts.Namespace && cachedFile.Size == meta.Size && cachedFile.ModTime.Equal(meta.ModTime) {
+			atomic.AddInt64(&cacheHits, 1)
+			if opts.Stats != nil {
+				atomic.AddInt64(&opts.Stats.CacheHits, 1)
+			}
 			return cachedFile.Hash, nil
 		}
 	}
 
-	hashValue, err := calculateFileHash(filePath)
+	atomic.AddInt64(&cacheMisses, 1)
+	if opts.Stats != nil {
+		atomic.AddInt64(&opts.Stats.CacheMisses, 1)
+	}
+
+	hashValue, err := calculateFileHash(filePath, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	cachedFile := CachedFile{
-		FileMeta: meta,
-		Hash:     hashValue,
+		FileMeta:  meta,
+		Hash:      hashValue,
+		Algorithm: opts.Algorithm,
+		Namespace: opts.Namespace,
 	}
-	hashCache.Store(filePath, cachedFile)
+	hashCache.Store(cacheKey(filePath), cachedFile)
 
 	return hashValue, nil
 }
 
-// hashImagesInPath hashes all images in the given path and updates the fileHashMap.
-func HashImagesInPath(path string, hashCache *sync.Map, hashedFiles *int64) (*sync.Map, error) {
-	fileHashMap := &sync.Map{}
-	fileChan := make(chan string)
+// HashImagesInPath hashes all images and videos in the given path and returns them as a hash map,
+// mapping every hex encoded hash to the path, as walked, of a file with that hash.
+// Files that change while being hashed, stall or panic are skipped and reported in the result, while a
+// path that can not be walked at all fails the scan.
+func HashImagesInPath(path string, hashCache Map, hashedFiles *int64, opts Options) (Map, Result, error) {
+	return hashImagesInRoots([]string{path}, hashCache, hashedFiles, opts)
+}
+
+// hashImagesInRoots walks every root concurrently into a single worker pool and hashes their images.
+func hashImagesInRoots(roots []string, hashCache Map, hashedFiles *int64, opts Options) (Map, Result, error) {
+	opts = opts.withPreset()
+
+	fileHashMap := opts.HashMap
+	if fileHashMap == nil {
+		fileHashMap = &sync.Map{}
+	}
+	fileChan := make(chan scannedFile, opts.queueSize())
 	errChan := make(chan error)
 	var wg sync.WaitGroup
 
-	numWorkers := runtime.NumCPU() * 4
+	// stop is closed on the first error so the walk and the workers wind down
+	// while errChan keeps being drained, no sender is ever left blocked.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	var result Result
+	var resultMu sync.Mutex
+
+	numWorkers := opts.workerCount()
+
+	// A private Stats keeps the counters the result is built from when the caller passed none.
+	if opts.Stats == nil {
+		opts.Stats = &Stats{}
+	}
+	if opts.RecordTimings {
+		opts.timings = &timingRecorder{}
+	}
+
+	opts.onWalkError = func(walkErr *FileError) {
+		resultMu.Lock()
+		result.Failed = append(result.Failed, walkErr)
+		resultMu.Unlock()
+	}
+	if opts.Prescan != nil {
+		result.Failed = append(result.Failed, opts.Prescan.Failed...)
+	}
+
+	startHits := atomic.LoadInt64(&opts.Stats.CacheHits)
+	startMisses := atomic.LoadInt64(&opts.Stats.CacheMisses)
+
+	// Cancelling the context winds the scan down like an error, the files in flight are abandoned.
+	ctx := opts.context()
+	scanned := make(chan struct{})
+	defer close(scanned)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopOnce.Do(func() { close(stop) })
+		case <-scanned:
+		}
+	}()
 
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for filePath := range fileChan {
-				if isImageFile(filePath) {
-					hashValue, err := GetFileHash(filePath, hashCache)
-					if err != nil {
-						errChan <- fmt.Errorf("failed to get file hash for %s: %v", filePath, err)
-						return
+			for file := range fileChan {
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+
+				filePath := file.path
+				outputPath := opts.outputPath(file.root, filePath)
+
+				// A cancelled scan abandons the file rather than waiting out its turn.
+				if opts.opsLimiter != nil {
+					if err := opts.opsLimiter.take(ctx); err != nil {
+						continue
+					}
+				}
+
+				if allowed, err := hasAllowedMimeType(filePath, opts); errors.Is(err, fs.ErrNotExist) {
+					resultMu.Lock()
+					result.Vanished = append(result.Vanished, outputPath)
+					resultMu.Unlock()
+					continue
+				} else if err != nil {
+					errChan <- &FileError{Path: outputPath, Err: err}
+					continue
+				} else if !allowed {
+					if size, err := fileSize(filePath); err == nil {
+						atomic.AddInt64(&opts.Stats.FilesTotal, -1)
+						atomic.AddInt64(&opts.Stats.BytesTotal, -size)
+					}
+					continue
+				}
+
+				if !meetsMinDimensions(filePath, opts) {
+					if size, err := fileSize(filePath); err == nil {
+						atomic.AddInt64(&opts.Stats.FilesTotal, -1)
+						atomic.AddInt64(&opts.Stats.BytesTotal, -size)
 					}
 
-					hashStr := hex.EncodeToString(hashValue)
-					fileHashMap.Store(hashStr, true)
+					resultMu.Lock()
+					result.Undersized = append(result.Undersized, outputPath)
+					resultMu.Unlock()
+					continue
+				}
+
+				hashValue, err := hashScannedFile(filePath, hashCache, opts)
+				var panicErr *PanicError
+				if errors.As(err, &panicErr) {
+					panicErr.Path = outputPath
+					resultMu.Lock()
+					result.Panicked = append(result.Panicked, panicErr)
+					resultMu.Unlock()
+					continue
+				} else if errors.Is(err, ErrFileChanged) {
+					resultMu.Lock()
+					result.Unstable = append(result.Unstable, outputPath)
+					resultMu.Unlock()
+					continue
+				} else if errors.Is(err, ErrReadTimeout) {
+					resultMu.Lock()
+					result.TimedOut = append(result.TimedOut, outputPath)
+					resultMu.Unlock()
+					continue
+				} else if errors.Is(err, fs.ErrNotExist) {
+					resultMu.Lock()
+					result.Vanished = append(result.Vanished, outputPath)
+					resultMu.Unlock()
+					continue
+				} else if err != nil {
+					errChan <- &FileError{Path: outputPath, Err: fmt.Errorf("failed to get file hash for %s: %v", filePath, err)}
+					continue
+				}
+
+				hashStr := hex.EncodeToString(hashValue)
+				fileHashMap.Store(hashStr, filePath)
+
+				var meta FileMeta
+				if cached, found := hashCache.Load(cacheKey(filePath)); found {
+					meta = cached.(CachedFile).FileMeta
+				}
+
+				if opts.onHashed != nil {
+					opts.onHashed(outputPath, hashStr)
+				}
+
+				if opts.JSONL != nil {
+					opts.JSONL.Write(HashRecord{Path: outputPath, Hash: hashStr, Size: meta.Size, ModTime: meta.ModTime, Algorithm: opts.Algorithm.recordName(), Namespace: opts.Namespace})
+				}
 
-					atomic.AddInt64(hashedFiles, 1)
+				atomic.AddInt64(&opts.Stats.FilesHashed, 1)
+				atomic.AddInt64(&opts.Stats.BytesHashed, meta.Size)
+
+				if opts.OnProgress != nil {
+					opts.OnProgress(filePath, meta.Size)
 				}
+
+				atomic.AddInt64(hashedFiles, 1)
 			}
 		}()
 	}
 
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		defer close(fileChan)
-		err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-			if err != nil {
-				errChan <- fmt.Errorf("failed to walk path %s: %v", filePath, err)
-				return err
+
+		if opts.Prescan != nil {
+			atomic.StoreInt64(&opts.Stats.FilesTotal, opts.Prescan.TotalFiles)
+			atomic.StoreInt64(&opts.Stats.BytesTotal, opts.Prescan.TotalBytes)
+
+			files := opts.Prescan.Files
+			if numWorkers == 1 {
+				files = append([]string(nil), files...)
+				sort.Strings(files)
 			}
 
-			if !info.IsDir() {
-				fileChan <- filePath
+			for _, filePath := range files {
+				select {
+				case fileChan <- scannedFile{root: opts.Prescan.Root, path: filePath}:
+				case <-stop:
+					return
+				}
 			}
+			return
+		}
 
-			return nil
-		})
+		var walkers sync.WaitGroup
+		walk := func(root string) {
+			defer walkers.Done()
 
-		if err != nil {
-			errChan <- err
+			err := walkCandidates(root, opts, func(filePath string, info os.FileInfo) error {
+				atomic.AddInt64(&opts.Stats.FilesTotal, 1)
+				atomic.AddInt64(&opts.Stats.BytesTotal, info.Size())
+
+				select {
+				case fileChan <- scannedFile{root: root, path: filePath}:
+					return nil
+				case <-stop:
+					return errScanStopped
+				}
+			})
+
+			// A walk that fails, such as on a root that can not be read, fails the scan rather than
+			// being reported as a failed file.
+			if err != nil && err != errScanStopped {
+				errChan <- err
+			}
 		}
+
+		for _, root := range roots {
+			walkers.Add(1)
+			if numWorkers == 1 {
+				walk(root)
+			} else {
+				go walk(root)
+			}
+		}
+		walkers.Wait()
 	}()
 
 	go func() {
@@ -161,11 +666,64 @@ func HashImagesInPath(path string, hashCache *sync.Map, hashedFiles *int64) (*sy
 		close(errChan)
 	}()
 
+	var firstErr error
 	for err := range errChan {
-		if err != nil {
-			return nil, err
+		var fileErr *FileError
+		if !opts.FailFast && errors.As(err, &fileErr) {
+			resultMu.Lock()
+			result.Failed = append(result.Failed, fileErr)
+			resultMu.Unlock()
+		} else if err != nil && firstErr == nil {
+			firstErr = err
+			stopOnce.Do(func() { close(stop) })
 		}
 	}
 
-	return fileHashMap, nil
+	if err := ctx.Err(); err != nil {
+		return nil, Result{}, err
+	} else if firstErr != nil {
+		return nil, Result{}, firstErr
+	}
+
+	result.CacheHits = atomic.LoadInt64(&opts.Stats.CacheHits) - startHits
+	result.CacheMisses = atomic.LoadInt64(&opts.Stats.CacheMisses) - startMisses
+
+	if opts.timings != nil {
+		result.Timings = opts.timings.summary(opts.SlowestFiles)
+	}
+
+	sort.Strings(result.Unstable)
+	sort.Strings(result.TimedOut)
+	sort.Strings(result.Undersized)
+	sort.Strings(result.Vanished)
+	sort.Slice(result.Panicked, func(i, j int) bool { return result.Panicked[i].Path < result.Panicked[j].Path })
+	sort.Slice(result.Failed, func(i, j int) bool { return result.Failed[i].Path < result.Failed[j].Path })
+
+	return fileHashMap, result, nil
+}
+
+// ShortHash returns the first nBytes of hashValue hex encoded, or all of it when nBytes is not smaller.
+// Short hashes can collide, they identify files for display but do not prove equal content.
+func ShortHash(hashValue []byte, nBytes int) string {
+	if nBytes > 0 && nBytes < len(hashValue) {
+		hashValue = hashValue[:nBytes]
+	}
+
+	return hex.EncodeToString(hashValue)
+}
+
+// GetPrefixHash calculates the SHA-256 hash of at most the first n bytes of the file at filePath.
+func GetPrefixHash(filePath string, n int64) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, file, n); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to calculate prefix hash for file %s: %v", filePath, err)
+	}
+
+	return hash.Sum(nil), nil
 }
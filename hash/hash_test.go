@@ -0,0 +1,171 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingFiles is the number of files the stress tests fail to hash, well past the number of workers.
+const failingFiles = 3000
+
+// failingPrescan returns a prescan of dir listing n directories named like images, which fail to be
+// read when hashed, along with a few files that hash.
+func failingPrescan(t *testing.T, dir string, n int) *Prescan {
+	t.Helper()
+
+	prescan := &Prescan{Root: dir, Sizes: make(map[string]int64)}
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("IMG_%04d.jpg", i))
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		prescan.Files = append(prescan.Files, path)
+	}
+
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("photo_%d.jpg", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("photo %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		prescan.Files = append(prescan.Files, path)
+	}
+	prescan.TotalFiles = int64(len(prescan.Files))
+
+	return prescan
+}
+
+// hashWithin runs HashImagesInPath with opts, failing t when it does not return within a minute.
+func hashWithin(t *testing.T, dir string, opts Options) (Result, error) {
+	t.Helper()
+
+	type outcome struct {
+		result Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		var hashedFiles int64
+		_, result, err := HashImagesInPath(dir, &sync.Map{}, &hashedFiles, opts)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case outcome := <-done:
+		return outcome.result, outcome.err
+	case <-time.After(time.Minute):
+		t.Fatal("HashImagesInPath deadlocked on failing files")
+		return Result{}, nil
+	}
+}
+
+// checkNoLeaks fails t when more goroutines are running than before the scan, once they had time to exit.
+func checkNoLeaks(t *testing.T, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running := runtime.NumGoroutine(); running > before {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines running after the scan, %d before:\n%s", running, before, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestHashImagesInPathManyFailures(t *testing.T) {
+	for _, concurrency := range []int{0, 1} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			dir := t.TempDir()
+			prescan := failingPrescan(t, dir, failingFiles)
+			before := runtime.NumGoroutine()
+
+			result, err := hashWithin(t, dir, Options{Prescan: prescan, MaxConcurrency: concurrency})
+			if err != nil {
+				t.Fatalf("scan failed: %v", err)
+			}
+			if len(result.Failed) != failingFiles {
+				t.Errorf("%d failed files reported, want %d", len(result.Failed), failingFiles)
+			}
+
+			checkNoLeaks(t, before)
+		})
+	}
+}
+
+func TestHashImagesInPathFailFastManyFailures(t *testing.T) {
+	dir := t.TempDir()
+	prescan := failingPrescan(t, dir, failingFiles)
+	before := runtime.NumGoroutine()
+
+	if _, err := hashWithin(t, dir, Options{Prescan: prescan, FailFast: true}); err == nil {
+		t.Fatal("scan with failing files succeeded with FailFast")
+	}
+
+	checkNoLeaks(t, before)
+}
+
+// writeBenchmarkCorpus writes count files of size bytes to a new directory, returning it with the
+// total size of the files.
+func writeBenchmarkCorpus(b *testing.B, count, size int) (string, int64) {
+	b.Helper()
+
+	dir := b.TempDir()
+	data := make([]byte, size)
+	for i := 0; i < count; i++ {
+		// Every file differs, as a real library mostly holds unique files.
+		data[0], data[1], data[2] = byte(i), byte(i>>8), byte(i>>16)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("IMG_%05d.jpg", i)), data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return dir, int64(count) * int64(size)
+}
+
+// BenchmarkHashImagesInPath hashes a corpus of many small files and one of a few large files with
+// the read buffer and queue sizes tuned, every iteration with an empty hash cache.
+func BenchmarkHashImagesInPath(b *testing.B) {
+	corpora := []struct {
+		name  string
+		count int
+		size  int
+	}{
+		{"small files", 2000, 16 << 10},
+		{"large files", 8, 16 << 20},
+	}
+	settings := []struct {
+		name           string
+		readBufferSize int
+		queueSize      int
+	}{
+		{"defaults", 0, 0},
+		{"buffer 4KB", 4 << 10, 0},
+		{"buffer 1MB", 1 << 20, 0},
+		{"queue 256", 0, 256},
+		{"buffer 1MB queue 256", 1 << 20, 256},
+	}
+
+	for _, corpus := range corpora {
+		dir, totalBytes := writeBenchmarkCorpus(b, corpus.count, corpus.size)
+
+		for _, setting := range settings {
+			b.Run(corpus.name+"/"+setting.name, func(b *testing.B) {
+				opts := Options{ReadBufferSize: setting.readBufferSize, QueueSize: setting.queueSize}
+				b.SetBytes(totalBytes)
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					var hashedFiles int64
+					if _, _, err := HashImagesInPath(dir, &sync.Map{}, &hashedFiles, opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// Index maps the files of a tree to their hashes and back.
+type Index struct {
+	byHash map[string][]string
+	byPath map[string]string
+}
+
+// BuildIndex hashes every image under root and returns an index of the hashes and paths.
+// Files left out of a scan, such as those that changed while being hashed or could not be read,
+// are not indexed but listed in the Result.
+func BuildIndex(root string, opts Options) (Index, Result, error) {
+	return buildIndex([]string{root}, opts)
+}
+
+// HashMultipleRoots hashes the images under all roots in one pass and returns a combined index,
+// so the paths of a hash may span roots. The roots are walked concurrently into one worker pool
+// and the Stats of opts add up across them. Nested roots hash their shared files twice.
+func HashMultipleRoots(roots []string, opts Options) (Index, Result, error) {
+	return buildIndex(roots, opts)
+}
+
+// buildIndex hashes the images under the roots into an index.
+func buildIndex(roots []string, opts Options) (Index, Result, error) {
+	return buildIndexWithCache(roots, &sync.Map{}, opts)
+}
+
+// buildIndexWithCache hashes the images under the roots into an index, reusing hashCache, with the
+// Result of the scan.
+func buildIndexWithCache(roots []string, hashCache Map, opts Options) (Index, Result, error) {
+	index := Index{
+		byHash: make(map[string][]string),
+		byPath: make(map[string]string),
+	}
+
+	var mu sync.Mutex
+	opts.onHashed = func(filePath, hashStr string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		index.byHash[hashStr] = append(index.byHash[hashStr], filePath)
+		index.byPath[filePath] = hashStr
+	}
+
+	var hashedFiles int64
+	_, result, err := hashImagesInRoots(roots, hashCache, &hashedFiles, opts)
+	if err != nil {
+		return Index{}, Result{}, err
+	}
+
+	for _, paths := range index.byHash {
+		sort.Strings(paths)
+	}
+
+	return index, result, nil
+}
+
+// Rescan walks and hashes only subpath and returns a copy of the index with the files under it
+// replaced by the result, so files added, changed or removed there are picked up without walking
+// the rest of the tree. Unchanged files are served from hashCache, which may be shared with other
+// scans. The index itself is left untouched, rescanning an empty Index builds one with hashCache.
+func (index Index) Rescan(subpath string, hashCache Map, opts Options) (Index, error) {
+	if opts.PathStyle == PathsRelative {
+		return Index{}, fmt.Errorf("failed to rescan %s: paths relative to the root can not be merged", subpath)
+	}
+
+	absSubpath, err := filepath.Abs(subpath)
+	if err != nil {
+		return Index{}, fmt.Errorf("failed to resolve path %s: %v", subpath, err)
+	}
+
+	// A subpath that was removed leaves no files, rather than failing the walk of its root.
+	scanned := Index{}
+	if _, err := os.Lstat(subpath); err == nil {
+		if scanned, _, err = buildIndexWithCache([]string{subpath}, hashCache, opts); err != nil {
+			return Index{}, err
+		}
+	} else if !os.IsNotExist(err) {
+		return Index{}, fmt.Errorf("failed to rescan %s: %v", subpath, err)
+	}
+
+	merged := Index{
+		byHash: make(map[string][]string, len(index.byHash)),
+		byPath: make(map[string]string, len(index.byPath)),
+	}
+
+	for filePath, hashStr := range index.byPath {
+		if pathsafe.Within(absSubpath, cacheKey(filePath)) {
+			continue
+		}
+		merged.byPath[filePath] = hashStr
+		merged.byHash[hashStr] = append(merged.byHash[hashStr], filePath)
+	}
+
+	for filePath, hashStr := range scanned.byPath {
+		merged.byPath[filePath] = hashStr
+		merged.byHash[hashStr] = append(merged.byHash[hashStr], filePath)
+	}
+
+	for _, paths := range merged.byHash {
+		sort.Strings(paths)
+	}
+
+	return merged, nil
+}
+
+// Paths returns the sorted paths of the files with the given hex encoded hash.
+func (index Index) Paths(hashStr string) []string {
+	return index.byHash[hashStr]
+}
+
+// Hash returns the hex encoded hash of the file at filePath.
+func (index Index) Hash(filePath string) (string, bool) {
+	hashStr, found := index.byPath[filePath]
+	return hashStr, found
+}
+
+// Hashes returns every distinct hash in the index, sorted.
+func (index Index) Hashes() []string {
+	hashes := make([]string, 0, len(index.byHash))
+	for hashStr := range index.byHash {
+		hashes = append(hashes, hashStr)
+	}
+	sort.Strings(hashes)
+
+	return hashes
+}
+
+// Len returns the number of indexed files.
+func (index Index) Len() int {
+	return len(index.byPath)
+}
@@ -0,0 +1,112 @@
+package hash
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// HashRecord is a single hashed file as written to JSON Lines.
+type HashRecord struct {
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// Algorithm names the hash function, it is left out for SHA-256.
+	Algorithm string `json:"algorithm,omitempty"`
+	// Namespace is the namespace the hash was keyed with, it is left out for plain hashes.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// JSONLWriter streams hash records as one JSON object per line.
+// Records are serialized through a single goroutine so it is safe to use from many workers.
+type JSONLWriter struct {
+	records chan HashRecord
+	done    chan error
+}
+
+// NewJSONLWriter starts a JSONLWriter writing to w.
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	writer := &JSONLWriter{
+		records: make(chan HashRecord, 100),
+		done:    make(chan error, 1),
+	}
+
+	go func() {
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+
+		var writeErr error
+		for record := range writer.records {
+			if writeErr != nil {
+				continue
+			}
+			if err := encoder.Encode(record); err != nil {
+				writeErr = fmt.Errorf("failed to write record for %s: %v", record.Path, err)
+			}
+		}
+
+		if err := buffered.Flush(); err != nil && writeErr == nil {
+			writeErr = fmt.Errorf("failed to flush records: %v", err)
+		}
+
+		writer.done <- writeErr
+	}()
+
+	return writer
+}
+
+// Write queues a record to be written.
+func (writer *JSONLWriter) Write(record HashRecord) {
+	writer.records <- record
+}
+
+// Close flushes all queued records and returns the first write error, if any.
+func (writer *JSONLWriter) Close() error {
+	close(writer.records)
+	return <-writer.done
+}
+
+// ReadJSONL reads hash records written by JSONLWriter and reconstructs the hash map.
+// When hashCache is not nil it is populated with the records as well.
+func ReadJSONL(r io.Reader, hashCache Map) (*sync.Map, error) {
+	fileHashMap := &sync.Map{}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var record HashRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read record: %v", err)
+		}
+
+		hashValue, err := hex.DecodeString(record.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash %q for %s", record.Hash, record.Path)
+		}
+
+		algo, err := ParseHashAlgorithm(record.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record for %s: %v", record.Path, err)
+		}
+
+		fileHashMap.Store(record.Hash, record.Path)
+
+		if hashCache != nil {
+			hashCache.Store(cacheKey(record.Path), CachedFile{
+				FileMeta:  FileMeta{Size: record.Size, ModTime: record.ModTime},
+				Hash:      hashValue,
+				Algorithm: algo,
+				Namespace: record.Namespace,
+			})
+		}
+	}
+
+	return fileHashMap, nil
+}
@@ -0,0 +1,11 @@
+package hash
+
+// Map is a concurrent map from keys to values, the interface of the hash caches and hash maps the
+// scans fill. *sync.Map implements it, SpillMap bounds the memory it takes.
+type Map interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	LoadOrStore(key, value any) (actual any, loaded bool)
+	Delete(key any)
+	Range(f func(key, value any) bool)
+}
@@ -0,0 +1,91 @@
+package hash
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+// OnlineIndex is an Index that grows one file at a time, for watchers that check every new file
+// against what has been seen so far. It is safe for concurrent use.
+type OnlineIndex struct {
+	mu        sync.Mutex
+	index     Index
+	hashCache Map
+	opts      Options
+}
+
+// NewOnlineIndex returns an online index seeded with the files of base, which may be empty.
+// Added files are hashed with opts.
+func NewOnlineIndex(base Index, opts Options) *OnlineIndex {
+	index := Index{
+		byHash: make(map[string][]string, len(base.byHash)),
+		byPath: make(map[string]string, len(base.byPath)),
+	}
+	for hashStr, paths := range base.byHash {
+		index.byHash[hashStr] = append([]string(nil), paths...)
+	}
+	for filePath, hashStr := range base.byPath {
+		index.byPath[filePath] = hashStr
+	}
+
+	return &OnlineIndex{index: index, hashCache: &sync.Map{}, opts: opts.withPreset()}
+}
+
+// Add hashes the file at filePath and indexes it. It reports whether the file duplicates files
+// already indexed and returns their sorted paths. Adding a path again re-hashes it, so a file
+// rewritten in place is indexed by its new content.
+func (online *OnlineIndex) Add(filePath string) (bool, []string, error) {
+	hashValue, err := hashScannedFile(filePath, online.hashCache, online.opts)
+	if err != nil {
+		return false, nil, err
+	}
+	hashStr := hex.EncodeToString(hashValue)
+
+	online.mu.Lock()
+	defer online.mu.Unlock()
+
+	if previous, found := online.index.byPath[filePath]; found {
+		online.index.byHash[previous] = removePath(online.index.byHash[previous], filePath)
+		if len(online.index.byHash[previous]) == 0 {
+			delete(online.index.byHash, previous)
+		}
+	}
+
+	existing := append([]string(nil), online.index.byHash[hashStr]...)
+
+	paths := append(online.index.byHash[hashStr], filePath)
+	sort.Strings(paths)
+	online.index.byHash[hashStr] = paths
+	online.index.byPath[filePath] = hashStr
+
+	return len(existing) > 0, existing, nil
+}
+
+// Paths returns the sorted paths of the files with the given hex encoded hash.
+func (online *OnlineIndex) Paths(hashStr string) []string {
+	online.mu.Lock()
+	defer online.mu.Unlock()
+
+	return append([]string(nil), online.index.byHash[hashStr]...)
+}
+
+// Len returns the number of indexed files.
+func (online *OnlineIndex) Len() int {
+	online.mu.Lock()
+	defer online.mu.Unlock()
+
+	return online.index.Len()
+}
+
+// removePath returns paths without filePath.
+func removePath(paths []string, filePath string) []string {
+	kept := paths[:0]
+	for _, path := range paths {
+		if path != filePath {
+			kept = append(kept, path)
+		}
+	}
+
+	return kept
+}
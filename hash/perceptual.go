@@ -0,0 +1,78 @@
+package hash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// DefaultPerceptualDistance is the Hamming distance up to which two perceptual hashes usually show the same image.
+const DefaultPerceptualDistance = 10
+
+// GetPerceptualHash calculates a 64-bit difference hash (dHash) of the image at filePath.
+// Files that are not decodable images fail with an error wrapping image.ErrFormat.
+func GetPerceptualHash(filePath string) (uint64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image %s: %w", filePath, err)
+	}
+
+	return differenceHash(img), nil
+}
+
+// differenceHash sets one bit per pixel of a 9x8 grayscale thumbnail, depending on whether it is brighter than its right neighbour.
+func differenceHash(img image.Image) uint64 {
+	pixels := grayscaleThumbnail(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y][x] > pixels[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// grayscaleThumbnail downscales img to width x height by averaging the luminance of each covered area.
+func grayscaleThumbnail(img image.Image, width, height int) [][]float64 {
+	bounds := img.Bounds()
+	sums := make([][]float64, height)
+	counts := make([][]int, height)
+	for y := range sums {
+		sums[y] = make([]float64, width)
+		counts[y] = make([]int, width)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * height / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * width / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			sums[cellY][cellX] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cellY][cellX]++
+		}
+	}
+
+	for y := range sums {
+		for x := range sums[y] {
+			if counts[y][x] > 0 {
+				sums[y][x] /= float64(counts[y][x])
+			}
+		}
+	}
+
+	return sums
+}
@@ -0,0 +1,89 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+
+	"github.com/keybraker/mediarizer-2/metadata"
+)
+
+// GetPixelHash calculates a SHA-256 hash of the decoded pixels of the image at filePath, so
+// re-encodes that change the bytes but not a single pixel hash the same. The image is turned
+// upright according to its EXIF orientation first, and the hash covers its dimensions and its
+// 8-bit RGBA pixels only, so metadata is ignored. Unlike GetPerceptualHash any pixel change makes
+// a different hash. Files that are not decodable images return an error wrapping image.ErrFormat.
+func GetPixelHash(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err == image.ErrFormat {
+		return nil, fmt.Errorf("failed to decode image %s: %w", filePath, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %v", filePath, err)
+	}
+
+	orientation, err := metadata.ExtractOrientation(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return hashPixels(img, orientation), nil
+}
+
+// hashPixels hashes the dimensions and pixels of img as they appear once oriented upright.
+func hashPixels(img image.Image, orientation int) []byte {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 are rotated by a quarter turn, which swaps the dimensions.
+	outWidth, outHeight := width, height
+	if orientation >= 5 {
+		outWidth, outHeight = height, width
+	}
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%dx%d\n", outWidth, outHeight)
+
+	row := make([]byte, 0, outWidth*4)
+	for y := 0; y < outHeight; y++ {
+		row = row[:0]
+		for x := 0; x < outWidth; x++ {
+			sourceX, sourceY := orientedSource(x, y, width, height, orientation)
+			pixel := color.RGBAModel.Convert(img.At(bounds.Min.X+sourceX, bounds.Min.Y+sourceY)).(color.RGBA)
+			row = append(row, pixel.R, pixel.G, pixel.B, pixel.A)
+		}
+		hasher.Write(row)
+	}
+
+	return hasher.Sum(nil)
+}
+
+// orientedSource maps the pixel at x, y of the upright image to its position in the stored image
+// of width x height pixels for the given EXIF orientation.
+func orientedSource(x, y, width, height, orientation int) (int, int) {
+	switch orientation {
+	case 2:
+		return width - 1 - x, y
+	case 3:
+		return width - 1 - x, height - 1 - y
+	case 4:
+		return x, height - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, height - 1 - x
+	case 7:
+		return width - 1 - y, height - 1 - x
+	case 8:
+		return width - 1 - y, x
+	default:
+		return x, y
+	}
+}
@@ -0,0 +1,61 @@
+package hash
+
+import (
+	"os"
+)
+
+// Prescan summarises the candidate files under a root, collected in a single walk.
+// It feeds both the progress totals and the size prefilter so the tree is only walked once.
+type Prescan struct {
+	Root       string
+	Files      []string
+	Sizes      map[string]int64
+	SizeGroups map[int64][]string
+	TotalFiles int64
+	TotalBytes int64
+	// Failed lists the directories that could not be read, unless Options.FailFast made the first
+	// of them abort the walk. Scans using the prescan report them as their own failures.
+	Failed []*FileError
+}
+
+// PrescanPath walks root once, applying the filters of opts, and records every candidate with its size.
+func PrescanPath(root string, opts Options) (*Prescan, error) {
+	prescan := &Prescan{
+		Root:       root,
+		Sizes:      make(map[string]int64),
+		SizeGroups: make(map[int64][]string),
+	}
+	opts.onWalkError = func(walkErr *FileError) {
+		prescan.Failed = append(prescan.Failed, walkErr)
+	}
+
+	err := walkCandidates(root, opts, func(filePath string, info os.FileInfo) error {
+		size := info.Size()
+
+		prescan.Files = append(prescan.Files, filePath)
+		prescan.Sizes[filePath] = size
+		prescan.SizeGroups[size] = append(prescan.SizeGroups[size], filePath)
+		prescan.TotalFiles++
+		prescan.TotalBytes += size
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prescan, nil
+}
+
+// SizeCandidates returns the files that share their size with at least one other file,
+// the only ones that can possibly have a duplicate.
+func (prescan *Prescan) SizeCandidates() []string {
+	var candidates []string
+	for _, filePath := range prescan.Files {
+		if len(prescan.SizeGroups[prescan.Sizes[filePath]]) > 1 {
+			candidates = append(candidates, filePath)
+		}
+	}
+
+	return candidates
+}
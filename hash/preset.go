@@ -0,0 +1,103 @@
+package hash
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Preset bundles option values for a common scenario, options set explicitly take precedence.
+type Preset int
+
+const (
+	// DefaultPreset leaves the options as they are.
+	DefaultPreset Preset = iota
+	// Polite is meant for external and USB drives. It hashes with two workers, caps the read rate
+	// and reads in large sequential chunks to keep seeking down, so the drive stays cool and the
+	// machine responsive at the cost of much longer scans. A low read timeout can fire while a
+	// worker waits on the rate limit, so it should be set well above a second.
+	Polite
+)
+
+const (
+	politeConcurrency    = 2
+	politeBytesPerSecond = 32 * 1024 * 1024
+	politeReadBufferSize = 4 * 1024 * 1024
+)
+
+// withPreset returns the options with the values of their preset filled in where none were set.
+func (opts Options) withPreset() Options {
+	if opts.Preset == Polite {
+		if opts.MaxConcurrency == 0 {
+			opts.MaxConcurrency = politeConcurrency
+		}
+		if opts.BytesPerSecond == 0 {
+			opts.BytesPerSecond = politeBytesPerSecond
+		}
+		if opts.ReadBufferSize == 0 {
+			opts.ReadBufferSize = politeReadBufferSize
+		}
+	}
+
+	if opts.Limiter != nil && opts.limiter == nil {
+		opts.limiter = opts.Limiter
+	}
+
+	if opts.BytesPerSecond > 0 && opts.limiter == nil {
+		opts.limiter = NewRateLimiter(opts.BytesPerSecond)
+	}
+
+	if opts.OpsPerSecond > 0 && opts.opsLimiter == nil {
+		opts.opsLimiter = newTokenBucket(opts.OpsPerSecond)
+	}
+
+	return opts
+}
+
+// RateLimiter spreads reads shared by many workers so they stay below a number of bytes per second.
+type RateLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	next           time.Time
+}
+
+// NewRateLimiter creates a limiter allowing bytesPerSecond bytes to be read per second.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// Reader returns a reader pacing the reads from reader through the limiter.
+func (limiter *RateLimiter) Reader(reader io.Reader) io.Reader {
+	return &limitedReader{reader: reader, limiter: limiter}
+}
+
+// wait blocks until n more bytes may be read.
+func (limiter *RateLimiter) wait(n int) {
+	limiter.mu.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(int64(n) * int64(time.Second) / limiter.bytesPerSecond))
+	limiter.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// limitedReader paces its reads through a rate limiter.
+type limitedReader struct {
+	reader  io.Reader
+	limiter *RateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+
+	return n, err
+}
@@ -0,0 +1,52 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// QuickFingerprintChunk is how many bytes QuickFingerprint reads from each end of a file.
+const QuickFingerprintChunk = 1 << 20
+
+// QuickFingerprint calculates a SHA-256 over the size of the file at filePath, its first and its
+// last QuickFingerprintChunk bytes, so even multi-gigabyte videos are fingerprinted in two reads.
+// Files with different fingerprints always differ, equal fingerprints must be confirmed with
+// GetFileHash since the middle of the files is never read. Files of at most twice the chunk size
+// are read completely.
+func QuickFingerprint(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %v", filePath, err)
+	}
+	size := info.Size()
+
+	hasher := sha256.New()
+	binary.Write(hasher, binary.BigEndian, size)
+
+	head := size
+	if size > 2*QuickFingerprintChunk {
+		head = QuickFingerprintChunk
+	}
+
+	if _, err := io.CopyN(hasher, file, head); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to calculate fingerprint for file %s: %v", filePath, err)
+	}
+
+	if head < size {
+		tail := io.NewSectionReader(file, size-QuickFingerprintChunk, QuickFingerprintChunk)
+		if _, err := io.Copy(hasher, tail); err != nil {
+			return nil, fmt.Errorf("failed to calculate fingerprint for file %s: %v", filePath, err)
+		}
+	}
+
+	return hasher.Sum(nil), nil
+}
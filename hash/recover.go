@@ -0,0 +1,30 @@
+package hash
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError reports a panic raised while processing a single file.
+type PanicError struct {
+	Path  string
+	Value any
+	Stack []byte
+}
+
+// NewPanicError records the recovered value and the current stack for the file at filePath.
+func NewPanicError(filePath string, value any) *PanicError {
+	return &PanicError{Path: filePath, Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while processing %s: %v\n%s", e.Path, e.Value, e.Stack)
+}
+
+// RecoverPanic turns a panic raised while processing the file at filePath into a *PanicError stored in err.
+// It has to be deferred directly for recover to take effect.
+func RecoverPanic(filePath string, err *error) {
+	if value := recover(); value != nil {
+		*err = NewPanicError(filePath, value)
+	}
+}
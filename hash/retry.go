@@ -0,0 +1,86 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// maxRetryBackoff caps the wait between two attempts, however many came before.
+const maxRetryBackoff = 30 * time.Second
+
+// transientErrnos are the system errors network shares and failing USB links return for reads that
+// may well succeed when tried again.
+var transientErrnos = append([]syscall.Errno{
+	syscall.EIO,
+	syscall.EINTR,
+	syscall.EAGAIN,
+	syscall.EBUSY,
+	syscall.ETIMEDOUT,
+	syscall.ESTALE,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.ENETDOWN,
+	syscall.ENETUNREACH,
+	syscall.ENETRESET,
+	syscall.EHOSTDOWN,
+	syscall.EHOSTUNREACH,
+}, platformTransientErrnos...)
+
+// RetryPolicy retries operations on files that fail with transient errors. The zero RetryPolicy
+// tries every operation once.
+type RetryPolicy struct {
+	// Attempts is the number of times an operation on a file is retried after it first fails.
+	Attempts int
+	// Backoff is the wait before the first retry, doubling before every following one.
+	Backoff time.Duration
+}
+
+// IsTransient checks if err is an error retrying may get past, such as an I/O error or timeout of a
+// network share, rather than one that fails every time, such as a missing file or a denied permission.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrReadTimeout) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+
+	for _, transient := range transientErrnos {
+		if errno == transient {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient or has been retried
+// Attempts times, waiting with exponential backoff in between. Cancelling ctx stops the waiting.
+func (policy RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	backoff := policy.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.Attempts || !IsTransient(err) {
+			if err != nil && attempt > 0 {
+				return fmt.Errorf("%w (gave up after %d attempts)", err, attempt+1)
+			}
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
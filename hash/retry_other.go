@@ -0,0 +1,8 @@
+//go:build !windows
+
+package hash
+
+import "syscall"
+
+// platformTransientErrnos are the transient errors of this platform past the common ones, of which there are none.
+var platformTransientErrnos []syscall.Errno
@@ -0,0 +1,7 @@
+package hash
+
+import "syscall"
+
+// platformTransientErrnos are the errors of windows network shares that drop or stall: a network
+// name no longer available, an unexpected network error and a semaphore timeout.
+var platformTransientErrnos = []syscall.Errno{64, 59, 121}
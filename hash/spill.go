@@ -0,0 +1,367 @@
+package hash
+
+import (
+	"bytes"
+	"container/list"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// spillBatchSize is the number of spilled entries Range reads from disk at a time.
+const spillBatchSize = 1000
+
+const spillSchema = `
+PRAGMA journal_mode = OFF;
+PRAGMA synchronous = OFF;
+CREATE TABLE entries (
+	key   TEXT PRIMARY KEY,
+	value BLOB NOT NULL
+);
+`
+
+func init() {
+	// Spilled values are encoded as interfaces, which gob needs the concrete types of registered for.
+	gob.Register(CachedFile{})
+}
+
+// spillEntry is an entry of a SpillMap held in memory.
+type spillEntry struct {
+	key   string
+	value any
+}
+
+// spillValue wraps the values written to disk so they are encoded with their type.
+type spillValue struct {
+	Value any
+}
+
+// SpillStats counts the entries of a SpillMap.
+type SpillStats struct {
+	// InMemory is the number of entries held in memory.
+	InMemory int
+	// Spilled is the number of entries written out to disk.
+	Spilled int64
+	// Evictions is the number of times an entry was written out to make room for another.
+	Evictions int64
+}
+
+// SpillMap is a Map that keeps the most recently used entries in memory and spills the others to a
+// temporary SQLite database, so maps of millions of files take bounded memory. Keys must be strings and
+// values strings or CachedFile. It is safe for concurrent use, and Range does not hold it locked while
+// calling f. Disk errors can not be returned by the Map methods, an entry that failed to be written or
+// read is lost and the first such error reported by Err.
+type SpillMap struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List
+	db         *sql.DB
+	path       string
+	spilled    int64
+	evictions  int64
+	err        error
+}
+
+// NewSpillMap returns an empty SpillMap holding up to maxEntries entries in memory, spilling the rest to
+// a database in dir, or the default temporary directory when dir is empty. The database is removed by Close.
+func NewSpillMap(dir string, maxEntries int) (*SpillMap, error) {
+	if maxEntries < 1 {
+		return nil, fmt.Errorf("invalid number of entries %d to keep in memory", maxEntries)
+	}
+
+	file, err := os.CreateTemp(dir, "mediarizer-spill-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %v", err)
+	}
+	path := file.Name()
+	file.Close()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to open spill file %s: %v", path, err)
+	}
+	// A single connection keeps the pragmas, which only apply to the connection they ran on.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(spillSchema); err != nil {
+		db.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to create spill file %s: %v", path, err)
+	}
+
+	return &SpillMap{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+		db:         db,
+		path:       path,
+	}, nil
+}
+
+// Load returns the value stored for key, reading it back into memory when it was spilled.
+func (m *SpillMap) Load(key any) (any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.load(key.(string))
+}
+
+// Store sets the value for key.
+func (m *SpillMap) Store(key, value any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store(key.(string), value)
+}
+
+// LoadOrStore returns the value stored for key if there is one, and otherwise stores value.
+// loaded reports whether the value was already stored.
+func (m *SpillMap) LoadOrStore(key, value any) (any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if actual, found := m.load(key.(string)); found {
+		return actual, true
+	}
+	m.store(key.(string), value)
+
+	return value, false
+}
+
+// Delete deletes the value for key.
+func (m *SpillMap) Delete(key any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, found := m.entries[key.(string)]; found {
+		m.recent.Remove(element)
+		delete(m.entries, key.(string))
+		return
+	}
+
+	m.deleteSpilled(key.(string))
+}
+
+// Range calls f for every entry, those in memory first and then the spilled ones in batches, until f
+// returns false. Like with sync.Map, entries stored or deleted while ranging may or may not be visited.
+func (m *SpillMap) Range(f func(key, value any) bool) {
+	m.mu.Lock()
+	inMemory := make([]spillEntry, 0, m.recent.Len())
+	for element := m.recent.Front(); element != nil; element = element.Next() {
+		inMemory = append(inMemory, *element.Value.(*spillEntry))
+	}
+	m.mu.Unlock()
+
+	for _, entry := range inMemory {
+		if !f(entry.key, entry.value) {
+			return
+		}
+	}
+
+	lastKey := ""
+	for {
+		batch, err := m.spilledBatch(lastKey)
+		if err != nil {
+			m.mu.Lock()
+			m.fail(err)
+			m.mu.Unlock()
+			return
+		}
+
+		for _, entry := range batch {
+			if !f(entry.key, entry.value) {
+				return
+			}
+		}
+
+		if len(batch) < spillBatchSize {
+			return
+		}
+		lastKey = batch[len(batch)-1].key
+	}
+}
+
+// Stats returns the number of entries held in memory and spilled to disk.
+func (m *SpillMap) Stats() SpillStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return SpillStats{InMemory: m.recent.Len(), Spilled: m.spilled, Evictions: m.evictions}
+}
+
+// Err returns the first error reading or writing the spilled entries, if any.
+func (m *SpillMap) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.err
+}
+
+// Close closes the database of the spilled entries and removes it.
+func (m *SpillMap) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.db.Close(); err != nil {
+		return fmt.Errorf("failed to close spill file %s: %v", m.path, err)
+	}
+	if err := os.Remove(m.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove spill file %s: %v", m.path, err)
+	}
+
+	return nil
+}
+
+// load implements Load with m locked, moving spilled entries back into memory.
+func (m *SpillMap) load(key string) (any, bool) {
+	if element, found := m.entries[key]; found {
+		m.recent.MoveToFront(element)
+		return element.Value.(*spillEntry).value, true
+	}
+	if m.spilled == 0 {
+		return nil, false
+	}
+
+	var encoded []byte
+	err := m.db.QueryRow("SELECT value FROM entries WHERE key = ?", key).Scan(&encoded)
+	if err == sql.ErrNoRows {
+		return nil, false
+	} else if err != nil {
+		m.fail(fmt.Errorf("failed to read spilled entry %s: %v", key, err))
+		return nil, false
+	}
+
+	value, err := decodeSpillValue(encoded)
+	if err != nil {
+		m.fail(fmt.Errorf("failed to decode spilled entry %s: %v", key, err))
+		return nil, false
+	}
+
+	m.deleteSpilled(key)
+	m.insert(key, value)
+
+	return value, true
+}
+
+// store implements Store with m locked.
+func (m *SpillMap) store(key string, value any) {
+	if element, found := m.entries[key]; found {
+		element.Value.(*spillEntry).value = value
+		m.recent.MoveToFront(element)
+		return
+	}
+
+	// The spilled copy is stale once the entry is held in memory again.
+	m.deleteSpilled(key)
+	m.insert(key, value)
+}
+
+// insert adds an entry to memory, spilling the least recently used one when memory is full.
+func (m *SpillMap) insert(key string, value any) {
+	m.entries[key] = m.recent.PushFront(&spillEntry{key: key, value: value})
+	if m.recent.Len() <= m.maxEntries {
+		return
+	}
+
+	oldest := m.recent.Back()
+	entry := oldest.Value.(*spillEntry)
+	m.recent.Remove(oldest)
+	delete(m.entries, entry.key)
+	m.evictions++
+
+	encoded, err := encodeSpillValue(entry.value)
+	if err != nil {
+		m.fail(fmt.Errorf("failed to encode entry %s: %v", entry.key, err))
+		return
+	}
+	if _, err := m.db.Exec("INSERT INTO entries (key, value) VALUES (?, ?)", entry.key, encoded); err != nil {
+		m.fail(fmt.Errorf("failed to spill entry %s: %v", entry.key, err))
+		return
+	}
+	m.spilled++
+}
+
+// deleteSpilled removes the spilled copy of key, if there is one.
+func (m *SpillMap) deleteSpilled(key string) {
+	if m.spilled == 0 {
+		return
+	}
+
+	result, err := m.db.Exec("DELETE FROM entries WHERE key = ?", key)
+	if err != nil {
+		m.fail(fmt.Errorf("failed to delete spilled entry %s: %v", key, err))
+		return
+	}
+	if deleted, err := result.RowsAffected(); err == nil {
+		m.spilled -= deleted
+	}
+}
+
+// spilledBatch reads the spilled entries following lastKey in key order.
+func (m *SpillMap) spilledBatch(lastKey string) ([]spillEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.spilled == 0 {
+		return nil, nil
+	}
+
+	rows, err := m.db.Query("SELECT key, value FROM entries WHERE key > ? ORDER BY key LIMIT ?", lastKey, spillBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spill file %s: %v", m.path, err)
+	}
+	defer rows.Close()
+
+	var batch []spillEntry
+	for rows.Next() {
+		var key string
+		var encoded []byte
+		if err := rows.Scan(&key, &encoded); err != nil {
+			return nil, fmt.Errorf("failed to read spill file %s: %v", m.path, err)
+		}
+
+		value, err := decodeSpillValue(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode spilled entry %s: %v", key, err)
+		}
+		batch = append(batch, spillEntry{key: key, value: value})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spill file %s: %v", m.path, err)
+	}
+
+	return batch, nil
+}
+
+// fail records err unless an earlier error was recorded, with m locked.
+func (m *SpillMap) fail(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// encodeSpillValue encodes a value to be written to disk.
+func encodeSpillValue(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(spillValue{Value: value}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeSpillValue decodes a value encoded by encodeSpillValue.
+func decodeSpillValue(encoded []byte) (any, error) {
+	var decoded spillValue
+	if err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	return decoded.Value, nil
+}
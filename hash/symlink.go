@@ -0,0 +1,60 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkMode selects how symlinked files are treated while scanning.
+//
+// Symlinked directories are never followed by the walk, so the mode only
+// concerns links to files and can not introduce loops.
+type SymlinkMode int
+
+const (
+	// SymlinkSkip leaves symlinked files out of the scan.
+	SymlinkSkip SymlinkMode = iota
+	// SymlinkHashTarget hashes the content the link points to, so links dedupe against their targets.
+	SymlinkHashTarget
+	// SymlinkHashLinkPath hashes the path of the link itself, so every link is unique.
+	SymlinkHashLinkPath
+)
+
+// includeSymlink decides if a symlinked file found by the walk should be hashed.
+func includeSymlink(filePath string, mode SymlinkMode) bool {
+	switch mode {
+	case SymlinkHashTarget:
+		info, err := os.Stat(filePath)
+		return err == nil && info.Mode().IsRegular()
+	case SymlinkHashLinkPath:
+		return true
+	default:
+		return false
+	}
+}
+
+// hashLinkPath hashes the absolute path of the link so it never matches any content hash.
+func hashLinkPath(filePath string) ([]byte, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %v", filePath, err)
+	}
+
+	sum := sha256.Sum256([]byte("symlink:" + absPath))
+	return sum[:], nil
+}
+
+// hashScannedFile hashes a file found by the walk, honouring the symlink mode.
+func hashScannedFile(filePath string, hashCache Map, opts Options) (hashValue []byte, err error) {
+	defer RecoverPanic(filePath, &err)
+
+	if opts.SymlinkFiles == SymlinkHashLinkPath {
+		if info, err := os.Lstat(filePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return hashLinkPath(filePath)
+		}
+	}
+
+	return getFileHash(filePath, hashCache, opts)
+}
@@ -0,0 +1,67 @@
+package hash
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits how many files the workers of a scan may start per second. It holds up to
+// one second worth of tokens, so an idle scan can start a short burst before being paced.
+type tokenBucket struct {
+	mu           sync.Mutex
+	opsPerSecond float64
+	tokens       float64
+	last         time.Time
+}
+
+// newTokenBucket creates a full bucket refilled at opsPerSecond tokens per second.
+func newTokenBucket(opsPerSecond float64) *tokenBucket {
+	return &tokenBucket{opsPerSecond: opsPerSecond, tokens: bucketCapacity(opsPerSecond), last: time.Now()}
+}
+
+// bucketCapacity returns the burst size of a bucket, never less than a single operation.
+func bucketCapacity(opsPerSecond float64) float64 {
+	if opsPerSecond < 1 {
+		return 1
+	}
+
+	return opsPerSecond
+}
+
+// take blocks until another operation may start, or ctx is cancelled. A cancelled wait gives its
+// reserved token back and returns the error of ctx.
+func (bucket *tokenBucket) take(ctx context.Context) error {
+	bucket.mu.Lock()
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.opsPerSecond
+	if capacity := bucketCapacity(bucket.opsPerSecond); bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+	bucket.last = now
+
+	// The token is taken right away, a negative balance reserves it for the waiting caller.
+	bucket.tokens--
+	var delay time.Duration
+	if bucket.tokens < 0 {
+		delay = time.Duration(-bucket.tokens / bucket.opsPerSecond * float64(time.Second))
+	}
+	bucket.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		bucket.mu.Lock()
+		bucket.tokens++
+		bucket.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,43 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestTokenBucketTakeCancelled reserves tokens for several workers at a low rate, which would wait
+// for seconds, and cancels them.
+func TestTokenBucketTakeCancelled(t *testing.T) {
+	bucket := newTokenBucket(0.5)
+	if err := bucket.take(context.Background()); err != nil {
+		t.Fatalf("take of the first token failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- bucket.take(ctx) }()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	timeout := time.After(time.Second)
+	for i := 0; i < cap(errs); i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("cancelled take returned %v, want %v", err, context.Canceled)
+			}
+		case <-timeout:
+			t.Fatal("take kept waiting for its token after the context was cancelled")
+		}
+	}
+
+	// The cancelled reservations are given back, so the next token is due within a refill.
+	if bucket.tokens < -1 {
+		t.Errorf("bucket holds %.2f tokens after the cancelled takes, want the reservations given back", bucket.tokens)
+	}
+}
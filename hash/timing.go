@@ -0,0 +1,82 @@
+package hash
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileTiming is the time spent hashing a single file.
+type FileTiming struct {
+	Path     string
+	Duration time.Duration
+}
+
+// Timings summarises how long the files of a scan took to hash. Files served from the hash cache are not timed.
+type Timings struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	// Slowest lists the slowest files, slowest first, up to Options.SlowestFiles of them.
+	Slowest []FileTiming
+}
+
+// timingRecorder collects the hash durations of every file of a scan.
+type timingRecorder struct {
+	mu      sync.Mutex
+	timings []FileTiming
+}
+
+// record adds the time hashing filePath took since start.
+func (recorder *timingRecorder) record(filePath string, start time.Time) {
+	duration := time.Since(start)
+
+	recorder.mu.Lock()
+	recorder.timings = append(recorder.timings, FileTiming{Path: filePath, Duration: duration})
+	recorder.mu.Unlock()
+}
+
+// summary returns the percentiles of the recorded durations and the slowest files.
+func (recorder *timingRecorder) summary(slowest int) *Timings {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	timings := recorder.timings
+	sort.Slice(timings, func(i, j int) bool {
+		if timings[i].Duration != timings[j].Duration {
+			return timings[i].Duration > timings[j].Duration
+		}
+		return timings[i].Path < timings[j].Path
+	})
+
+	summary := &Timings{
+		Count: len(timings),
+		P50:   percentile(timings, 0.50),
+		P95:   percentile(timings, 0.95),
+		P99:   percentile(timings, 0.99),
+	}
+
+	if slowest > len(timings) {
+		slowest = len(timings)
+	}
+	if slowest > 0 {
+		summary.Slowest = append([]FileTiming(nil), timings[:slowest]...)
+	}
+
+	return summary
+}
+
+// percentile returns the duration below which the fraction p of timings fall, timings being sorted slowest first.
+func percentile(timings []FileTiming, p float64) time.Duration {
+	if len(timings) == 0 {
+		return 0
+	}
+
+	index := int(float64(len(timings)) * (1 - p))
+	if index >= len(timings) {
+		index = len(timings) - 1
+	}
+
+	return timings[index].Duration
+}
@@ -0,0 +1,48 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// TreeHash calculates a single hash of the images under root from their slash separated relative paths
+// and content hashes, so two trees hash equal exactly when they hold the same images at the same places.
+// It fails when a file could not be read or hashed reliably, or vanished, since the result would not be stable.
+func TreeHash(root string, opts Options) ([]byte, error) {
+	entries := make(map[string]string)
+
+	var mu sync.Mutex
+	opts.PathStyle = PathsRelative
+	opts.onHashed = func(relPath, hashStr string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		entries[filepath.ToSlash(relPath)] = hashStr
+	}
+
+	var hashedFiles int64
+	_, result, err := HashImagesInPath(root, &sync.Map{}, &hashedFiles, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if skipped := len(result.Unstable) + len(result.TimedOut) + len(result.Panicked) + len(result.Failed) + len(result.Vanished); skipped > 0 {
+		return nil, fmt.Errorf("failed to hash tree %s: %d files could not be hashed", root, skipped)
+	}
+
+	relPaths := make([]string, 0, len(entries))
+	for relPath := range entries {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	tree := sha256.New()
+	for _, relPath := range relPaths {
+		fmt.Fprintf(tree, "%s\x00%s\n", relPath, entries[relPath])
+	}
+
+	return tree.Sum(nil), nil
+}
@@ -0,0 +1,140 @@
+package hash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/mediatype"
+)
+
+// ErrCorrupt is returned for media files whose data can not be decoded.
+var ErrCorrupt = errors.New("corrupt media")
+
+// ebmlMagic starts every Matroska and WebM file.
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+// ValidateImage fully decodes the image at filePath and returns an ErrCorrupt error when that fails.
+// Formats no decoder is registered for are not judged and pass.
+func ValidateImage(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	if _, _, err := image.Decode(file); errors.Is(err, image.ErrFormat) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupt, filePath, err)
+	}
+
+	return nil
+}
+
+// ValidateVideo probes the container of the video at filePath and returns an ErrCorrupt error when
+// its structure is broken: MP4 and QuickTime boxes that run past the end of the file or a missing
+// movie header, a RIFF size larger than the AVI, or Matroska without its EBML header. The frames are
+// not decoded, and other formats pass.
+func ValidateVideo(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("%w: %s: too short for a video", ErrCorrupt, filePath)
+	}
+
+	var problem string
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".mp4", ".mov":
+		problem = probeBoxes(file, info.Size())
+	case ".avi":
+		if string(header[:4]) != "RIFF" || string(header[8:12]) != "AVI " {
+			problem = "no RIFF AVI header"
+		} else if size := int64(binary.LittleEndian.Uint32(header[4:8])) + 8; size > info.Size() {
+			problem = fmt.Sprintf("truncated to %d of %d bytes", info.Size(), size)
+		}
+	case ".mkv":
+		if !bytes.Equal(header[:4], ebmlMagic) {
+			problem = "no EBML header"
+		}
+	}
+	if problem != "" {
+		return fmt.Errorf("%w: %s: %s", ErrCorrupt, filePath, problem)
+	}
+
+	return nil
+}
+
+// probeBoxes walks the top level boxes of an MP4 or QuickTime file of size bytes, returning what is
+// wrong with them or an empty string.
+func probeBoxes(file io.ReaderAt, size int64) string {
+	header := make([]byte, 16)
+	foundMovie := false
+
+	for offset := int64(0); offset < size; {
+		if size-offset < 8 {
+			return fmt.Sprintf("trailing %d bytes at %d", size-offset, offset)
+		}
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return fmt.Sprintf("unreadable box at %d: %v", offset, err)
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return fmt.Sprintf("unreadable box at %d: %v", offset, err)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		if boxSize < headerSize || boxSize > size-offset {
+			return fmt.Sprintf("box %q at %d runs past the end of the file", boxType, offset)
+		}
+		if boxType == "moov" {
+			foundMovie = true
+		}
+
+		offset += boxSize
+	}
+
+	if !foundMovie {
+		return "no movie header"
+	}
+
+	return ""
+}
+
+// ValidateMedia validates the image or video at filePath by its extension, other files pass.
+func ValidateMedia(filePath string) error {
+	if mediatype.HasVideoExtension(filePath) {
+		return ValidateVideo(filePath)
+	}
+	if mediatype.HasImageExtension(filePath) {
+		return ValidateImage(filePath)
+	}
+
+	return nil
+}
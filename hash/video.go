@@ -0,0 +1,147 @@
+package hash
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// ErrNoFFmpeg is returned by VideoPerceptualHash when no ffmpeg executable is found in the PATH.
+var ErrNoFFmpeg = errors.New("ffmpeg not found in PATH")
+
+// DefaultVideoSimilarity is the similarity above which two videos are usually the same footage.
+const DefaultVideoSimilarity = 0.9
+
+const (
+	defaultVideoFrameInterval = 5 * time.Second
+	defaultVideoMaxFrames     = 64
+)
+
+// VideoHashOptions configures VideoPerceptualHash.
+type VideoHashOptions struct {
+	// Interval is the time between sampled frames, 5 seconds by default.
+	Interval time.Duration
+	// MaxFrames caps the number of sampled frames, 64 by default, so long videos are only
+	// fingerprinted by their beginning.
+	MaxFrames int
+}
+
+// VideoHash is the sequence of perceptual hashes of frames sampled at a fixed interval.
+type VideoHash struct {
+	Interval time.Duration
+	Frames   []uint64
+}
+
+// VideoPerceptualHash samples a frame of the video at filePath every interval, starting at the
+// first frame, and perceptual hashes each with the same difference hash as GetPerceptualHash.
+// Frames are decoded by the ffmpeg executable, which has to be installed.
+//
+// Sampling at a fixed interval rather than at the encoded keyframes keeps the samples of a
+// re-encode aligned with the original, whatever keyframe spacing the encoder chose. Copies trimmed
+// by a multiple of the interval line up exactly, other trims sample frames up to half an interval
+// apart, which only matches well for footage that changes slowly. Rotated, cropped or mirrored
+// copies are not recognised, and videos shorter than one interval are reduced to a single frame,
+// so any two stills that look alike match.
+func VideoPerceptualHash(filePath string, opts VideoHashOptions) (VideoHash, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultVideoFrameInterval
+	}
+	if opts.MaxFrames <= 0 {
+		opts.MaxFrames = defaultVideoMaxFrames
+	}
+
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return VideoHash{}, ErrNoFFmpeg
+	}
+
+	// The frames are downscaled by ffmpeg already, the hash only looks at a 9x8 thumbnail.
+	fps := "fps=1/" + strconv.FormatFloat(opts.Interval.Seconds(), 'f', -1, 64) + ",scale=64:-2"
+	cmd := exec.Command(ffmpeg,
+		"-v", "error", "-i", filePath,
+		"-vf", fps, "-frames:v", strconv.Itoa(opts.MaxFrames),
+		"-f", "image2pipe", "-vcodec", "png", "-",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return VideoHash{}, fmt.Errorf("failed to start ffmpeg for %s: %v", filePath, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return VideoHash{}, fmt.Errorf("failed to start ffmpeg for %s: %v", filePath, err)
+	}
+
+	videoHash := VideoHash{Interval: opts.Interval}
+	frames := bufio.NewReader(stdout)
+	var decodeErr error
+	for {
+		if _, err := frames.Peek(1); err == io.EOF {
+			break
+		}
+
+		frame, err := png.Decode(frames)
+		if err != nil {
+			decodeErr = fmt.Errorf("failed to decode frame %d of %s: %v", len(videoHash.Frames), filePath, err)
+			io.Copy(io.Discard, frames)
+			break
+		}
+		videoHash.Frames = append(videoHash.Frames, differenceHash(frame))
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return VideoHash{}, fmt.Errorf("failed to sample frames of %s: %v: %s", filePath, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if decodeErr != nil {
+		return VideoHash{}, decodeErr
+	}
+
+	if len(videoHash.Frames) == 0 {
+		return VideoHash{}, fmt.Errorf("no frames sampled from %s", filePath)
+	}
+
+	return videoHash, nil
+}
+
+// VideoSimilarity scores how alike two videos are from 0 to 1. The shorter frame sequence is slid
+// along the longer one, so a trimmed copy matches the part of the original it was cut from, and
+// the best alignment counts. At each alignment frames score by the share of their hash bits that
+// agree. Hashes sampled at different intervals can not be compared and score 0.
+func VideoSimilarity(a, b VideoHash) float64 {
+	if a.Interval != b.Interval || len(a.Frames) == 0 || len(b.Frames) == 0 {
+		return 0
+	}
+
+	shorter, longer := a.Frames, b.Frames
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+
+	best := 0.0
+	for offset := 0; offset+len(shorter) <= len(longer); offset++ {
+		var agreeing int
+		for i, frame := range shorter {
+			agreeing += 64 - HammingDistance(frame, longer[offset+i])
+		}
+
+		if score := float64(agreeing) / float64(64*len(shorter)); score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+// SimilarVideos checks if the similarity of two videos reaches threshold, DefaultVideoSimilarity being a sensible start.
+func SimilarVideos(a, b VideoHash, threshold float64) bool {
+	return VideoSimilarity(a, b) >= threshold
+}
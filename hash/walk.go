@@ -0,0 +1,101 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/mediatype"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// walkCandidates walks root and calls fn for every file that passes the filters of opts.
+// For followed symlinks the info describes the link target.
+func walkCandidates(root string, opts Options, fn func(filePath string, info os.FileInfo) error) error {
+	excludePaths, err := absolutePaths(opts.ExcludePaths)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err := opts.context().Err(); err != nil {
+			return err
+		}
+
+		if err != nil {
+			walkErr := fmt.Errorf("failed to walk path %s: %v", filePath, err)
+			// Only paths below the root are skipped, a root that can not be walked fails the scan.
+			if opts.FailFast || opts.onWalkError == nil || filePath == root {
+				return walkErr
+			}
+
+			opts.onWalkError(&FileError{Path: opts.outputPath(root, filePath), Err: walkErr})
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() && opts.MaxDepth > 0 && pathDepth(root, filePath) >= opts.MaxDepth {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && len(excludePaths) > 0 {
+			absPath, err := filepath.Abs(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to resolve path %s: %v", filePath, err)
+			}
+
+			for _, excludePath := range excludePaths {
+				if pathsafe.Within(excludePath, absPath) {
+					return filepath.SkipDir
+				}
+			}
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !includeSymlink(filePath, opts.SymlinkFiles) {
+				return nil
+			}
+
+			if opts.SymlinkFiles == SymlinkHashTarget {
+				if info, err = os.Stat(filePath); err != nil {
+					return nil
+				}
+			}
+		} else if info.IsDir() {
+			return nil
+		}
+
+		if len(opts.AllowedMimeTypes) == 0 && !mediatype.HasMediaExtension(filePath) {
+			return nil
+		}
+
+		return fn(filePath, info)
+	})
+}
+
+// absolutePaths resolves every path to a clean absolute path.
+func absolutePaths(paths []string) ([]string, error) {
+	absPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path %s: %v", path, err)
+		}
+		absPaths = append(absPaths, absPath)
+	}
+
+	return absPaths, nil
+}
+
+// pathDepth returns how many levels filePath lies below root, root itself being level 0.
+func pathDepth(root, filePath string) int {
+	relPath, err := filepath.Rel(root, filePath)
+	if err != nil || relPath == "." {
+		return 0
+	}
+
+	return strings.Count(relPath, string(filepath.Separator)) + 1
+}
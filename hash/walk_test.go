@@ -0,0 +1,39 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkWalkCandidates walks a tree of media and other files, reporting the allocations made per walk.
+func BenchmarkWalkCandidates(b *testing.B) {
+	root := b.TempDir()
+	for dir := 0; dir < 20; dir++ {
+		dirPath := filepath.Join(root, fmt.Sprintf("%04d", 2000+dir))
+		if err := os.Mkdir(dirPath, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for file := 0; file < 100; file++ {
+			name := fmt.Sprintf("IMG_%04d.jpg", file)
+			if file%4 == 0 {
+				name = fmt.Sprintf("notes_%04d.txt", file)
+			}
+			if err := os.WriteFile(filepath.Join(dirPath, name), nil, 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := walkCandidates(root, Options{}, func(filePath string, info os.FileInfo) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
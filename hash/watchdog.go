@@ -0,0 +1,79 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrReadTimeout is returned when reading a file made no progress within the read timeout.
+var ErrReadTimeout = errors.New("read timed out")
+
+// watchedReader reports every read to a watchdog and stops reading once its context is cancelled.
+type watchedReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	progress chan<- struct{}
+}
+
+func (r *watchedReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+
+	select {
+	case r.progress <- struct{}{}:
+	default:
+	}
+
+	return n, err
+}
+
+// calculateFileHashesWatched hashes the file in its own goroutine and abandons it when a read stalls
+// for longer than timeout. A read blocked in the kernel can not be interrupted, so the abandoned
+// goroutine only exits once that read returns, but the caller is free to move on.
+func calculateFileHashesWatched(filePath string, algos []HashAlgorithm, opts Options) (map[HashAlgorithm][]byte, error) {
+	timeout := opts.ReadTimeout
+
+	ctx, cancel := context.WithCancel(opts.context())
+	defer cancel()
+
+	type hashResult struct {
+		hashes map[HashAlgorithm][]byte
+		err    error
+	}
+
+	progress := make(chan struct{}, 1)
+	done := make(chan hashResult, 1)
+
+	go func() {
+		hashes, err := readFileHashes(ctx, filePath, algos, progress, opts)
+		done <- hashResult{hashes: hashes, err: err}
+	}()
+
+	interval := timeout / 4
+	if interval <= 0 {
+		interval = timeout
+	}
+
+	watchdog := time.NewTicker(interval)
+	defer watchdog.Stop()
+
+	lastProgress := time.Now()
+	for {
+		select {
+		case result := <-done:
+			return result.hashes, result.err
+		case <-progress:
+			lastProgress = time.Now()
+		case <-watchdog.C:
+			if time.Since(lastProgress) >= timeout {
+				return nil, fmt.Errorf("%w after %v: %s", ErrReadTimeout, timeout, filePath)
+			}
+		}
+	}
+}
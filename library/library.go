@@ -0,0 +1,232 @@
+package library
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// capturedLayout is how capture dates are stored, in the local time of the camera like EXIF writes them.
+const capturedLayout = "2006-01-02 15:04:05"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS files (
+	path        TEXT PRIMARY KEY,
+	hash        TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	modified    INTEGER NOT NULL,
+	captured    TEXT NOT NULL,
+	date_source TEXT NOT NULL,
+	type        TEXT NOT NULL,
+	make        TEXT NOT NULL,
+	model       TEXT NOT NULL,
+	country     TEXT NOT NULL,
+	city        TEXT NOT NULL,
+	latitude    REAL,
+	longitude   REAL
+);
+CREATE INDEX IF NOT EXISTS files_hash ON files (hash);
+CREATE INDEX IF NOT EXISTS files_captured ON files (captured);
+`
+
+// columns are the columns of the files table in the order File is scanned from.
+const columns = "path, hash, size, modified, captured, date_source, type, make, model, country, city, latitude, longitude"
+
+// File is a file of the library as the index records it.
+type File struct {
+	Path       string    `json:"path"`
+	Hash       string    `json:"hash"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	Captured   time.Time `json:"captured"`
+	DateSource string    `json:"dateSource"`
+	// Type is "image", "video" or "other".
+	Type    string `json:"type"`
+	Make    string `json:"make,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	// HasLocation tells if Latitude and Longitude hold the GPS coordinates of the file.
+	HasLocation bool    `json:"hasLocation"`
+	Latitude    float64 `json:"latitude,omitempty"`
+	Longitude   float64 `json:"longitude,omitempty"`
+}
+
+// Query selects files of the index. Empty fields match every file.
+type Query struct {
+	// Year matches the files captured in that year.
+	Year int
+	// Camera matches the files whose camera make or model contains it, ignoring case.
+	Camera  string
+	Country string
+	City    string
+	Type    string
+	// Duplicates matches only the files whose hash more than one file of the index has.
+	Duplicates bool
+}
+
+// Index is a SQLite database of the files of a library.
+type Index struct {
+	db *sql.DB
+}
+
+// Open opens the index at path, creating it when it does not exist.
+func Open(path string) (*Index, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s: %v", path, err)
+	}
+
+	// A single connection serialises the writers, which SQLite would otherwise fail as busy.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open index %s: %v", path, err)
+	}
+
+	return &Index{db: db}, nil
+}
+
+// Close closes the database of the index.
+func (index *Index) Close() error {
+	return index.db.Close()
+}
+
+// Put records file, replacing what was recorded for its path.
+func (index *Index) Put(file File) error {
+	var latitude, longitude sql.NullFloat64
+	if file.HasLocation {
+		latitude = sql.NullFloat64{Float64: file.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: file.Longitude, Valid: true}
+	}
+
+	_, err := index.db.Exec("INSERT OR REPLACE INTO files ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		file.Path, file.Hash, file.Size, file.Modified.UnixNano(), file.Captured.Format(capturedLayout), file.DateSource,
+		file.Type, file.Make, file.Model, file.Country, file.City, latitude, longitude)
+	if err != nil {
+		return fmt.Errorf("failed to index %s: %v", file.Path, err)
+	}
+
+	return nil
+}
+
+// Remove forgets the file at path.
+func (index *Index) Remove(path string) error {
+	if _, err := index.db.Exec("DELETE FROM files WHERE path = ?", path); err != nil {
+		return fmt.Errorf("failed to remove %s from index: %v", path, err)
+	}
+
+	return nil
+}
+
+// Lookup returns what is recorded for the file at path, and false when it is not indexed.
+func (index *Index) Lookup(path string) (File, bool, error) {
+	files, err := index.query("SELECT "+columns+" FROM files WHERE path = ?", path)
+	if err != nil || len(files) == 0 {
+		return File{}, false, err
+	}
+
+	return files[0], true, nil
+}
+
+// Paths returns the paths of every indexed file.
+func (index *Index) Paths() ([]string, error) {
+	rows, err := index.db.Query("SELECT path FROM files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to read index: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// Find returns the files matching query, ordered by capture date, or by hash for duplicates.
+func (index *Index) Find(query Query) ([]File, error) {
+	var conditions []string
+	var args []any
+
+	if query.Year != 0 {
+		conditions = append(conditions, "captured LIKE ?")
+		args = append(args, fmt.Sprintf("%04d-%%", query.Year))
+	}
+	if query.Camera != "" {
+		conditions = append(conditions, "(make || ' ' || model) LIKE ?")
+		args = append(args, "%"+query.Camera+"%")
+	}
+	if query.Country != "" {
+		conditions = append(conditions, "country LIKE ?")
+		args = append(args, query.Country)
+	}
+	if query.City != "" {
+		conditions = append(conditions, "city LIKE ?")
+		args = append(args, query.City)
+	}
+	if query.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, query.Type)
+	}
+	if query.Duplicates {
+		conditions = append(conditions, "hash IN (SELECT hash FROM files GROUP BY hash HAVING COUNT(*) > 1)")
+	}
+
+	statement := "SELECT " + columns + " FROM files"
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if query.Duplicates {
+		statement += " ORDER BY hash, path"
+	} else {
+		statement += " ORDER BY captured, path"
+	}
+
+	return index.query(statement, args...)
+}
+
+// query runs statement, which selects the columns of File.
+func (index *Index) query(statement string, args ...any) ([]File, error) {
+	rows, err := index.db.Query(statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query index: %v", err)
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var file File
+		var modified int64
+		var captured string
+		var latitude, longitude sql.NullFloat64
+
+		err := rows.Scan(&file.Path, &file.Hash, &file.Size, &modified, &captured, &file.DateSource,
+			&file.Type, &file.Make, &file.Model, &file.Country, &file.City, &latitude, &longitude)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query index: %v", err)
+		}
+
+		file.Modified = time.Unix(0, modified)
+		file.Captured, _ = time.ParseInLocation(capturedLayout, captured, time.Local)
+		if latitude.Valid && longitude.Valid {
+			file.HasLocation, file.Latitude, file.Longitude = true, latitude.Float64, longitude.Float64
+		}
+
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query index: %v", err)
+	}
+
+	return files, nil
+}
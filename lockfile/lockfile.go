@@ -0,0 +1,63 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Name is the file created inside a locked directory.
+const Name = ".mediarizer.lock"
+
+// ErrLocked is returned when another process already holds the lock.
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is an exclusive advisory lock on a directory, held until Release or the process exits.
+type Lock struct {
+	file *os.File
+	path string
+}
+
+// Acquire locks the directory dir, waiting for another holder to release it when wait is set
+// and failing with ErrLocked otherwise.
+func Acquire(dir string, wait bool) (*Lock, error) {
+	path := filepath.Join(dir, Name)
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %v", path, err)
+	}
+
+	if err := lockFile(file, wait); err != nil {
+		file.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+
+	return &Lock{file: file, path: path}, nil
+}
+
+// Release gives up the lock, it is safe to call more than once.
+// The lock file itself is left in place, removing it would let two processes lock different files.
+func (lock *Lock) Release() error {
+	if lock.file == nil {
+		return nil
+	}
+
+	file := lock.file
+	lock.file = nil
+
+	unlockErr := unlockFile(file)
+	if err := file.Close(); err != nil && unlockErr == nil {
+		unlockErr = err
+	}
+
+	if unlockErr != nil {
+		return fmt.Errorf("failed to release lock %s: %v", lock.path, unlockErr)
+	}
+
+	return nil
+}
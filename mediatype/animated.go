@@ -0,0 +1,172 @@
+package mediatype
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// webpAnimationFlag is the bit of the VP8X chunk flags set for animated WebP images.
+const webpAnimationFlag = 0x02
+
+// IsAnimated checks if the GIF, PNG or WebP image at path holds an animation rather than a single
+// frame, reading only as far as it takes to tell. Images of any other format are not animated.
+func IsAnimated(path string) (bool, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".gif" && ext != ".png" && ext != ".webp" {
+		return false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var animated bool
+	switch ext {
+	case ".gif":
+		animated, err = isAnimatedGIF(reader)
+	case ".png":
+		animated, err = isAnimatedPNG(reader)
+	case ".webp":
+		animated, err = isAnimatedWebP(reader)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read image %v: %v", path, err)
+	}
+
+	return animated, nil
+}
+
+// isAnimatedGIF walks the blocks of a GIF until it finds a second frame or the trailer.
+func isAnimatedGIF(reader *bufio.Reader) (bool, error) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return false, err
+	}
+	if string(header[:3]) != "GIF" {
+		return false, fmt.Errorf("no GIF header found")
+	}
+
+	if err := skipColorTable(reader, header[10]); err != nil {
+		return false, err
+	}
+
+	frames := 0
+	for {
+		marker, err := reader.ReadByte()
+		if err != nil {
+			return false, err
+		}
+
+		switch marker {
+		case 0x21: // extension, a label followed by sub-blocks
+			if _, err := reader.ReadByte(); err != nil {
+				return false, err
+			}
+		case 0x2c: // image descriptor, followed by a color table, the LZW code size and sub-blocks
+			if frames++; frames > 1 {
+				return true, nil
+			}
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(reader, descriptor); err != nil {
+				return false, err
+			}
+			if err := skipColorTable(reader, descriptor[8]); err != nil {
+				return false, err
+			}
+			if _, err := reader.ReadByte(); err != nil {
+				return false, err
+			}
+		case 0x3b: // trailer
+			return false, nil
+		default:
+			return false, fmt.Errorf("invalid GIF block %#x", marker)
+		}
+
+		if err := skipSubBlocks(reader); err != nil {
+			return false, err
+		}
+	}
+}
+
+// skipColorTable skips the color table the flags of a GIF screen or image descriptor announce.
+func skipColorTable(reader *bufio.Reader, flags byte) error {
+	if flags&0x80 == 0 {
+		return nil
+	}
+
+	_, err := reader.Discard(3 << ((flags & 0x07) + 1))
+	return err
+}
+
+// skipSubBlocks skips GIF sub-blocks up to the empty one ending them.
+func skipSubBlocks(reader *bufio.Reader) error {
+	for {
+		size, err := reader.ReadByte()
+		if err != nil {
+			return err
+		} else if size == 0 {
+			return nil
+		}
+
+		if _, err := reader.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// isAnimatedPNG checks if a PNG holds an animation control chunk, which APNG writes before the image data.
+func isAnimatedPNG(reader *bufio.Reader) (bool, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(reader, signature); err != nil {
+		return false, err
+	}
+	if !bytes.Equal(signature, pngSignature) {
+		return false, fmt.Errorf("no PNG signature found")
+	}
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, chunkHeader); err != nil {
+			return false, err
+		}
+
+		switch string(chunkHeader[4:]) {
+		case "acTL":
+			return true, nil
+		case "IDAT", "IEND":
+			return false, nil
+		}
+
+		// The chunk data is followed by its CRC.
+		if _, err := reader.Discard(int(binary.BigEndian.Uint32(chunkHeader[:4])) + 4); err != nil {
+			return false, err
+		}
+	}
+}
+
+// isAnimatedWebP checks the animation flag of the extended format header of a WebP, simple WebP
+// images holding a single frame.
+func isAnimatedWebP(reader *bufio.Reader) (bool, error) {
+	header := make([]byte, 21)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return false, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return false, fmt.Errorf("no WebP header found")
+	}
+
+	return string(header[12:16]) == "VP8X" && header[20]&webpAnimationFlag != 0, nil
+}
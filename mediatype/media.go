@@ -0,0 +1,68 @@
+package mediatype
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tiff", ".heic", ".heif", ".webp", ".avif", ".arw", ".cr2", ".cr3", ".dng", ".nef", ".orf", ".raf", ".rw2"}
+
+var videoExtensions = []string{".mp4", ".mov", ".avi", ".mkv", ".m4v", ".webm", ".3gp"}
+
+// IsImage checks if the file at path is an image, sniffed from its first bytes and by its
+// extension when the content is not recognised.
+func IsImage(path string) (bool, error) {
+	mimeType, err := Detect(path)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.HasPrefix(mimeType, "image/"), nil
+}
+
+// IsVideo checks if the file at path is a video, sniffed like IsImage.
+func IsVideo(path string) (bool, error) {
+	mimeType, err := Detect(path)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.HasPrefix(mimeType, "video/"), nil
+}
+
+// IsMedia checks if the file at path is an image or a video, sniffed like IsImage.
+func IsMedia(path string) (bool, error) {
+	mimeType, err := Detect(path)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/"), nil
+}
+
+// HasImageExtension checks case-insensitively if path has a known image extension, without opening it.
+func HasImageExtension(path string) bool {
+	return hasExtension(path, imageExtensions)
+}
+
+// HasVideoExtension checks case-insensitively if path has a known video extension, without opening it.
+func HasVideoExtension(path string) bool {
+	return hasExtension(path, videoExtensions)
+}
+
+// HasMediaExtension checks case-insensitively if path has a known image or video extension, without opening it.
+func HasMediaExtension(path string) bool {
+	return HasImageExtension(path) || HasVideoExtension(path)
+}
+
+// hasExtension compares the extension of path to extensions without allocating.
+func hasExtension(path string, extensions []string) bool {
+	ext := filepath.Ext(path)
+	for _, extension := range extensions {
+		if strings.EqualFold(ext, extension) {
+			return true
+		}
+	}
+
+	return false
+}
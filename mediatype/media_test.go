@@ -0,0 +1,30 @@
+package mediatype
+
+import "testing"
+
+var extensionPaths = []string{
+	"/photos/2019/IMG_0001.JPG",
+	"/photos/2019/IMG_0002.heic",
+	"/photos/2019/VID_0003.mov",
+	"/photos/2019/notes.txt",
+	"/photos/2019/.DS_Store",
+	"/photos/2019/archive.tar.gz",
+}
+
+func TestHasMediaExtensionDoesNotAllocate(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, path := range extensionPaths {
+			HasMediaExtension(path)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("HasMediaExtension allocated %.1f times per run, want none", allocs)
+	}
+}
+
+func BenchmarkHasMediaExtension(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		HasMediaExtension(extensionPaths[i%len(extensionPaths)])
+	}
+}
@@ -0,0 +1,171 @@
+package mediatype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is the number of header bytes inspected to detect the content type.
+const sniffLength = 512
+
+// Detect returns the MIME type of the file at path, sniffed from its first bytes.
+// The extension is only consulted when the content is not recognised.
+func Detect(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	header, err := readHeader(file, path)
+	if err != nil {
+		return "", err
+	}
+
+	return DetectBytes(header, filepath.Ext(path)), nil
+}
+
+// Sniff returns the MIME type of the file at path recognised from its first bytes alone,
+// or an empty string when the content is not recognised.
+func Sniff(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	header, err := readHeader(file, path)
+	if err != nil {
+		return "", err
+	}
+
+	return sniffBytes(header), nil
+}
+
+// readHeader reads up to sniffLength bytes from the start of the file.
+func readHeader(file io.Reader, path string) ([]byte, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file %s: %v", path, err)
+	}
+
+	return header[:n], nil
+}
+
+// rawTypes are the MIME types of camera RAW formats by extension. Most of them are laid out as TIFF,
+// so they are told apart by their extension, which MIME tables of the system often lack.
+var rawTypes = map[string]string{
+	".arw": "image/x-sony-arw",
+	".cr2": "image/x-canon-cr2",
+	".cr3": "image/x-canon-cr3",
+	".dng": "image/x-adobe-dng",
+	".nef": "image/x-nikon-nef",
+	".orf": "image/x-olympus-orf",
+	".raf": "image/x-fuji-raf",
+	".rw2": "image/x-panasonic-rw2",
+}
+
+// DetectBytes returns the MIME type of a file from its header bytes, falling back to ext.
+func DetectBytes(header []byte, ext string) string {
+	if mimeType := sniffBytes(header); mimeType != "" {
+		return mimeType
+	}
+
+	if rawType, found := rawTypes[strings.ToLower(ext)]; found {
+		return rawType
+	}
+
+	if byExtension := mime.TypeByExtension(strings.ToLower(ext)); byExtension != "" {
+		return stripParameters(byExtension)
+	}
+
+	return stripParameters(http.DetectContentType(header))
+}
+
+// sniffBytes returns the MIME type recognised from the header bytes alone, or an empty string.
+func sniffBytes(header []byte) string {
+	if mimeType := sniffContainer(header); mimeType != "" {
+		return mimeType
+	}
+
+	mimeType := http.DetectContentType(header)
+	if mimeType != "application/octet-stream" && !strings.HasPrefix(mimeType, "text/plain") {
+		return stripParameters(mimeType)
+	}
+
+	return ""
+}
+
+// sniffContainer recognises the video and HEIF image containers that http.DetectContentType does not.
+func sniffContainer(header []byte) string {
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" {
+		switch string(header[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		}
+
+		if imageType := sniffHEIFBrands(header); imageType != "" {
+			return imageType
+		}
+	}
+
+	if len(header) >= 4 && header[0] == 0x1A && header[1] == 0x45 && header[2] == 0xDF && header[3] == 0xA3 {
+		if strings.Contains(string(header), "matroska") {
+			return "video/x-matroska"
+		}
+		return "video/webm"
+	}
+
+	return ""
+}
+
+// sniffHEIFBrands returns the image type named by the major or a compatible brand of the ftyp box
+// that header starts with. Many HEIC and AVIF files only name the generic HEIF brand as their major
+// brand, so the specific brands are looked for among all of them first.
+func sniffHEIFBrands(header []byte) string {
+	size := int(binary.BigEndian.Uint32(header[:4]))
+	if size < 16 || size > len(header) {
+		size = len(header)
+	}
+
+	var brands []string
+	brands = append(brands, string(header[8:12]))
+	for offset := 16; offset+4 <= size; offset += 4 {
+		brands = append(brands, string(header[offset:offset+4]))
+	}
+
+	for _, imageType := range []struct {
+		mimeType string
+		brands   []string
+	}{
+		{"image/avif", []string{"avif", "avis"}},
+		{"image/heic", []string{"heic", "heix", "heim", "heis", "hevc", "hevx"}},
+		{"image/heif", []string{"mif1", "msf1"}},
+	} {
+		for _, brand := range brands {
+			for _, imageBrand := range imageType.brands {
+				if brand == imageBrand {
+					return imageType.mimeType
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// stripParameters removes parameters such as the charset from a MIME type.
+func stripParameters(mimeType string) string {
+	if index := strings.Index(mimeType, ";"); index >= 0 {
+		return strings.TrimSpace(mimeType[:index])
+	}
+
+	return mimeType
+}
@@ -0,0 +1,119 @@
+package mediatype
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// preferredExtensions maps detected MIME types to the extension files of that type should carry.
+var preferredExtensions = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"image/bmp":        ".bmp",
+	"image/webp":       ".webp",
+	"image/heic":       ".heic",
+	"image/heif":       ".heif",
+	"image/avif":       ".avif",
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
+	"video/x-matroska": ".mkv",
+	"video/webm":       ".webm",
+	"video/avi":        ".avi",
+}
+
+// equivalentTypes maps MIME types naming the same format to one of them, as the MIME tables of
+// systems disagree on which they use.
+var equivalentTypes = map[string]string{
+	"image/heic": "image/heif",
+}
+
+// Mismatch is a file whose content is of a different type than its extension claims.
+type Mismatch struct {
+	Path string
+	// Claimed is the MIME type belonging to the extension of the file.
+	Claimed string
+	// Detected is the MIME type sniffed from the content of the file.
+	Detected string
+	// Extension is the extension matching the detected type, empty when none is known.
+	Extension string
+}
+
+// CheckExtension sniffs the file at path and reports whether its content disagrees with its extension.
+// Files of unrecognised content or with an unknown extension are never reported.
+func CheckExtension(path string) (Mismatch, bool, error) {
+	claimed := stripParameters(mime.TypeByExtension(strings.ToLower(filepath.Ext(path))))
+	if claimed == "" {
+		return Mismatch{}, false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return Mismatch{}, false, fmt.Errorf("failed to open file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	header, err := readHeader(file, path)
+	if err != nil {
+		return Mismatch{}, false, err
+	}
+
+	detected := sniffBytes(header)
+	if detected == "" || canonicalType(detected) == canonicalType(claimed) {
+		return Mismatch{}, false, nil
+	}
+
+	return Mismatch{Path: path, Claimed: claimed, Detected: detected, Extension: extensionFor(detected)}, true, nil
+}
+
+// FindMismatches checks every path and returns the mismatches ordered by path.
+func FindMismatches(paths []string) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	for _, path := range paths {
+		mismatch, found, err := CheckExtension(path)
+		if err != nil {
+			return nil, err
+		} else if found {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Path < mismatches[j].Path })
+
+	return mismatches, nil
+}
+
+// CorrectedPath returns the path of the mismatched file with the extension of its detected type.
+func (mismatch Mismatch) CorrectedPath() (string, error) {
+	if mismatch.Extension == "" {
+		return "", fmt.Errorf("no extension known for type %s of %s", mismatch.Detected, mismatch.Path)
+	}
+
+	return strings.TrimSuffix(mismatch.Path, filepath.Ext(mismatch.Path)) + mismatch.Extension, nil
+}
+
+// canonicalType returns the MIME type equivalentTypes maps mimeType to, or mimeType itself.
+func canonicalType(mimeType string) string {
+	if canonical, found := equivalentTypes[mimeType]; found {
+		return canonical
+	}
+
+	return mimeType
+}
+
+// extensionFor returns the extension files of mimeType should carry.
+func extensionFor(mimeType string) string {
+	if ext, found := preferredExtensions[mimeType]; found {
+		return ext
+	}
+
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,228 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrNoIdentifier is returned for files without the identifier asked for.
+var ErrNoIdentifier = errors.New("no identifier")
+
+// appleMakerNoteHeader starts the maker note of iPhone photos, followed by the version and byte order.
+var appleMakerNoteHeader = []byte("Apple iOS\x00")
+
+// Tags of the Apple maker note.
+const (
+	appleBurstUUIDTag         = 0x000b
+	appleContentIdentifierTag = 0x0011
+)
+
+// quickTimeContentIdentifierKey is the metadata key of the Live Photo a QuickTime video belongs to.
+const quickTimeContentIdentifierKey = "com.apple.quicktime.content.identifier"
+
+// Metadata keys of the device that recorded a video, written by iPhones and by Android phones.
+const (
+	quickTimeMakeKey  = "com.apple.quicktime.make"
+	quickTimeModelKey = "com.apple.quicktime.model"
+	androidMakeKey    = "com.android.manufacturer"
+	androidModelKey   = "com.android.model"
+)
+
+// quickTimeMetaLimit is the largest moov/meta box read when looking for metadata keys.
+const quickTimeMetaLimit = 1 << 20
+
+// ExtractContentIdentifier reads the identifier an iPhone gives both the still and the video of a
+// Live Photo, from the Apple maker note of the still or the metadata keys of the video.
+func ExtractContentIdentifier(path string) (string, error) {
+	if isQuickTimeFile(path) {
+		return readQuickTimeKey(path, quickTimeContentIdentifierKey)
+	}
+
+	return readAppleMakerNoteString(path, appleContentIdentifierTag)
+}
+
+// ExtractBurstIdentifier reads the identifier an iPhone gives every photo of a burst from its Apple maker note.
+func ExtractBurstIdentifier(path string) (string, error) {
+	return readAppleMakerNoteString(path, appleBurstUUIDTag)
+}
+
+// readAppleMakerNoteString reads the string value of tag from the Apple maker note of the file at path.
+func readAppleMakerNoteString(path string, tag uint16) (string, error) {
+	exifData, err := decodeExif(path)
+	if err != nil {
+		return "", err
+	}
+
+	makerNote, err := exifData.Get(exif.MakerNote)
+	if err != nil || !bytes.HasPrefix(makerNote.Val, appleMakerNoteHeader) {
+		return "", fmt.Errorf("%w: no Apple maker note in file %v", ErrNoIdentifier, path)
+	}
+
+	value, found := findAppleMakerNoteString(makerNote.Val, tag)
+	if !found {
+		return "", fmt.Errorf("%w: file %v", ErrNoIdentifier, path)
+	}
+
+	return value, nil
+}
+
+// findAppleMakerNoteString returns the ASCII value of tag in an Apple maker note, whose single
+// big-endian IFD follows the header 14 bytes in and whose offsets count from the start of the note.
+func findAppleMakerNoteString(note []byte, tag uint16) (string, bool) {
+	const ifdOffset = 14
+	if len(note) < ifdOffset+2 || string(note[12:14]) != "MM" {
+		return "", false
+	}
+
+	count := int(binary.BigEndian.Uint16(note[ifdOffset:]))
+	for i := 0; i < count; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(note) {
+			return "", false
+		}
+
+		// Only ASCII values are strings.
+		if binary.BigEndian.Uint16(note[entry:]) != tag || binary.BigEndian.Uint16(note[entry+2:]) != 2 {
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint32(note[entry+4:]))
+		start := entry + 8
+		if length > 4 {
+			start = int(binary.BigEndian.Uint32(note[entry+8:]))
+		}
+		if length <= 0 || start < 0 || start+length > len(note) {
+			return "", false
+		}
+
+		value := strings.TrimSpace(strings.TrimRight(string(note[start:start+length]), "\x00"))
+		return value, value != ""
+	}
+
+	return "", false
+}
+
+// readQuickTimeKey reads the string value of a key from the moov/meta box of a QuickTime video.
+func readQuickTimeKey(path, key string) (string, error) {
+	values, err := readQuickTimeKeys(path, key)
+	if err != nil {
+		return "", err
+	}
+
+	value, found := values[key]
+	if !found {
+		return "", fmt.Errorf("%w: file %v", ErrNoIdentifier, path)
+	}
+
+	return value, nil
+}
+
+// readQuickTimeKeys reads the string values of keys from the moov/meta box of a QuickTime video, where
+// a keys box names the keys and the items of an ilst box hold the values by the index of their key.
+// Keys the video does not hold are left out.
+func readQuickTimeKeys(path string, keys ...string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	moovOffset, moovSize, err := findBox(file, 0, info.Size(), "moov")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of file %v: %v", path, err)
+	}
+
+	metaOffset, metaSize, err := findBox(file, moovOffset, moovOffset+moovSize, "meta")
+	if err != nil || metaSize > quickTimeMetaLimit {
+		return nil, fmt.Errorf("%w: no metadata keys in file %v", ErrNoIdentifier, path)
+	}
+
+	meta := make([]byte, metaSize)
+	if _, err := file.ReadAt(meta, metaOffset); err != nil {
+		return nil, fmt.Errorf("failed to read metadata of file %v: %v", path, err)
+	}
+
+	// MP4 files write meta as a full box, with a version and flags before its boxes.
+	if len(meta) >= 8 && string(meta[4:8]) != "hdlr" {
+		meta = meta[4:]
+	}
+
+	boxes := splitBoxes(meta)
+	items := splitBoxes(boxes["ilst"])
+	values := make(map[string]string)
+
+	if keysBox := boxes["keys"]; len(keysBox) >= 8 {
+		count := int(binary.BigEndian.Uint32(keysBox[4:8]))
+		for i, offset := 1, 8; i <= count && offset+8 <= len(keysBox); i++ {
+			size := int(binary.BigEndian.Uint32(keysBox[offset:]))
+			if size < 8 || offset+size > len(keysBox) {
+				break
+			}
+
+			name := string(keysBox[offset+8 : offset+size])
+			offset += size
+			if !slices.Contains(keys, name) {
+				continue
+			}
+
+			var indexType [4]byte
+			binary.BigEndian.PutUint32(indexType[:], uint32(i))
+
+			// The data box holds a type and a locale before the value.
+			if data := splitBoxes(items[string(indexType[:])])["data"]; len(data) > 8 {
+				if value := strings.TrimSpace(string(data[8:])); value != "" {
+					values[name] = value
+				}
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// splitBoxes returns the payloads of the boxes data holds by their type, the first of every type.
+func splitBoxes(data []byte) map[string][]byte {
+	boxes := make(map[string][]byte)
+
+	for offset := 0; offset+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		if size < 8 || offset+size > len(data) {
+			break
+		}
+
+		boxType := string(data[offset+4 : offset+8])
+		if _, found := boxes[boxType]; !found {
+			boxes[boxType] = data[offset+8 : offset+size]
+		}
+		offset += size
+	}
+
+	return boxes
+}
+
+// extractVideoCamera reads the make and model of the phone that recorded the video at path.
+func extractVideoCamera(path string) (string, string, error) {
+	values, err := readQuickTimeKeys(path, quickTimeMakeKey, quickTimeModelKey, androidMakeKey, androidModelKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	cameraMake, cameraModel := values[quickTimeMakeKey], values[quickTimeModelKey]
+	if cameraMake == "" && cameraModel == "" {
+		cameraMake, cameraModel = values[androidMakeKey], values[androidModelKey]
+	}
+
+	return cameraMake, cameraModel, nil
+}
@@ -0,0 +1,192 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCaptureDate is returned by ResolveCaptureDate when none of the sources yields a date.
+var ErrNoCaptureDate = errors.New("no capture date")
+
+// DateSource is a place the capture date of a file is read from.
+type DateSource int
+
+const (
+	// DateEmbedded is the EXIF DateTimeOriginal of JPEG, TIFF, HEIC, AVIF, WebP and RAW images, or the movie header
+	// creation time of MP4 and MOV videos.
+	DateEmbedded DateSource = iota
+	// DateSidecar is the capture date in an XMP sidecar next to the file.
+	DateSidecar
+	// DateFilename is a date in the file name, as cameras and phones write it, such as IMG_20210314_153000.
+	DateFilename
+	// DateModTime is the modification time of the file, which copying or downloading may have reset.
+	DateModTime
+)
+
+// DefaultDateSources is the fallback chain used unless another one is configured.
+var DefaultDateSources = []DateSource{DateEmbedded, DateSidecar, DateFilename, DateModTime}
+
+var dateSourceNames = map[DateSource]string{
+	DateEmbedded: "exif",
+	DateSidecar:  "xmp",
+	DateFilename: "filename",
+	DateModTime:  "mtime",
+}
+
+func (source DateSource) String() string {
+	if name, found := dateSourceNames[source]; found {
+		return name
+	}
+
+	return fmt.Sprintf("DateSource(%d)", int(source))
+}
+
+// ParseDateSources parses a comma separated chain of date source names (exif, xmp, filename, mtime).
+func ParseDateSources(list string) ([]DateSource, error) {
+	var sources []DateSource
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+
+		found := false
+		for source, sourceName := range dateSourceNames {
+			if name == sourceName {
+				sources = append(sources, source)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown date source %q (exif, xmp, filename, mtime)", name)
+		}
+	}
+
+	return sources, nil
+}
+
+// ResolveCaptureDate tries the sources in order and returns the first date found with the source it
+// came from. When every source fails the error wraps ErrNoCaptureDate and the last failure.
+func ResolveCaptureDate(path string, sources []DateSource) (time.Time, DateSource, error) {
+	lastErr := fmt.Errorf("no date sources")
+
+	for _, source := range sources {
+		var date time.Time
+		var err error
+
+		switch source {
+		case DateEmbedded:
+			date, err = ExtractCaptureDate(path)
+		case DateSidecar:
+			date, err = ExtractSidecarDate(path)
+		case DateFilename:
+			date, err = ParseFilenameDate(filepath.Base(path))
+		case DateModTime:
+			var info os.FileInfo
+			if info, err = os.Stat(path); err == nil {
+				date = info.ModTime()
+			}
+		default:
+			err = fmt.Errorf("unknown date source %v", source)
+		}
+
+		if err == nil {
+			return date, source, nil
+		}
+		lastErr = err
+	}
+
+	return time.Time{}, 0, fmt.Errorf("%w for file %v: %v", ErrNoCaptureDate, path, lastErr)
+}
+
+// sidecarDatePattern matches the capture date properties of XMP, written as attributes or elements.
+var sidecarDatePattern = regexp.MustCompile(`(exif:DateTimeOriginal|photoshop:DateCreated|xmp:CreateDate)(?:="([^"]+)"|>([^<]+)<)`)
+
+// sidecarDatePriority orders the XMP properties from the most to the least specific.
+var sidecarDatePriority = []string{"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"}
+
+// ExtractSidecarDate reads the capture date of the file at path from its XMP sidecar, named either
+// like the file with an .xmp extension added (IMG_1.jpg.xmp) or replacing its own (IMG_1.xmp).
+func ExtractSidecarDate(path string) (time.Time, error) {
+	withoutExt := strings.TrimSuffix(path, filepath.Ext(path))
+	candidates := []string{path + ".xmp", path + ".XMP", withoutExt + ".xmp", withoutExt + ".XMP"}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read sidecar %v: %v", candidate, err)
+		}
+
+		values := make(map[string]string)
+		for _, match := range sidecarDatePattern.FindAllStringSubmatch(string(data), -1) {
+			value := match[2] + match[3]
+			if _, found := values[match[1]]; !found {
+				values[match[1]] = strings.TrimSpace(value)
+			}
+		}
+
+		for _, property := range sidecarDatePriority {
+			if value, found := values[property]; found {
+				if date, err := parseXMPDate(value); err == nil {
+					return date, nil
+				}
+			}
+		}
+
+		return time.Time{}, fmt.Errorf("no capture date in sidecar %v", candidate)
+	}
+
+	return time.Time{}, fmt.Errorf("no sidecar for file %v", path)
+}
+
+// xmpDateLayouts are the forms of the XMP date type, from the most to the least precise.
+var xmpDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseXMPDate parses an XMP date, which is local time when it carries no zone.
+func parseXMPDate(value string) (time.Time, error) {
+	for _, layout := range xmpDateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported XMP date %q", value)
+}
+
+// filenameDatePattern matches a date of 1900 to 2099, optionally followed by a time, with or without separators.
+var filenameDatePattern = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)\d{2})[-_.]?(\d{2})[-_.]?(\d{2})(?:[-_ T.]?(\d{2})[-_.:]?(\d{2})[-_.:]?(\d{2}))?(?:[^0-9]|$)`)
+
+// ParseFilenameDate reads a capture date from a file name such as IMG_20210314_153000.jpg,
+// VID-20210314-WA0001.mp4 or 2021-03-14 15.30.00.jpg, in local time.
+func ParseFilenameDate(name string) (time.Time, error) {
+	for _, match := range filenameDatePattern.FindAllStringSubmatch(name, -1) {
+		parts := make([]int, 6)
+		for i, part := range match[1:] {
+			if part != "" {
+				parts[i], _ = strconv.Atoi(part)
+			}
+		}
+
+		date := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, time.Local)
+		// time.Date normalises out of range values, a changed field means the digits were no date.
+		if date.Year() == parts[0] && int(date.Month()) == parts[1] && date.Day() == parts[2] &&
+			date.Hour() == parts[3] && date.Minute() == parts[4] && date.Second() == parts[5] {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("no date in file name %v", name)
+}
@@ -0,0 +1,48 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// heifExifSearchLimit is how far into a HEIF file its EXIF block is searched for.
+const heifExifSearchLimit = 16 << 20
+
+// heifExtensions include AVIF, which stores its EXIF block in a HEIF container as well.
+var heifExtensions = []string{".heic", ".heif", ".hif", ".avif"}
+
+// exifHeaders start a raw EXIF block, in either byte order of the TIFF structure it holds.
+var exifHeaders = [][]byte{[]byte("Exif\x00\x00II*\x00"), []byte("Exif\x00\x00MM\x00*")}
+
+// isHEIFFile checks if the file is a HEIF image based on its extension.
+func isHEIFFile(path string) bool {
+	ext := filepath.Ext(path)
+	for _, heifExtension := range heifExtensions {
+		if strings.EqualFold(ext, heifExtension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findHEIFExif returns a reader positioned at the raw EXIF block of a HEIF image. The block is an
+// item of the image stored without compression, so it is found by its header rather than by
+// walking the item boxes.
+func findHEIFExif(file io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(io.LimitReader(file, heifExifSearchLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range exifHeaders {
+		if index := bytes.Index(data, header); index >= 0 {
+			return bytes.NewReader(data[index:]), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no EXIF block found")
+}
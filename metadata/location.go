@@ -0,0 +1,78 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrNoLocation is returned by ExtractLocation for files without GPS coordinates.
+var ErrNoLocation = errors.New("no GPS coordinates")
+
+// xmpSearchLimit is how far into a file its embedded XMP packet is searched for.
+const xmpSearchLimit = 256 << 10
+
+// cityPattern matches the city of the IPTC location XMP records, written as an attribute or element.
+var cityPattern = regexp.MustCompile(`photoshop:City(?:="([^"]*)"|>([^<]*)<)`)
+
+// ExtractLocation reads the GPS latitude and longitude of the file at path from its EXIF data.
+func ExtractLocation(path string) (float64, float64, error) {
+	exifData, err := decodeExif(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	latitude, longitude, err := exifData.LatLong()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w in file %v", ErrNoLocation, path)
+	}
+
+	return latitude, longitude, nil
+}
+
+// ExtractCity reads the city the file at path was taken in from the IPTC location photo applications
+// write to XMP, in a sidecar named like ExtractSidecarDate reads or embedded in the file itself. It
+// returns an empty string when neither names one.
+func ExtractCity(path string) (string, error) {
+	withoutExt := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, candidate := range []string{path + ".xmp", path + ".XMP", withoutExt + ".xmp", withoutExt + ".XMP"} {
+		data, err := os.ReadFile(candidate)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read sidecar %v: %v", candidate, err)
+		}
+
+		if city := findCity(data); city != "" {
+			return city, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, xmpSearchLimit))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %v: %v", path, err)
+	}
+
+	return findCity(data), nil
+}
+
+// findCity returns the first non-empty city of the XMP in data.
+func findCity(data []byte) string {
+	for _, match := range cityPattern.FindAllSubmatch(data, -1) {
+		if city := strings.TrimSpace(string(match[1]) + string(match[2])); city != "" {
+			return city
+		}
+	}
+
+	return ""
+}
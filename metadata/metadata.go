@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrUnsupportedFormat is returned when the file holds no metadata the readers of this package can parse.
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// ExtractCaptureDate reads the capture date of the file at path from its EXIF data, preferring
+// DateTimeOriginal, or from the movie header for QuickTime and MP4 videos.
+func ExtractCaptureDate(path string) (time.Time, error) {
+	if isQuickTimeFile(path) {
+		return ExtractVideoCaptureDate(path)
+	}
+
+	exifData, err := decodeExif(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	dateTime, err := exifData.DateTime()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read capture date of file %v: %v", path, err)
+	}
+
+	return dateTime, nil
+}
+
+// ExtractCamera reads the camera make and model of the file at path from its EXIF data, or for
+// QuickTime and MP4 videos the phone make and model from their metadata keys.
+func ExtractCamera(path string) (string, string, error) {
+	if isQuickTimeFile(path) {
+		return extractVideoCamera(path)
+	}
+
+	exifData, err := decodeExif(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	return exifString(exifData, exif.Make), exifString(exifData, exif.Model), nil
+}
+
+// ExtractOrientation reads the EXIF orientation of the file at path, 1 (upright) when it has none.
+func ExtractOrientation(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	exifData, err := exif.Decode(file)
+	if err != nil {
+		return 1, nil
+	}
+
+	tag, err := exifData.Get(exif.Orientation)
+	if err != nil {
+		return 1, nil
+	}
+
+	orientation, err := tag.Int(0)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1, nil
+	}
+
+	return orientation, nil
+}
+
+// decodeExif reads the EXIF data of the JPEG, TIFF, HEIF, AVIF, WebP or camera RAW file at path.
+// Files without readable EXIF data fail with an error wrapping ErrUnsupportedFormat.
+func decodeExif(path string) (*exif.Exif, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if isHEIFFile(path) {
+		reader, err = findHEIFExif(file)
+	} else if isWebPFile(path) {
+		reader, err = findWebPExif(file)
+	} else if isRawFile(path) {
+		reader, err = findRawExif(file, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode file %v: %v", ErrUnsupportedFormat, path, err)
+	}
+
+	exifData, err := exif.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode file %v: %v", ErrUnsupportedFormat, path, err)
+	}
+
+	return exifData, nil
+}
+
+// exifString returns the trimmed string value of an EXIF tag, or an empty string when it is missing.
+func exifString(exifData *exif.Exif, name exif.FieldName) string {
+	tag, err := exifData.Get(name)
+	if err != nil {
+		return ""
+	}
+
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rawExtensions are the camera RAW formats whose EXIF data is read, most of them being laid out as TIFF.
+var rawExtensions = []string{".arw", ".cr2", ".cr3", ".dng", ".nef", ".orf", ".raf", ".rw2"}
+
+// rawTIFFHeaders maps the headers Olympus and Panasonic RAW files start with to the TIFF header of the
+// same byte order, which they only replace the magic number of.
+var rawTIFFHeaders = map[string]string{
+	"IIRO":    "II*\x00",
+	"IIRS":    "II*\x00",
+	"MMOR":    "MM\x00*",
+	"IIU\x00": "II*\x00",
+}
+
+// rafMagic starts every Fujifilm RAF file.
+var rafMagic = []byte("FUJIFILMCCD-RAW ")
+
+// rafPreviewOffset is where a RAF header stores the offset and length of its embedded JPEG preview.
+const rafPreviewOffset = 84
+
+// cr3ExifSearchLimit is how far into a CR3 file its EXIF box is searched for.
+const cr3ExifSearchLimit = 1 << 20
+
+// isRawFile checks if the file is in a camera RAW format based on its extension.
+func isRawFile(path string) bool {
+	ext := filepath.Ext(path)
+	for _, rawExtension := range rawExtensions {
+		if strings.EqualFold(ext, rawExtension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findRawExif returns a reader positioned at the EXIF data of the RAW file at path, opened as file.
+func findRawExif(file *os.File, path string) (io.Reader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".raf":
+		return findRAFExif(file)
+	case ".cr3":
+		return findCR3Exif(file)
+	default:
+		return rawTIFFReader(file)
+	}
+}
+
+// rawTIFFReader returns a reader over a TIFF based RAW file, with the header of the formats that
+// change its magic number restored so it decodes as TIFF.
+func rawTIFFReader(file io.Reader) (io.Reader, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+
+	if tiffHeader, found := rawTIFFHeaders[string(header)]; found {
+		header = []byte(tiffHeader)
+	}
+
+	return io.MultiReader(bytes.NewReader(header), file), nil
+}
+
+// findRAFExif returns a reader over the JPEG preview a Fujifilm RAF file embeds, which carries the
+// EXIF data of the shot.
+func findRAFExif(file io.ReaderAt) (io.Reader, error) {
+	header := make([]byte, rafPreviewOffset+8)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(header, rafMagic) {
+		return nil, fmt.Errorf("no RAF header found")
+	}
+
+	offset := binary.BigEndian.Uint32(header[rafPreviewOffset:])
+	length := binary.BigEndian.Uint32(header[rafPreviewOffset+4:])
+
+	return io.NewSectionReader(file, int64(offset), int64(length)), nil
+}
+
+// findCR3Exif returns a reader positioned at the CMT1 box of a Canon CR3 file, which holds the
+// main image directory as a TIFF structure. It is found by its type rather than by walking the boxes.
+func findCR3Exif(file io.ReaderAt) (io.Reader, error) {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, cr3ExifSearchLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	if index := bytes.Index(data, []byte("CMT1")); index >= 0 {
+		return bytes.NewReader(data[index+4:]), nil
+	}
+
+	return nil, fmt.Errorf("no EXIF box found")
+}
@@ -0,0 +1,193 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quickTimeEpoch is the zero point of QuickTime and MP4 timestamps.
+var quickTimeEpoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var errNoCreationTime = errors.New("no creation time in movie header")
+
+// quickTimeExtensions are the video files stored in the QuickTime/ISO base media container.
+var quickTimeExtensions = []string{".mp4", ".mov", ".m4v", ".3gp"}
+
+// isQuickTimeFile checks if the file is a QuickTime or MP4 video based on its extension.
+func isQuickTimeFile(path string) bool {
+	ext := filepath.Ext(path)
+	for _, quickTimeExtension := range quickTimeExtensions {
+		if strings.EqualFold(ext, quickTimeExtension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExtractVideoCaptureDate reads the creation time of a QuickTime or MP4 video from its moov/mvhd box.
+func ExtractVideoCaptureDate(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	moovOffset, moovSize, err := findBox(file, 0, info.Size(), "moov")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read capture date of file %v: %v", path, err)
+	}
+
+	mvhdOffset, mvhdSize, err := findBox(file, moovOffset, moovOffset+moovSize, "mvhd")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read capture date of file %v: %v", path, err)
+	}
+
+	created, err := readMovieHeaderTime(file, mvhdOffset, mvhdSize)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read capture date of file %v: %v", path, err)
+	}
+
+	return created, nil
+}
+
+// findBox looks for the box named name among the boxes between start and end and returns
+// the offset and size of its payload.
+func findBox(file io.ReaderAt, start, end int64, name string) (int64, int64, error) {
+	header := make([]byte, 16)
+
+	for offset := start; offset+8 <= end; {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return 0, 0, fmt.Errorf("failed to read box at %d: %v", offset, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return 0, 0, fmt.Errorf("failed to read box at %d: %v", offset, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		if size < headerSize || offset+size > end {
+			return 0, 0, fmt.Errorf("invalid size of box %q at %d", boxType, offset)
+		}
+
+		if boxType == name {
+			return offset + headerSize, size - headerSize, nil
+		}
+
+		offset += size
+	}
+
+	return 0, 0, fmt.Errorf("no %s box found", name)
+}
+
+// readMovieHeaderTime reads the creation time from the payload of an mvhd box.
+func readMovieHeaderTime(file io.ReaderAt, offset, size int64) (time.Time, error) {
+	payload := make([]byte, 12)
+	if size < int64(len(payload)) {
+		return time.Time{}, fmt.Errorf("movie header too short")
+	}
+
+	if _, err := file.ReadAt(payload, offset); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read movie header: %v", err)
+	}
+
+	var seconds uint64
+	if payload[0] == 1 {
+		seconds = binary.BigEndian.Uint64(payload[4:12])
+	} else {
+		seconds = uint64(binary.BigEndian.Uint32(payload[4:8]))
+	}
+
+	if seconds == 0 {
+		return time.Time{}, errNoCreationTime
+	}
+
+	return time.Unix(quickTimeEpoch.Unix()+int64(seconds), 0).UTC(), nil
+}
+
+// ExtractVideoDimensions reads the width and height of the first video track of a QuickTime or MP4
+// video from its moov/trak/tkhd box, audio tracks having neither.
+func ExtractVideoDimensions(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open file %v: %v", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	moovOffset, moovSize, err := findBox(file, 0, info.Size(), "moov")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read dimensions of file %v: %v", path, err)
+	}
+
+	for offset, end := moovOffset, moovOffset+moovSize; offset < end; {
+		trakOffset, trakSize, err := findBox(file, offset, end, "trak")
+		if err != nil {
+			break
+		}
+		offset = trakOffset + trakSize
+
+		tkhdOffset, tkhdSize, err := findBox(file, trakOffset, trakOffset+trakSize, "tkhd")
+		if err != nil {
+			continue
+		}
+
+		width, height, err := readTrackHeaderDimensions(file, tkhdOffset, tkhdSize)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read dimensions of file %v: %v", path, err)
+		} else if width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("no video track found in file %v", path)
+}
+
+// readTrackHeaderDimensions reads the width and height, 16.16 fixed point numbers closing the payload
+// of a tkhd box, whose times are 64 bit from version 1 on.
+func readTrackHeaderDimensions(file io.ReaderAt, offset, size int64) (int, int, error) {
+	dimensionsOffset := int64(76)
+	version := make([]byte, 1)
+	if _, err := file.ReadAt(version, offset); err != nil {
+		return 0, 0, fmt.Errorf("failed to read track header: %v", err)
+	}
+	if version[0] == 1 {
+		dimensionsOffset = 88
+	}
+
+	if size < dimensionsOffset+8 {
+		return 0, 0, fmt.Errorf("track header too short")
+	}
+
+	dimensions := make([]byte, 8)
+	if _, err := file.ReadAt(dimensions, offset+dimensionsOffset); err != nil {
+		return 0, 0, fmt.Errorf("failed to read track header: %v", err)
+	}
+
+	return int(binary.BigEndian.Uint32(dimensions[:4]) >> 16), int(binary.BigEndian.Uint32(dimensions[4:]) >> 16), nil
+}
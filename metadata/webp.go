@@ -0,0 +1,43 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// isWebPFile checks if the file is a WebP image based on its extension.
+func isWebPFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".webp")
+}
+
+// findWebPExif returns a reader over the EXIF chunk of a WebP image, walking the chunks of its RIFF container.
+func findWebPExif(file io.Reader) (io.Reader, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return nil, fmt.Errorf("no WebP header found")
+	}
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, chunkHeader); err != nil {
+			return nil, fmt.Errorf("no EXIF chunk found")
+		}
+
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		if string(chunkHeader[:4]) == "EXIF" {
+			return io.LimitReader(file, size), nil
+		}
+
+		// Chunks are padded to an even size.
+		if _, err := io.CopyN(io.Discard, file, size+size%2); err != nil {
+			return nil, fmt.Errorf("failed to read chunk %q: %v", chunkHeader[:4], err)
+		}
+	}
+}
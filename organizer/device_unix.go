@@ -0,0 +1,13 @@
+//go:build !windows
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDeviceError checks if a rename failed because source and destination are on different devices.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
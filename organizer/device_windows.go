@@ -0,0 +1,16 @@
+//go:build windows
+
+package organizer
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNotSameDevice is the windows ERROR_NOT_SAME_DEVICE error code.
+const errorNotSameDevice = syscall.Errno(17)
+
+// isCrossDeviceError checks if a rename failed because source and destination are on different volumes.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice) || errors.Is(err, syscall.EXDEV)
+}
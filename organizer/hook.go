@@ -0,0 +1,54 @@
+package organizer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MediaType is the kind of media a file holds.
+type MediaType int
+
+const (
+	Image MediaType = iota + 1
+	Video
+)
+
+func (mediaType MediaType) String() string {
+	switch mediaType {
+	case Image:
+		return "image"
+	case Video:
+		return "video"
+	default:
+		return fmt.Sprintf("MediaType(%d)", int(mediaType))
+	}
+}
+
+// MediaMeta is what is known about a file when its destination is decided.
+type MediaMeta struct {
+	// Type is the kind of media of the file, zero for files that are neither images nor videos.
+	Type            MediaType
+	Created         time.Time
+	HasCreationDate bool
+	// Country is the country the file was taken in, empty when it is not looked up.
+	Country     string
+	Hash        []byte
+	IsDuplicate bool
+}
+
+// DestinationFunc decides where the file at src goes, returning its path relative to the destination.
+// An empty path leaves the file where it is.
+type DestinationFunc func(src string, meta MediaMeta) (string, error)
+
+// JoinDestination returns the path relPath names under destination, failing when it is absolute or
+// leaves destination, so no layout or hook places a file outside of it.
+func JoinDestination(destination, relPath string) (string, error) {
+	relPath = filepath.Clean(relPath)
+	if filepath.IsAbs(relPath) || filepath.VolumeName(relPath) != "" || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("destination path %s leaves %s", relPath, destination)
+	}
+
+	return filepath.Join(destination, relPath), nil
+}
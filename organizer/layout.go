@@ -0,0 +1,25 @@
+package organizer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Naming formats of month folders.
+const (
+	MonthWord     = "word"
+	MonthNumber   = "number"
+	MonthCombined = "combined"
+)
+
+// MonthName names the folder of month in format (word, number, combined), in words for any other format.
+func MonthName(month time.Month, format string) string {
+	switch format {
+	case MonthNumber:
+		return fmt.Sprintf("%02d", month)
+	case MonthCombined:
+		return fmt.Sprintf("%02d_%s", month, month.String())
+	default:
+		return month.String()
+	}
+}
@@ -0,0 +1,97 @@
+package organizer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// RenameMover is the default Mover, renaming files and copying them across filesystems unless
+// RenameOnly is set. Paths too long for windows are opened in their long form.
+type RenameMover struct {
+	RenameOnly bool
+	// Pace, when set, wraps the source of every copy across filesystems, such as to limit its rate.
+	Pace func(io.Reader) io.Reader
+	// Renamed, when set, counts the files moved by a rename rather than a copy.
+	Renamed *int64
+}
+
+func (mover RenameMover) Move(sourcePath, destinationPath string) error {
+	longSource, longDestination := pathsafe.Long(sourcePath), pathsafe.Long(destinationPath)
+
+	if err := os.MkdirAll(filepath.Dir(longDestination), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(destinationPath), err)
+	}
+
+	// Renaming replaces a file at the destination, which is never overwritten.
+	if _, err := os.Lstat(longDestination); err == nil {
+		return fmt.Errorf("failed to move file from %s to %s: destination exists", sourcePath, destinationPath)
+	}
+
+	err := os.Rename(longSource, longDestination)
+	if err == nil {
+		if mover.Renamed != nil {
+			atomic.AddInt64(mover.Renamed, 1)
+		}
+		return nil
+	} else if !isCrossDeviceError(err) {
+		return fmt.Errorf("failed to move file from %s to %s: %w", sourcePath, destinationPath, err)
+	} else if mover.RenameOnly {
+		return fmt.Errorf("moving %s to %s requires a cross-device copy, which rename-only mode forbids", sourcePath, destinationPath)
+	}
+
+	return mover.copyAndRemove(sourcePath, destinationPath)
+}
+
+// copyAndRemove copies the file to the destination, preserving its mode and modification time, and
+// removes the source.
+func (mover RenameMover) copyAndRemove(sourcePath, destinationPath string) error {
+	longSource, longDestination := pathsafe.Long(sourcePath), pathsafe.Long(destinationPath)
+
+	sourceFile, err := os.Open(longSource)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", sourcePath, err)
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	destinationFile, err := os.OpenFile(longDestination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, sourceInfo.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", destinationPath, err)
+	}
+
+	var source io.Reader = sourceFile
+	if mover.Pace != nil {
+		source = mover.Pace(sourceFile)
+	}
+
+	if _, err := io.Copy(destinationFile, source); err != nil {
+		destinationFile.Close()
+		os.Remove(longDestination)
+		return fmt.Errorf("failed to copy file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	if err := destinationFile.Close(); err != nil {
+		os.Remove(longDestination)
+		return fmt.Errorf("failed to copy file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	if err := os.Chtimes(longDestination, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
+		return fmt.Errorf("failed to preserve modification time of %s: %w", destinationPath, err)
+	}
+
+	sourceFile.Close()
+	if err := os.Remove(longSource); err != nil {
+		return fmt.Errorf("failed to remove source file %s: %w", sourcePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+package organizer
+
+// Mover moves a file to its destination, creating the folders it goes in.
+type Mover interface {
+	Move(sourcePath, destinationPath string) error
+}
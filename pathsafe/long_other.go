@@ -0,0 +1,8 @@
+//go:build !windows
+
+package pathsafe
+
+// Long returns path unchanged, only windows limits the length of paths below what filesystems allow.
+func Long(path string) string {
+	return path
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package pathsafe
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the length from which paths are given the long path prefix. Windows limits paths to 260
+// characters, MAX_PATH, and directories to 248 so there is room for a file name of 8.3 characters.
+const maxPath = 248
+
+// Long returns path in the form Windows opens past MAX_PATH, absolute and with the \\?\ prefix, or
+// \\?\UNC\ for network shares, when it is too long to be opened as it is. Shorter paths, and paths
+// that already have a prefix, are returned unchanged.
+func Long(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil || len(absPath) < maxPath {
+		return path
+	}
+
+	// Prefixed paths are passed to the filesystem as they are, so they must be clean and use backslashes.
+	if strings.HasPrefix(absPath, `\\`) {
+		return `\\?\UNC\` + absPath[2:]
+	}
+
+	return `\\?\` + absPath
+}
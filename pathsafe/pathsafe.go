@@ -0,0 +1,127 @@
+package pathsafe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxNameLength is the longest name, in bytes, Name returns. Most filesystems allow 255 bytes, or 255
+// UTF-16 code units on NTFS, which no name of 255 bytes exceeds.
+const MaxNameLength = 255
+
+// maxExtensionLength is the longest extension Name keeps when it shortens a name.
+const maxExtensionLength = 16
+
+// hashLength is the number of hex characters of the hash of the full name a shortened name ends in.
+const hashLength = 8
+
+// reservedNames are the device names Windows reserves, with any extension, in any case.
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM0", "COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT0", "LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// Name makes name a valid file or folder name on Windows, macOS and Linux. Unicode is normalized to
+// NFC, so a name read in the decomposed form macOS writes names the same file on every system, the
+// characters Windows forbids are replaced by underscores, control characters dropped, the trailing
+// spaces and dots Windows strips removed and reserved device names suffixed with an underscore.
+// Names longer than MaxNameLength are shortened, keeping their extension, and end in ~ and a hash of
+// the full name, so the same long name is always shortened alike and different ones stay apart.
+func Name(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, norm.NFC.String(name))
+	name = strings.TrimRight(strings.TrimSpace(name), " .")
+
+	stem, _, _ := strings.Cut(name, ".")
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(strings.TrimSpace(stem), reserved) {
+			name = stem + "_" + name[len(stem):]
+			break
+		}
+	}
+
+	if len(name) <= MaxNameLength {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtensionLength {
+		ext = ""
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:])[:hashLength]
+
+	// The name is cut at a character boundary, never in the middle of a multi-byte character.
+	stem = name[:len(name)-len(ext)]
+	cut := MaxNameLength - len(ext) - len(suffix)
+	for cut > 0 && !utf8.RuneStart(stem[cut]) {
+		cut--
+	}
+
+	return strings.TrimRight(stem[:cut], " .") + suffix + ext
+}
+
+// Path makes every component of path below root a valid name with Name, leaving root as it is given.
+// Components that are left empty become underscores. Paths outside root only have their last
+// component made valid.
+func Path(root, path string) string {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return filepath.Join(filepath.Dir(path), component(filepath.Base(path)))
+	}
+
+	components := strings.Split(relPath, string(filepath.Separator))
+	for i, name := range components {
+		components[i] = component(name)
+	}
+
+	return filepath.Join(append([]string{root}, components...)...)
+}
+
+// Within checks if path is root or lies inside it, comparing absolute paths. An empty root contains nothing.
+func Within(root, path string) bool {
+	if root == "" {
+		return false
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	relPath, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return false
+	}
+
+	return relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// component returns name made valid, or an underscore when nothing of it is left.
+func component(name string) string {
+	if name = Name(name); name == "" {
+		return "_"
+	}
+
+	return name
+}
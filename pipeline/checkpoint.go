@@ -0,0 +1,247 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+)
+
+// CheckpointInterval is how often a running checkpoint is written to disk.
+const CheckpointInterval = 30 * time.Second
+
+// checkpointVersion is the version of the checkpoint file format.
+const checkpointVersion = 1
+
+// checkpointFile identifies a completed source file, so a file replaced at the same path since is not skipped.
+type checkpointFile struct {
+	// Size is the size of the file once it was done, -1 when it was moved away or deleted.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+// checkpointState is the content of a checkpoint file.
+type checkpointState struct {
+	Version     int                       `json:"version"`
+	Source      string                    `json:"source"`
+	Destination string                    `json:"destination"`
+	Completed   map[string]checkpointFile `json:"completed"`
+	// Pending lists the source files found but not done yet when the checkpoint was written.
+	Pending []string `json:"pending"`
+}
+
+// Checkpoint records the source files a run has completed, so an interrupted run can be resumed
+// without redoing them. It is safe for concurrent use, and a nil Checkpoint records nothing.
+type Checkpoint struct {
+	// Path is the file the checkpoint is written to.
+	Path string
+
+	// saveMu serialises writing and removing the file, which is never written again once removed.
+	saveMu  sync.Mutex
+	removed bool
+
+	mu      sync.Mutex
+	state   checkpointState
+	pending map[string]bool
+}
+
+// NewCheckpoint creates an empty checkpoint of a run from sourcePath to destinationPath, written to path.
+func NewCheckpoint(path, sourcePath, destinationPath string) *Checkpoint {
+	return &Checkpoint{
+		Path: path,
+		state: checkpointState{
+			Version:     checkpointVersion,
+			Source:      checkpointKey(sourcePath),
+			Destination: checkpointKey(destinationPath),
+			Completed:   make(map[string]checkpointFile),
+		},
+		pending: make(map[string]bool),
+	}
+}
+
+// LoadCheckpoint reads the checkpoint at path, which must have been written by a run from sourcePath
+// to destinationPath.
+func LoadCheckpoint(path, sourcePath, destinationPath string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint %s: %v", path, err)
+	}
+	defer file.Close()
+
+	checkpoint := NewCheckpoint(path, sourcePath, destinationPath)
+
+	var state checkpointState
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %v", path, err)
+	}
+
+	if state.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported version %d of checkpoint %s", state.Version, path)
+	}
+	if state.Source != checkpoint.state.Source || state.Destination != checkpoint.state.Destination {
+		return nil, fmt.Errorf("checkpoint %s belongs to a run from %s to %s", path, state.Source, state.Destination)
+	}
+
+	if state.Completed != nil {
+		checkpoint.state.Completed = state.Completed
+	}
+	for _, pendingPath := range state.Pending {
+		checkpoint.pending[pendingPath] = true
+	}
+
+	return checkpoint, nil
+}
+
+// checkpointKey returns the absolute form of path the checkpoint records it by.
+func checkpointKey(path string) string {
+	if absolutePath, err := filepath.Abs(path); err == nil {
+		return absolutePath
+	}
+
+	return filepath.Clean(path)
+}
+
+// Completed returns the number of source files recorded as done.
+func (checkpoint *Checkpoint) Completed() int {
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	return len(checkpoint.state.Completed)
+}
+
+// isCompleted checks if the file at path was completed and has not changed since.
+func (checkpoint *Checkpoint) isCompleted(path string) bool {
+	if checkpoint == nil {
+		return false
+	}
+
+	checkpoint.mu.Lock()
+	file, found := checkpoint.state.Completed[checkpointKey(path)]
+	checkpoint.mu.Unlock()
+	if !found {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return info.Size() == file.Size && info.ModTime().Equal(file.ModTime)
+}
+
+// addPending records the source files the run is about to work on.
+func (checkpoint *Checkpoint) addPending(paths []string) {
+	if checkpoint == nil {
+		return
+	}
+
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	for _, path := range paths {
+		checkpoint.pending[checkpointKey(path)] = true
+	}
+}
+
+// complete records the file at path as done.
+func (checkpoint *Checkpoint) complete(path string) {
+	if checkpoint == nil {
+		return
+	}
+
+	file := checkpointFile{Size: -1}
+	if info, err := os.Stat(path); err == nil {
+		file = checkpointFile{Size: info.Size(), ModTime: info.ModTime()}
+	}
+
+	key := checkpointKey(path)
+
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	checkpoint.state.Completed[key] = file
+	delete(checkpoint.pending, key)
+}
+
+// Save writes the checkpoint to its path, replacing the previous one only once it is complete.
+func (checkpoint *Checkpoint) Save() error {
+	if checkpoint == nil {
+		return nil
+	}
+
+	checkpoint.saveMu.Lock()
+	defer checkpoint.saveMu.Unlock()
+	if checkpoint.removed {
+		return nil
+	}
+
+	checkpoint.mu.Lock()
+	state := checkpoint.state
+	state.Completed = make(map[string]checkpointFile, len(checkpoint.state.Completed))
+	for path, file := range checkpoint.state.Completed {
+		state.Completed[path] = file
+	}
+	state.Pending = make([]string, 0, len(checkpoint.pending))
+	for path := range checkpoint.pending {
+		state.Pending = append(state.Pending, path)
+	}
+	checkpoint.mu.Unlock()
+
+	sort.Strings(state.Pending)
+
+	err := atomicfile.Write(checkpoint.Path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(state)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %v", checkpoint.Path, err)
+	}
+
+	return nil
+}
+
+// Remove deletes the checkpoint file once there is nothing left to resume.
+func (checkpoint *Checkpoint) Remove() error {
+	if checkpoint == nil {
+		return nil
+	}
+
+	checkpoint.saveMu.Lock()
+	defer checkpoint.saveMu.Unlock()
+	checkpoint.removed = true
+
+	if err := os.Remove(checkpoint.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint %s: %v", checkpoint.Path, err)
+	}
+
+	return nil
+}
+
+// SaveEvery writes the checkpoint every interval until stop is closed.
+func (checkpoint *Checkpoint) SaveEvery(interval time.Duration, stop <-chan struct{}) {
+	if checkpoint == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := checkpoint.Save(); err != nil {
+				logger(LoggerTypeWarning, err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Timezones are looked up on systems without a timezone database too, such as windows.
+	_ "time/tzdata"
+
+	"github.com/keybraker/mediarizer-2/metadata"
+)
+
+// DateCorrection corrects the capture dates of cameras whose clock was off or set to another timezone,
+// changing where files are organised without rewriting their metadata.
+type DateCorrection struct {
+	// offset is added to the dates read from files, but not to modification times.
+	offset time.Duration
+	// location, when set, is the timezone dates written without one are taken to be in, and the one
+	// every other date is converted to.
+	location *time.Location
+	// cameraOffsets are added on top of offset for the files of a camera, keyed by its lower cased
+	// model, make and model, or alias.
+	cameraOffsets map[string]time.Duration
+}
+
+// ParseDateCorrection checks the offset, timezone name and comma separated camera=offset list of a
+// DateCorrection, an empty timezone leaving the dates in their own.
+func ParseDateCorrection(offset time.Duration, timezone, cameraOffsets string) (DateCorrection, error) {
+	correction := DateCorrection{offset: offset}
+
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return DateCorrection{}, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+		}
+		correction.location = location
+	}
+
+	for _, rule := range strings.Split(cameraOffsets, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+
+		camera, value, found := strings.Cut(rule, "=")
+		camera = strings.ToLower(strings.TrimSpace(camera))
+		if !found || camera == "" {
+			return DateCorrection{}, fmt.Errorf("invalid camera offset %q, expected camera=offset", rule)
+		}
+
+		cameraOffset, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return DateCorrection{}, fmt.Errorf("invalid offset of camera %q: %v", camera, err)
+		}
+
+		if correction.cameraOffsets == nil {
+			correction.cameraOffsets = make(map[string]time.Duration)
+		}
+		correction.cameraOffsets[camera] = cameraOffset
+	}
+
+	return correction, nil
+}
+
+// apply corrects the capture date of the file at path read from source. Dates written without a
+// timezone, which are read as local time, keep their clock time in the assumed timezone, while dates
+// of a known instant, such as the UTC times of videos and modification times, are converted to it.
+func (correction DateCorrection) apply(path string, date time.Time, source metadata.DateSource) time.Time {
+	if correction.location != nil {
+		if source != metadata.DateModTime && date.Location() == time.Local {
+			date = time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), correction.location)
+		} else {
+			date = date.In(correction.location)
+		}
+	}
+
+	// Modification times come from the clock of the computer that wrote the file, not of the camera.
+	if source == metadata.DateModTime {
+		return date
+	}
+
+	return date.Add(correction.offset + correction.cameraOffset(path))
+}
+
+// cameraOffset returns the offset of the camera that took the file at path, zero for cameras, and
+// files, without one.
+func (correction DateCorrection) cameraOffset(path string) time.Duration {
+	if len(correction.cameraOffsets) == 0 {
+		return 0
+	}
+
+	cameraMake, cameraModel, err := metadata.ExtractCamera(path)
+	if err != nil {
+		return 0
+	}
+
+	for _, camera := range []string{cameraModel, cameraMake + " " + cameraModel, cameraAlias(cameraModel)} {
+		if offset, found := correction.cameraOffsets[strings.ToLower(strings.TrimSpace(camera))]; found {
+			return offset
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// Strategies for a file whose destination path is already taken by another file.
+const (
+	CollisionRenameSuffix         = "rename-suffix"
+	CollisionRenameHash           = "rename-hash"
+	CollisionSkip                 = "skip"
+	CollisionOverwriteIfIdentical = "overwrite-if-identical"
+)
+
+// errCollisionSkipped is returned for files left in place because their destination path is taken.
+var errCollisionSkipped = errors.New("destination path is taken")
+
+// IsCollisionStrategy checks if name is one of the collision strategies.
+func IsCollisionStrategy(name string) bool {
+	switch name {
+	case CollisionRenameSuffix, CollisionRenameHash, CollisionSkip, CollisionOverwriteIfIdentical:
+		return true
+	default:
+		return false
+	}
+}
+
+// FileExists checks if a file exists at path.
+func FileExists(path string) (bool, error) {
+	_, err := os.Stat(pathsafe.Long(path))
+	if err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("failed to check destination file %s: %v", path, err)
+}
+
+// ResolveCollision returns the path the file at sourcePath goes to in place of destinationPath when
+// taken reports it taken, following strategy. With overwrite-if-identical it also reports whether the
+// file on disk there has identical content, which then stands in for the source and is kept as it is.
+// Renaming with the hash, or a source that differs from the file it would overwrite, falls back to
+// numbering the name when that is taken too. Skipped files fail with errCollisionSkipped.
+func ResolveCollision(sourcePath, destinationPath, strategy string, taken func(path string) (bool, error)) (string, bool, error) {
+	isTaken, err := taken(destinationPath)
+	if err != nil {
+		return "", false, err
+	} else if !isTaken {
+		return destinationPath, false, nil
+	}
+
+	switch strategy {
+	case CollisionSkip:
+		return "", false, fmt.Errorf("%w: %s", errCollisionSkipped, destinationPath)
+	case CollisionOverwriteIfIdentical:
+		// Paths a dry run has only planned to take hold no file to compare with.
+		if onDisk, err := FileExists(destinationPath); err != nil {
+			return "", false, err
+		} else if onDisk {
+			identical, err := hash.Are(sourcePath, destinationPath)
+			if err != nil {
+				return "", false, err
+			} else if identical {
+				return destinationPath, true, nil
+			}
+		}
+	case CollisionRenameHash:
+		hashValue, err := hash.GetFileHash(sourcePath, &sync.Map{})
+		if err != nil {
+			return "", false, fmt.Errorf("failed to get file hash for %s: %v", sourcePath, err)
+		}
+
+		ext := filepath.Ext(destinationPath)
+		destinationPath = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(destinationPath, ext), hex.EncodeToString(hashValue)[:flatHashPrefixLength], ext)
+		if isTaken, err := taken(destinationPath); err != nil {
+			return "", false, err
+		} else if !isTaken {
+			return destinationPath, false, nil
+		}
+	}
+
+	ext := filepath.Ext(destinationPath)
+	nameWithoutExtension := destinationPath[:len(destinationPath)-len(ext)]
+
+	for counter := 1; ; counter++ {
+		newPath := fmt.Sprintf("%s_%d%s", nameWithoutExtension, counter, ext)
+		if isTaken, err := taken(newPath); err != nil {
+			return "", false, err
+		} else if !isTaken {
+			return newPath, false, nil
+		}
+	}
+}
+
+// destinationClaims holds the destination paths consumer workers are transferring files to, which are
+// taken before the file appears on disk, so two workers never pick the same free name.
+type destinationClaims struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+}
+
+// claimedDestinations are the destination paths of the transfers in progress.
+var claimedDestinations = &destinationClaims{claimed: make(map[string]bool)}
+
+// taken checks if path is claimed by a transfer in progress or exists on disk, for ResolveCollision.
+func (claims *destinationClaims) taken(path string) (bool, error) {
+	claims.mu.Lock()
+	claimed := claims.claimed[path]
+	claims.mu.Unlock()
+	if claimed {
+		return true, nil
+	}
+
+	return FileExists(path)
+}
+
+// claim takes path for a transfer unless another transfer claimed it or a file exists there since it
+// was found free, reporting whether it was taken.
+func (claims *destinationClaims) claim(path string) (bool, error) {
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+
+	if claims.claimed[path] {
+		return false, nil
+	}
+	if exists, err := FileExists(path); err != nil || exists {
+		return false, err
+	}
+	claims.claimed[path] = true
+
+	return true, nil
+}
+
+// release frees path once its transfer is over, the file then holding it on disk.
+func (claims *destinationClaims) release(path string) {
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+
+	delete(claims.claimed, path)
+}
@@ -0,0 +1,478 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/duplicate"
+	"github.com/keybraker/mediarizer-2/organizer"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+	"github.com/keybraker/mediarizer-2/progress"
+	"github.com/keybraker/mediarizer-2/report"
+)
+
+// flatHashPrefixLength is the number of hex characters of the content hash used in flat file names.
+const flatHashPrefixLength = 12
+
+// CorruptedFolderName is the folder of the output directory corrupt files are quarantined into.
+const CorruptedFolderName = "Corrupted"
+
+func consumer(ctx context.Context, stage *organiseStage, done chan<- struct{}) {
+	var wg sync.WaitGroup
+	numWorkers := stage.throttle.workerCount()
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileInfo := range stage.fileQueue {
+				// Files queued before the run was cancelled are drained without being moved.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				started := time.Now()
+				processFileInfo(fileInfo, stage)
+
+				logStructured(slog.LevelDebug, "file processed", "path", fileInfo.Path, "duration", time.Since(started))
+				stage.tracker.Add(progress.FilesProcessed, 1, fileInfo.Path)
+			}
+		}()
+	}
+
+	wg.Wait()
+	done <- struct{}{}
+}
+
+func processFileInfo(fileInfo FileInfo, stage *organiseStage) {
+	opts := stage.opts
+	defer reportPanic(fileInfo.Path, opts.ErrorQueue)
+
+	// Copying across devices holds the source and destination open, and name templates and layouts read the file.
+	defer stage.throttle.release(stage.throttle.acquire(2))
+
+	// fail reports err for the file, to the run report as well.
+	fail := func(err error) {
+		opts.ErrorQueue <- err
+		stage.runReport.Add(report.Entry{Source: fileInfo.Path, Hash: fileInfo.Hash, DateSource: fileInfo.DateSource, Action: report.ActionFailed, Error: err.Error(), ErrorKind: errorKind(err)})
+	}
+
+	var generatedPath string
+	var err error
+
+	if fileInfo.corruption != "" {
+		generatedPath = quarantineDestination(opts.SourcePath, filepath.Join(opts.DestinationPath, CorruptedFolderName), fileInfo.Path)
+	} else if opts.Destination != nil {
+		generatedPath, err = getHookDestinationPath(opts.Destination, opts.DestinationPath, fileInfo)
+		if err != nil {
+			fail(fmt.Errorf("failed to generate destination path for %s: %v", fileInfo.Path, err))
+			return
+		} else if generatedPath == "" {
+			return
+		}
+	} else {
+		if routedLayout, routed := routeLayout(opts.Routes, fileInfo); routed {
+			generatedPath, err = GetLayoutDestinationPath(opts.DestinationPath, fileInfo, routedLayout, opts.Format)
+		} else if opts.Flat {
+			generatedPath, err = getFlatDestinationPath(opts.DestinationPath, fileInfo)
+		} else if opts.Layout != "" {
+			generatedPath, err = GetLayoutDestinationPath(opts.DestinationPath, fileInfo, opts.Layout, opts.Format)
+		} else {
+			generatedPath, err = GetDestinationPath(opts.DestinationPath, fileInfo, opts.GeoLocation, opts.Format, opts.CameraMode)
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		generatedPath, err = ApplyNameTemplate(generatedPath, fileInfo, opts.NameTemplate)
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	// Names read from metadata, or kept from other systems, may not be valid where the file is placed.
+	generatedPath = pathsafe.Path(opts.DestinationPath, generatedPath)
+
+	if fileInfo.isDuplicate && opts.DuplicateFolder != "" {
+		generatedPath = getDuplicateFolderPath(opts.DestinationPath, generatedPath, opts.DuplicateFolder)
+	} else if fileInfo.isDuplicate {
+		fileName := filepath.Base(generatedPath)
+		if opts.Plan != nil {
+			generatedPath = duplicate.DuplicateFolderPath(generatedPath, "DUPLICATE")
+		} else {
+			generatedPath, err = duplicate.CreateDuplicateFolder(generatedPath, "DUPLICATE")
+			if err != nil {
+				fail(err)
+				return
+			}
+		}
+		generatedPath = filepath.Join(generatedPath, fileName)
+	} else if len(fileInfo.Companions) > 0 {
+		// Companions go next to the primary under its name, so the primary is placed where all of them are free.
+		generatedPath, _, err = ResolveCollision(fileInfo.Path, generatedPath, opts.OnCollision, pairTaken(fileInfo.Path, fileInfo.Companions))
+		if err != nil && !errors.Is(err, errCollisionSkipped) {
+			fail(err)
+			return
+		}
+	}
+
+	// skip reports a file left in place because its destination path is taken.
+	skip := func(path, hash string, err error) {
+		if opts.Plan != nil {
+			opts.Plan.Add(PlannedOperation{Action: PlanSkip, Source: path, Duplicate: fileInfo.isDuplicate})
+			return
+		}
+		logger(LoggerTypeWarning, fmt.Sprintf("skipped %s: %v", path, err))
+		stage.runReport.Add(report.Entry{Source: path, Hash: hash, DateSource: fileInfo.DateSource, Action: report.ActionCollisionSkipped, Error: err.Error()})
+	}
+
+	if errors.Is(err, errCollisionSkipped) {
+		skip(fileInfo.Path, fileInfo.Hash, err)
+		for _, companion := range fileInfo.Companions {
+			skip(companion, "", err)
+		}
+		return
+	}
+
+	if opts.Plan != nil {
+		plannedPath, err := opts.Plan.planMove(fileInfo.Path, generatedPath, fileInfo.isDuplicate, planAction(opts.Transfer), opts.OnCollision)
+		if errors.Is(err, errCollisionSkipped) {
+			for _, companion := range fileInfo.Companions {
+				skip(companion, "", err)
+			}
+			return
+		} else if err != nil {
+			fail(err)
+			return
+		}
+		for _, companion := range fileInfo.Companions {
+			if _, err := opts.Plan.planMove(companion, CompanionPath(plannedPath, fileInfo.Path, companion), fileInfo.isDuplicate, planAction(opts.Transfer), opts.OnCollision); err != nil && !errors.Is(err, errCollisionSkipped) {
+				opts.ErrorQueue <- err
+			}
+		}
+		if opts.Transfer != TransferCopy {
+			for _, discarded := range fileInfo.Discarded {
+				opts.Plan.Add(PlannedOperation{Action: PlanDelete, Source: discarded, Duplicate: fileInfo.isDuplicate})
+			}
+		}
+		return
+	}
+
+	movedPath, identical, err := moveFile(fileInfo.Path, generatedPath, fileInfo.isDuplicate, stage.moveOptions())
+	if errors.Is(err, errCollisionSkipped) {
+		skip(fileInfo.Path, fileInfo.Hash, err)
+		return
+	} else if err != nil {
+		fail(fmt.Errorf("failed to move %s to %s: %v", fileInfo.Path, generatedPath, err))
+		return
+	}
+
+	action := report.ActionMoved
+	if fileInfo.isDuplicate {
+		action = report.ActionDuplicateMoved
+	}
+	if opts.Transfer == TransferCopy {
+		action = report.ActionCopied
+		if fileInfo.isDuplicate {
+			action = report.ActionDuplicateCopied
+		}
+	}
+	if fileInfo.corruption != "" {
+		action = report.ActionQuarantined
+	}
+	primaryAction := action
+	if identical {
+		primaryAction = report.ActionAlreadyPresent
+	}
+	entries := []report.Entry{{Source: fileInfo.Path, Destination: movedPath, Hash: fileInfo.Hash, DateSource: fileInfo.DateSource, Action: primaryAction, Error: fileInfo.corruption}}
+
+	// Files standing in for an identical one already at the destination were not transferred and are not restored.
+	var transferred []transferredFile
+	if !identical {
+		transferred = append(transferred, transferredFile{source: fileInfo.Path, destination: movedPath})
+	}
+
+	for _, companion := range fileInfo.Companions {
+		companionDestination := CompanionPath(movedPath, fileInfo.Path, companion)
+		movedCompanion, identical, err := moveFile(companion, companionDestination, fileInfo.isDuplicate, stage.moveOptions())
+		if err != nil {
+			// The file and its companions are only ever organised together, so the ones moved already go back.
+			err = fmt.Errorf("failed to move %s to %s: %v", companion, companionDestination, err)
+			if restoreErr := restoreFiles(transferred, opts.Transfer, opts.RenameOnly, stage.throttle); restoreErr != nil {
+				err = fmt.Errorf("%v, %v", err, restoreErr)
+			}
+			opts.ErrorQueue <- err
+			for _, path := range append([]string{fileInfo.Path}, fileInfo.Companions...) {
+				stage.runReport.Add(report.Entry{Source: path, Action: report.ActionFailed, Error: err.Error(), ErrorKind: errorKind(err)})
+			}
+			return
+		}
+
+		companionAction := action
+		if identical {
+			companionAction = report.ActionAlreadyPresent
+		} else {
+			transferred = append(transferred, transferredFile{source: companion, destination: movedCompanion})
+		}
+		entries = append(entries, report.Entry{Source: companion, Destination: movedCompanion, DateSource: fileInfo.DateSource, Action: companionAction})
+	}
+
+	for _, entry := range entries {
+		stage.tracker.Add(progress.FilesMoved, 1, entry.Destination)
+		stage.runReport.Add(entry)
+	}
+
+	// Copying keeps the input as it is, discarded files included.
+	if opts.Transfer != TransferCopy {
+		for _, discarded := range fileInfo.Discarded {
+			if err := removeFile(discarded, opts.PermanentDelete); err != nil {
+				err = fmt.Errorf("failed to remove discarded file %s: %v", discarded, err)
+				opts.ErrorQueue <- err
+				stage.runReport.Add(report.Entry{Source: discarded, Action: report.ActionFailed, Error: err.Error(), ErrorKind: errorKind(err)})
+				continue
+			}
+			stage.runReport.Add(report.Entry{Source: discarded, Action: report.ActionDiscarded})
+		}
+	}
+
+	if fileInfo.isDuplicate {
+		stage.duplicates.add(HandledDuplicate{Path: fileInfo.Path, Action: DuplicateMove, Destination: movedPath, Original: fileInfo.original})
+	}
+}
+
+// transferredFile is a file moveFile has transferred from source to destination.
+type transferredFile struct {
+	source      string
+	destination string
+}
+
+// restoreFiles undoes the transfer of files, last first, moving them back to where they were, or
+// removing the copies when the originals were kept.
+func restoreFiles(files []transferredFile, transfer string, renameOnly bool, throttle *throttle) error {
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+
+		var err error
+		if transfer == TransferCopy {
+			err = os.Remove(file.destination)
+		} else {
+			err = RenameFile(file.destination, file.source, renameOnly, new(int64), throttle)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore %s from %s: %v", file.source, file.destination, err)
+		}
+	}
+
+	return nil
+}
+
+// moveOptions configure how moveFile transfers a file and resolves a destination that is taken.
+type moveOptions struct {
+	verbose           bool
+	duplicateStrategy string
+	renameOnly        bool
+	transfer          string
+	// mover, when set, moves the file instead of RenameFile.
+	mover       organizer.Mover
+	onCollision string
+	// permanentDelete deletes a source whose identical copy is at the destination rather than moving
+	// it to the trash.
+	permanentDelete bool
+	renamedFiles    *int64
+	journal         *Journal
+	throttle        *throttle
+}
+
+func moveFile(sourcePath, destinationPath string, isDuplicate bool, opts moveOptions) (string, bool, error) {
+	destPath := filepath.Dir(destinationPath)
+	if err := os.MkdirAll(pathsafe.Long(destPath), os.ModePerm); err != nil {
+		return "", false, fmt.Errorf("failed to create destination directory %s: %v", destPath, err)
+	}
+
+	if opts.verbose {
+		moveActionLog, err := logMoveAction(sourcePath, destPath, isDuplicate, opts.duplicateStrategy)
+		if err != nil {
+			return "", false, err
+		}
+
+		logger(LoggerTypeVerbose, moveActionLog)
+	}
+
+	// Workers resolve names concurrently, so the name found free is claimed, and resolved again when
+	// another worker took it first.
+	for {
+		resolvedPath, identical, err := ResolveCollision(sourcePath, destinationPath, opts.onCollision, claimedDestinations.taken)
+		if err != nil {
+			return "", false, err
+		}
+
+		if identical {
+			// The file at the destination stands in for the source, which is not transferred again.
+			if opts.transfer != TransferCopy {
+				if err := removeFile(sourcePath, opts.permanentDelete); err != nil {
+					return "", false, fmt.Errorf("failed to remove source file %s: %v", sourcePath, err)
+				}
+			}
+			return resolvedPath, true, nil
+		}
+
+		claimed, err := claimedDestinations.claim(resolvedPath)
+		if err != nil {
+			return "", false, err
+		} else if claimed {
+			destinationPath = resolvedPath
+			break
+		}
+	}
+	defer claimedDestinations.release(destinationPath)
+
+	var hashStr string
+	var err error
+	if opts.journal != nil {
+		if hashStr, err = opts.journal.HashOf(sourcePath); err != nil {
+			return "", false, err
+		}
+	}
+
+	err = opts.throttle.retrying(func() error {
+		if IsCopyTransfer(opts.transfer) {
+			return copyVerified(sourcePath, destinationPath, opts.transfer == TransferCopyThenDelete, opts.throttle)
+		}
+		if opts.mover != nil {
+			return opts.mover.Move(sourcePath, destinationPath)
+		}
+		return RenameFile(sourcePath, destinationPath, opts.renameOnly, opts.renamedFiles, opts.throttle)
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if opts.journal != nil {
+		if err := opts.journal.Record(sourcePath, destinationPath, hashStr); err != nil {
+			return destinationPath, false, err
+		}
+	}
+
+	return destinationPath, false, nil
+}
+
+func GetDestinationPath(destinationPath string, fileInfo FileInfo, geoLocation bool, format string, cameraMode string) (string, error) {
+	if cameraMode != "off" && cameraMode != "" && fileInfo.FileType != FileTypeUnknown {
+		return getCameraDestinationPath(destinationPath, fileInfo, format, cameraMode)
+	}
+
+	if geoLocation {
+		country := sanitizePathComponent(fileInfo.Country)
+		if country == "" {
+			country = unknownCountryName
+		}
+
+		switch fileInfo.FileType {
+		case FileTypeImage:
+			return fmt.Sprintf("%s/%s/images/%s", destinationPath, country, filepath.Base(fileInfo.Path)), nil
+		case FileTypeVideo:
+			return fmt.Sprintf("%s/%s/videos/%s", destinationPath, country, filepath.Base(fileInfo.Path)), nil
+		case FileTypeUnknown:
+			return fmt.Sprintf("%s/unknown/%s", destinationPath, filepath.Base(fileInfo.Path)), nil
+		}
+	} else {
+		monthFolderName := organizer.MonthName(fileInfo.Created.Month(), format)
+
+		switch fileInfo.FileType {
+		case FileTypeImage:
+			return fmt.Sprintf("%s/%04d/%s/images/%s", destinationPath, fileInfo.Created.Year(), monthFolderName, filepath.Base(fileInfo.Path)), nil
+		case FileTypeVideo:
+			return fmt.Sprintf("%s/%04d/%s/videos/%s", destinationPath, fileInfo.Created.Year(), monthFolderName, filepath.Base(fileInfo.Path)), nil
+		case FileTypeUnknown:
+			return fmt.Sprintf("%s/unknown/%s", destinationPath, filepath.Base(fileInfo.Path)), nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate destination path for %s", fileInfo.Path)
+}
+
+// getCameraDestinationPath places the file in a folder named after its camera model, nested under
+// the year and month folders when cameraMode is "date".
+func getCameraDestinationPath(destinationPath string, fileInfo FileInfo, format string, cameraMode string) (string, error) {
+	typeFolderName := "images"
+	if fileInfo.FileType == FileTypeVideo {
+		typeFolderName = "videos"
+	}
+
+	cameraFolder := cameraFolderName(fileInfo.Path)
+	fileName := filepath.Base(fileInfo.Path)
+
+	switch cameraMode {
+	case "camera":
+		return fmt.Sprintf("%s/%s/%s/%s", destinationPath, cameraFolder, typeFolderName, fileName), nil
+	case "date":
+		monthFolderName := organizer.MonthName(fileInfo.Created.Month(), format)
+		return fmt.Sprintf("%s/%04d/%s/%s/%s/%s", destinationPath, fileInfo.Created.Year(), monthFolderName, cameraFolder, typeFolderName, fileName), nil
+	}
+
+	return "", fmt.Errorf("failed to generate destination path for %s: unknown camera mode %q", fileInfo.Path, cameraMode)
+}
+
+// getDuplicateFolderPath places a duplicate, organised to generatedPath, at the same relative path
+// under duplicateFolder. Destinations outside the destination path keep only their file name.
+func getDuplicateFolderPath(destinationPath, generatedPath, duplicateFolder string) string {
+	relPath, err := filepath.Rel(destinationPath, generatedPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		relPath = filepath.Base(generatedPath)
+	}
+
+	return filepath.Join(duplicateFolder, relPath)
+}
+
+// getFlatDestinationPath names the file "{date}_{hashprefix}{ext}" directly inside the destination path.
+// Files of unknown type keep their name and go to the unknown folder as usual.
+func getFlatDestinationPath(destinationPath string, fileInfo FileInfo) (string, error) {
+	if fileInfo.FileType == FileTypeUnknown {
+		return fmt.Sprintf("%s/unknown/%s", destinationPath, filepath.Base(fileInfo.Path)), nil
+	}
+
+	if len(fileInfo.Hash) < flatHashPrefixLength {
+		return "", fmt.Errorf("failed to generate flat destination path for %s: missing file hash", fileInfo.Path)
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileInfo.Path))
+	fileName := fmt.Sprintf("%s_%s%s", fileInfo.Created.Format(defaultDateLayout), fileInfo.Hash[:flatHashPrefixLength], ext)
+
+	return filepath.Join(destinationPath, fileName), nil
+}
+
+// RenameFile moves the file with the RenameMover of the organizer package, copying it across devices,
+// paced to the rate limit of throttle, only when renameOnly is not set.
+func RenameFile(sourcePath, destinationPath string, renameOnly bool, renamedFiles *int64, throttle *throttle) error {
+	return organizer.RenameMover{RenameOnly: renameOnly, Pace: throttle.reader, Renamed: renamedFiles}.Move(sourcePath, destinationPath)
+}
+
+func GenerateUniquePathName(destinationPath string) (string, error) {
+	ext := filepath.Ext(destinationPath)
+	nameWithoutExtension := destinationPath[:len(destinationPath)-len(ext)]
+
+	newPath := destinationPath
+	counter := 1
+	for {
+		_, err := os.Stat(newPath)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("failed to check destination file %s: %v", newPath, err)
+		}
+
+		newPath = fmt.Sprintf("%s_%d%s", nameWithoutExtension, counter, ext)
+		counter++
+	}
+
+	return newPath, nil
+}
@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+	"github.com/keybraker/mediarizer-2/trash"
+)
+
+// Ways the organise stage transfers files into the destination.
+const (
+	TransferMove           = "move"
+	TransferCopy           = "copy"
+	TransferCopyThenDelete = "copy-then-delete"
+)
+
+// IsCopyTransfer checks if transfer copies the files rather than renaming them.
+func IsCopyTransfer(transfer string) bool {
+	return transfer == TransferCopy || transfer == TransferCopyThenDelete
+}
+
+// removeFile deletes the file at path, moving it to the trash of the user unless permanent.
+func removeFile(path string, permanent bool) error {
+	if permanent {
+		return os.Remove(path)
+	}
+
+	return trash.Move(path)
+}
+
+// copyVerified copies sourcePath to destinationPath, preserving its mode and modification time, and
+// reads the copy back to check its SHA-256 matches what was read from the source. The copy is written
+// to a hidden temporary file next to the destination and only renamed into place once verified, so an
+// interrupted copy never passes for a complete one. With removeSource the source is removed afterwards.
+func copyVerified(sourcePath, destinationPath string, removeSource bool, throttle *throttle) error {
+	longSource, longDestination := pathsafe.Long(sourcePath), pathsafe.Long(destinationPath)
+
+	sourceFile, err := os.Open(longSource)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", sourcePath, err)
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	temporaryFile, err := os.CreateTemp(filepath.Dir(longDestination), "."+filepath.Base(destinationPath)+".*.partial")
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", destinationPath, err)
+	}
+	temporaryPath := temporaryFile.Name()
+	defer os.Remove(temporaryPath)
+
+	sourceHash := sha256.New()
+	if _, err := io.Copy(temporaryFile, io.TeeReader(throttle.reader(sourceFile), sourceHash)); err != nil {
+		temporaryFile.Close()
+		return fmt.Errorf("failed to copy file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	// The copy is synced before it is read back, so it is not verified before it reached the disk.
+	if err := temporaryFile.Sync(); err != nil {
+		temporaryFile.Close()
+		return fmt.Errorf("failed to copy file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		return fmt.Errorf("failed to copy file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	if err := verifyCopy(temporaryPath, sourceHash.Sum(nil)); err != nil {
+		return fmt.Errorf("failed to verify copy of %s: %w", sourcePath, err)
+	}
+
+	if err := os.Chmod(temporaryPath, sourceInfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to preserve permissions of %s: %w", destinationPath, err)
+	}
+
+	if err := os.Chtimes(temporaryPath, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
+		return fmt.Errorf("failed to preserve modification time of %s: %w", destinationPath, err)
+	}
+
+	if err := os.Rename(temporaryPath, longDestination); err != nil {
+		return fmt.Errorf("failed to copy file from %s to %s: %w", sourcePath, destinationPath, err)
+	}
+
+	if !removeSource {
+		return nil
+	}
+
+	sourceFile.Close()
+	if err := os.Remove(longSource); err != nil {
+		return fmt.Errorf("failed to remove source file %s: %w", sourcePath, err)
+	}
+
+	return nil
+}
+
+// verifyCopy checks that the SHA-256 of the file at path is sourceHash.
+func verifyCopy(path string, sourceHash []byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	copyHash, err := hash.HashOpenFile(file, hash.SHA256)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(copyHash, sourceHash) {
+		return fmt.Errorf("%s does not match the source", path)
+	}
+
+	return nil
+}
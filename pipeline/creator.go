@@ -0,0 +1,390 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/duplicate"
+	"github.com/keybraker/mediarizer-2/geo"
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/progress"
+	"github.com/keybraker/mediarizer-2/report"
+)
+
+func creator(ctx context.Context, stage *organiseStage) {
+	opts := stage.opts
+	filePaths := make(chan string, 100)
+
+	var wg sync.WaitGroup
+
+	numWorkers := stage.throttle.workerCount()
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range filePaths {
+				// Paths walked before the run was cancelled are drained without being processed.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				processFile(path, stage)
+			}
+		}()
+	}
+
+	go func() {
+		err := walkInput(opts.SourcePath, opts.ExcludePath, opts.Filter, opts.FollowSymlinks, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				opts.ErrorQueue <- err
+				return nil
+			}
+			if opts.Checkpoint.isCompleted(path) {
+				return nil
+			}
+
+			filePaths <- path
+			return nil
+		})
+		if err != nil && err != ctx.Err() {
+			opts.ErrorQueue <- err
+		}
+		close(filePaths)
+	}()
+
+	wg.Wait()
+	close(stage.fileQueue)
+}
+
+func processFile(path string, stage *organiseStage) {
+	// A RAW file shot together with a JPEG is carried along by it, and organised on its own when the
+	// JPEG is not walked or turns out not to be organised.
+	if jpeg, found := jpegCompanion(path); stage.opts.RawPairs && found && walkedFile(jpeg, stage.opts) {
+		return
+	}
+
+	if raw := processMedia(path, stage); raw != "" && walkedFile(raw, stage.opts) {
+		processMedia(raw, stage)
+	}
+}
+
+// processMedia hands the file at path to the consumer, returning the RAW file paired with it when the
+// file is not organised, so it was not carried along.
+func processMedia(path string, stage *organiseStage) (uncarried string) {
+	opts := stage.opts
+	defer reportPanic(path, opts.ErrorQueue)
+
+	// fail reports err for the file, to the run report as well.
+	fail := func(err error) {
+		opts.ErrorQueue <- err
+		stage.runReport.Add(report.Entry{Source: path, Action: report.ActionFailed, Error: err.Error(), ErrorKind: errorKind(err)})
+	}
+
+	// The file is read while its slot is held, which is released before handing it to the consumer,
+	// as the consumers waiting for slots could otherwise never drain the queue.
+	slots := stage.throttle.acquire(1)
+	defer func() { stage.throttle.release(slots) }()
+	send := func(fileInfo FileInfo) {
+		stage.throttle.release(slots)
+		slots = 0
+		stage.fileQueue <- fileInfo
+	}
+
+	// Copies the dedupe stage plans to remove would not be left to organise.
+	if opts.Plan != nil && opts.Plan.isRemoved(path) {
+		return
+	}
+
+	// Sidecars are moved along with their media file instead.
+	if _, found := sidecarParent(path); opts.Sidecars && found {
+		return
+	}
+
+	// So are the videos of Live Photos, or they are discarded once their still is organised.
+	if stage.groups.isLiveVideo(path) {
+		return
+	}
+
+	var companions, discarded []string
+	if opts.RawPairs {
+		if companion, found := rawCompanion(path); found {
+			uncarried = companion
+			companions = append(companions, companion)
+		}
+	}
+	if video, found := stage.groups.liveVideo(path); found && opts.DiscardLiveVideos {
+		discarded = append(discarded, video)
+	} else if found {
+		companions = append(companions, video)
+	}
+	if opts.Sidecars {
+		for _, mediaPath := range append([]string{path}, companions...) {
+			companions = append(companions, FindSidecars(mediaPath)...)
+		}
+	}
+
+	fileType := GetFileType(path, opts.FileTypes, opts.Photos, opts.Videos)
+
+	if fileType == Unknown {
+		if opts.MoveUnknown {
+			send(FileInfo{Path: path, FileType: Unknown})
+		}
+		return
+	}
+
+	if fileType == FileTypeExcluded {
+		return
+	}
+
+	// Corrupt files are left in place as failed, or quarantined, instead of being organised.
+	if opts.VerifyMedia {
+		if err := hash.ValidateMedia(path); errors.Is(err, hash.ErrCorrupt) {
+			if opts.QuarantineCorrupt {
+				send(FileInfo{Path: path, FileType: fileType, Companions: withoutRaw(companions, uncarried), corruption: err.Error()})
+			} else {
+				fail(err)
+			}
+			return
+		} else if err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	// Hashed files are cached, so retrying past a transient read error only reads the file once more.
+	var isIgnored bool
+	err := stage.throttle.retrying(func() error {
+		var err error
+		isIgnored, err = duplicate.IsIgnored(path, opts.IgnoreHashes, opts.HashCache, opts.HashOptions.Algorithm)
+		return err
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	if isIgnored && opts.SkipIgnored {
+		return
+	}
+
+	var original string
+	if !isIgnored {
+		err = stage.throttle.retrying(func() error {
+			var err error
+			original, err = duplicate.DuplicateOf(path, stage.fileHashMap, opts.HashCache, opts.HashOptions.Algorithm)
+			return err
+		})
+		if errors.Is(err, hash.ErrFileChanged) {
+			opts.WarnQueue <- fmt.Sprintf("file changed while hashing, skipped: %v", path)
+			stage.runReport.Add(report.Entry{Source: path, Action: report.ActionFailed, Error: err.Error(), ErrorKind: errorKind(err)})
+			return
+		} else if err != nil {
+			fail(err)
+			return
+		}
+	}
+	isDuplicate := original != ""
+
+	// The file is hashed by now, so looking its hash up again for the report only hits the cache.
+	hashValue, err := hash.GetFileHashWithAlgorithm(path, opts.HashCache, opts.HashOptions.Algorithm)
+	if err != nil {
+		fail(err)
+		return
+	}
+	hashStr := hex.EncodeToString(hashValue)
+
+	if isDuplicate {
+		stage.tracker.Add(progress.DuplicatesFound, 1, path)
+
+		// Duplicates that are not moved never reach the consumer, which counts the processed files.
+		if opts.DuplicateStrategy != DuplicateMove {
+			defer stage.tracker.Add(progress.FilesProcessed, 1, path)
+		}
+
+		switch opts.DuplicateStrategy {
+		case DuplicateSkip:
+			if opts.Plan != nil {
+				opts.Plan.Add(PlannedOperation{Action: PlanSkip, Source: path, Duplicate: true, Original: original})
+				return
+			}
+			logger(LoggerTypeInfo, fmt.Sprintf("Skipped duplicate file: %v", path))
+			logMoveAction(path, "", true, opts.DuplicateStrategy)
+			stage.duplicates.add(HandledDuplicate{Path: path, Action: DuplicateSkip, Original: original})
+			stage.runReport.Add(report.Entry{Source: path, Hash: hashStr, Action: report.ActionDuplicateSkipped})
+			return
+		case DuplicateDelete:
+			if opts.Plan != nil {
+				opts.Plan.Add(PlannedOperation{Action: PlanDelete, Source: path, Duplicate: true, Original: original})
+				return
+			}
+			if err := removeFile(path, opts.PermanentDelete); err != nil {
+				fail(fmt.Errorf("failed to delete duplicate file: %v", err))
+			} else {
+				logMoveAction(path, "", true, opts.DuplicateStrategy)
+				stage.duplicates.add(HandledDuplicate{Path: path, Action: DuplicateDelete, Original: original})
+				stage.runReport.Add(report.Entry{Source: path, Hash: hashStr, Action: report.ActionDuplicateDeleted})
+			}
+			for _, companion := range append(withoutRaw(companions, uncarried), discarded...) {
+				opts.WarnQueue <- fmt.Sprintf("kept companion file of deleted duplicate in place: %v", companion)
+			}
+			return
+		case DuplicateHardlink:
+			if opts.Plan != nil {
+				opts.Plan.Add(PlannedOperation{Action: PlanLink, Source: path, Duplicate: true, Original: original})
+				return
+			}
+			// The original may be an input file the consumer has moved meanwhile, which can no longer be linked to.
+			if err := duplicate.ReplaceWithLink(original, path); errors.Is(err, fs.ErrNotExist) {
+				opts.WarnQueue <- fmt.Sprintf("original %v of duplicate moved before it could be linked, kept duplicate: %v", original, path)
+				stage.runReport.Add(report.Entry{Source: path, Hash: hashStr, Action: report.ActionDuplicateSkipped})
+			} else if err != nil {
+				fail(err)
+			} else {
+				logMoveAction(path, "", true, opts.DuplicateStrategy)
+				stage.duplicates.add(HandledDuplicate{Path: path, Action: DuplicateHardlink, Original: original})
+				stage.runReport.Add(report.Entry{Source: path, Hash: hashStr, Action: report.ActionDuplicateLinked})
+			}
+			return
+		}
+	}
+
+	if opts.GeoLocation {
+		country, err := GetCountry(path)
+		if err != nil {
+			fail(err)
+			return
+		} else if country == "" {
+			opts.WarnQueue <- fmt.Sprintf("no country found for file: %v", path)
+		}
+
+		send(FileInfo{Path: path, FileType: fileType, isDuplicate: isDuplicate, original: original, Country: country, Hash: hashStr, Companions: companions, Discarded: discarded})
+	} else {
+		createdDate, dateSource, err := GetCreatedTime(path, opts.DateSources, opts.DateCorrection)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		if opts.RawPrimary == "raw" && len(companions) > 0 && isRaw(filepath.Ext(companions[0])) {
+			if rawDate, rawDateSource, err := GetCreatedTime(companions[0], opts.DateSources, opts.DateCorrection); err == nil && rawDateSource != metadata.DateModTime {
+				createdDate, dateSource = rawDate, rawDateSource
+			}
+		}
+
+		// The frames of a burst are placed by the frame leading it, so they end up together.
+		if lead, found := stage.groups.burstLead(path); found && lead != path {
+			if leadDate, leadDateSource, err := GetCreatedTime(lead, opts.DateSources, opts.DateCorrection); err == nil {
+				createdDate, dateSource = leadDate, leadDateSource
+			}
+		}
+
+		send(FileInfo{
+			Path:            path,
+			FileType:        fileType,
+			isDuplicate:     isDuplicate,
+			original:        original,
+			Created:         createdDate,
+			HasCreationDate: dateSource != metadata.DateModTime,
+			DateSource:      dateSource.String(),
+			Hash:            hashStr,
+			Companions:      companions,
+			Discarded:       discarded,
+		})
+	}
+
+	return ""
+}
+
+func GetFileType(path string, fileTypesToInclude []string, organisePhotos bool, organiseVideos bool) FileType {
+	file, err := os.Open(path)
+	if err != nil {
+		logger(LoggerTypeWarning, fmt.Sprintf("failed to open file %v: %v", path, err))
+		return FileTypeUnknown
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		logger(LoggerTypeWarning, fmt.Sprintf("failed to get file info: %v", err))
+		return FileTypeUnknown
+	}
+
+	if fileInfo.IsDir() {
+		return FileTypeFolder
+	}
+
+	fileType := FileTypeUnknown
+	if fileTypesToInclude != nil {
+		fileType = FileTypeExcluded
+	}
+
+	extension := filepath.Ext(path)
+
+	if fileTypesToInclude != nil && !isStringInArray(extension, fileTypesToInclude) {
+		fileType = FileTypeExcluded
+	} else if organisePhotos && IsPhoto(extension) {
+		fileType = FileTypeImage
+	} else if organiseVideos && IsVideo(extension) {
+		fileType = FileTypeVideo
+	} else if fileTypesToInclude == nil && (organisePhotos || organiseVideos) {
+		fileType = FileTypeUnknown
+	}
+
+	return fileType
+}
+
+func isStringInArray(str string, arr []string) bool {
+	lowerStr := strings.ToLower(str)
+	for _, val := range arr {
+		if strings.ToLower(val) == lowerStr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetCreatedTime returns the capture date of the file, corrected by correction, with the source it
+// was read from, only the modification time not being a real creation date.
+func GetCreatedTime(path string, dateSources []metadata.DateSource, correction DateCorrection) (time.Time, metadata.DateSource, error) {
+	dateTime, source, err := metadata.ResolveCaptureDate(path, dateSources)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	dateTime = correction.apply(path, dateTime, source)
+
+	if source != metadata.DateEmbedded {
+		logger(LoggerTypeVerbose, fmt.Sprintf("no readable capture date in %s, using %v date", path, source))
+	}
+
+	return dateTime, source, nil
+}
+
+// GetCountry returns the country the GPS coordinates of the file at path lie in, an empty string
+// for files without coordinates or taken outside every country.
+func GetCountry(path string) (string, error) {
+	latitude, longitude, err := metadata.ExtractLocation(path)
+	if err != nil {
+		return "", nil // file has no readable lat lon
+	}
+
+	country, _, err := geo.Country(latitude, longitude)
+	if err != nil {
+		return "", err
+	}
+
+	return country, nil
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// SameDevice checks if both paths reside on the same device, meaning a rename between them never needs a copy.
+func SameDevice(pathA, pathB string) (bool, error) {
+	infoA, err := os.Stat(pathA)
+	if err != nil {
+		return false, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	infoB, err := os.Stat(pathB)
+	if err != nil {
+		return false, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	statA, okA := infoA.Sys().(*syscall.Stat_t)
+	statB, okB := infoB.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return false, fmt.Errorf("failed to get device of %s and %s", pathA, pathB)
+	}
+
+	return statA.Dev == statB.Dev, nil
+}
+
+// fileIdentity returns the device and inode of the file at path, which info describes.
+func fileIdentity(path string, info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+
+	return fileID{device: uint64(stat.Dev), inode: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// SameDevice checks if both paths reside on the same volume, meaning a rename between them never needs a copy.
+func SameDevice(pathA, pathB string) (bool, error) {
+	absA, err := filepath.Abs(pathA)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve path %s: %v", pathA, err)
+	}
+
+	absB, err := filepath.Abs(pathB)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve path %s: %v", pathB, err)
+	}
+
+	return strings.EqualFold(filepath.VolumeName(absA), filepath.VolumeName(absB)), nil
+}
+
+// fileIdentity returns the volume and file index of the file at path, which windows only reads from an
+// open file, so the file is opened without any access, as much as reading its attributes needs.
+// Directories only open with backup semantics. Symlinks are followed like info does.
+func fileIdentity(path string, info os.FileInfo) (fileID, bool) {
+	pathPointer, err := syscall.UTF16PtrFromString(pathsafe.Long(path))
+	if err != nil {
+		return fileID{}, false
+	}
+
+	handle, err := syscall.CreateFile(pathPointer, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return fileID{}, false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var data syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(handle, &data); err != nil {
+		return fileID{}, false
+	}
+
+	return fileID{device: uint64(data.VolumeSerialNumber), inode: uint64(data.FileIndexHigh)<<32 | uint64(data.FileIndexLow)}, true
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"sort"
+	"sync"
+)
+
+// Actions taken on duplicates found by the organise stage, as Options.DuplicateStrategy names them.
+const (
+	DuplicateMove     = "move"
+	DuplicateSkip     = "skip"
+	DuplicateDelete   = "delete"
+	DuplicateHardlink = "hardlink"
+)
+
+// HandledDuplicate is the action the organise stage took on a single duplicate file.
+type HandledDuplicate struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	// Destination is where a moved duplicate went.
+	Destination string `json:"destination,omitempty"`
+	// Original is the file already in the destination or the input that the duplicate matches.
+	Original string `json:"original,omitempty"`
+}
+
+// DuplicateLog collects the duplicates handled by the organise stage. It is safe for concurrent use.
+type DuplicateLog struct {
+	mu      sync.Mutex
+	handled []HandledDuplicate
+}
+
+// add records the action taken on a duplicate.
+func (log *DuplicateLog) add(handled HandledDuplicate) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.handled = append(log.handled, handled)
+}
+
+// Handled returns the recorded actions ordered by path.
+func (log *DuplicateLog) Handled() []HandledDuplicate {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	handled := append([]HandledDuplicate{}, log.handled...)
+	sort.SliceStable(handled, func(i, j int) bool { return handled[i].Path < handled[j].Path })
+
+	return handled
+}
+
+// IsDuplicateStrategy checks if name is one of the actions taken on duplicates.
+func IsDuplicateStrategy(name string) bool {
+	switch name {
+	case DuplicateMove, DuplicateSkip, DuplicateDelete, DuplicateHardlink:
+		return true
+	default:
+		return false
+	}
+}
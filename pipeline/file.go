@@ -1,13 +1,8 @@
-package main
+package pipeline
 
-import (
-	"encoding/json"
-	"io"
-	"os"
-	"strings"
-)
+import "strings"
 
-func isPhoto(fileExt string) bool {
+func IsPhoto(fileExt string) bool {
 	fileExToLower := strings.ToLower(fileExt)
 	if getPhotoType(fileExToLower) == -1 {
 		return false
@@ -16,7 +11,7 @@ func isPhoto(fileExt string) bool {
 	}
 }
 
-func isVideo(fileExt string) bool {
+func IsVideo(fileExt string) bool {
 	fileExToLower := strings.ToLower(fileExt)
 	if getVideoType(fileExToLower) == -1 {
 		return false
@@ -33,7 +28,16 @@ func getPhotoType(fileExt string) PhotoType {
 		return PNG
 	case ".gif":
 		return GIF
+	case ".heic", ".heif":
+		return HEIC
+	case ".webp":
+		return WEBP
+	case ".avif":
+		return AVIF
 	default:
+		if isRaw(fileExt) {
+			return RAW
+		}
 		return -1
 	}
 }
@@ -52,24 +56,3 @@ func getVideoType(fileExt string) VideoType {
 		return -1
 	}
 }
-
-func loadFeatureCollection() (FeatureCollection, error) {
-	file, err := os.Open("countries.json")
-	if err != nil {
-		return FeatureCollection{}, err
-	}
-	defer file.Close()
-
-	bytes, err := io.ReadAll(file)
-	if err != nil {
-		return FeatureCollection{}, err
-	}
-
-	var featureCollection FeatureCollection
-	err = json.Unmarshal(bytes, &featureCollection)
-	if err != nil {
-		return FeatureCollection{}, err
-	}
-
-	return featureCollection, nil
-}
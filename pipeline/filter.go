@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterDateLayout is the layout of the dates ParseWalkFilter takes.
+const FilterDateLayout = "2006-01-02"
+
+// WalkFilter leaves input files out of a run by name, size and modification time as the input is
+// walked, before they are hashed. The zero WalkFilter keeps every file.
+type WalkFilter struct {
+	// ExcludeGlobs leave out the files and whole directories whose name, or path relative to the input
+	// for patterns with a slash, matches one of them.
+	ExcludeGlobs []string
+	// IncludeGlobs, when set, keep only the files whose name or relative path matches one of them.
+	IncludeGlobs []string
+	// MinSize and MaxSize, when positive, bound the size of the files in bytes.
+	MinSize int64
+	MaxSize int64
+	// After and Before, when set, keep only the files modified at or after After and before Before.
+	After  time.Time
+	Before time.Time
+}
+
+// skipsDir checks if the directory at path, under the input root, is left out with all it holds.
+func (filter WalkFilter) skipsDir(root, path string) bool {
+	return path != root && matchesGlob(filter.ExcludeGlobs, root, path)
+}
+
+// keeps checks if the file at path, under the input root, is part of the run.
+func (filter WalkFilter) keeps(root, path string, entry fs.DirEntry) bool {
+	if matchesGlob(filter.ExcludeGlobs, root, path) {
+		return false
+	}
+	if len(filter.IncludeGlobs) > 0 && !matchesGlob(filter.IncludeGlobs, root, path) {
+		return false
+	}
+
+	if filter.MinSize <= 0 && filter.MaxSize <= 0 && filter.After.IsZero() && filter.Before.IsZero() {
+		return true
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+
+	if filter.MinSize > 0 && info.Size() < filter.MinSize || filter.MaxSize > 0 && info.Size() > filter.MaxSize {
+		return false
+	}
+	if !filter.After.IsZero() && info.ModTime().Before(filter.After) || !filter.Before.IsZero() && !info.ModTime().Before(filter.Before) {
+		return false
+	}
+
+	return true
+}
+
+// matchesGlob checks if any of the patterns matches the name of path, or its slash separated path
+// relative to root for patterns with a slash.
+func matchesGlob(patterns []string, root, path string) bool {
+	name := filepath.Base(path)
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		relPath = path
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	for _, pattern := range patterns {
+		candidate := name
+		if strings.Contains(pattern, "/") {
+			candidate = relPath
+		}
+
+		if matched, _ := filepath.Match(pattern, candidate); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseGlobs splits a comma separated list of glob patterns, checking each is well formed.
+func parseGlobs(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = filepath.ToSlash(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// parseByteSize parses a size such as 50KB, 2MB, 1GB or a plain number of bytes, in units of 1024 bytes.
+// An empty size is 0.
+func parseByteSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	return count * multiplier, nil
+}
+
+// parseFilterDate parses an after or before date of ParseWalkFilter, such as 2020-01-31, as midnight local time.
+// An empty date is the zero time.
+func parseFilterDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.ParseInLocation(FilterDateLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+
+	return date, nil
+}
+
+// ParseWalkFilter builds the WalkFilter of comma separated glob lists, sizes such as 10MB and dates
+// in the FilterDateLayout, any of which may be empty.
+func ParseWalkFilter(excludeGlobs, includeGlobs, minSize, maxSize, after, before string) (WalkFilter, error) {
+	var filter WalkFilter
+	var err error
+
+	if filter.ExcludeGlobs, err = parseGlobs(excludeGlobs); err != nil {
+		return WalkFilter{}, err
+	}
+	if filter.IncludeGlobs, err = parseGlobs(includeGlobs); err != nil {
+		return WalkFilter{}, err
+	}
+	if filter.MinSize, err = parseByteSize(minSize); err != nil {
+		return WalkFilter{}, err
+	}
+	if filter.MaxSize, err = parseByteSize(maxSize); err != nil {
+		return WalkFilter{}, err
+	}
+	if filter.After, err = parseFilterDate(after); err != nil {
+		return WalkFilter{}, err
+	}
+	if filter.Before, err = parseFilterDate(before); err != nil {
+		return WalkFilter{}, err
+	}
+
+	if filter.MaxSize > 0 && filter.MinSize > filter.MaxSize {
+		return WalkFilter{}, fmt.Errorf("min-size %s is larger than max-size %s", minSize, maxSize)
+	}
+	if !filter.After.IsZero() && !filter.Before.IsZero() && !filter.After.Before(filter.Before) {
+		return WalkFilter{}, fmt.Errorf("after %s is not before %s", after, before)
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/metadata"
+)
+
+// livePhotoStillExtensions are the stills an iPhone writes the video of a Live Photo next to.
+var livePhotoStillExtensions = []string{".heic", ".heif", ".jpg", ".jpeg"}
+
+var livePhotoVideoExtensions = []string{".mov"}
+
+// burstNamePattern matches the names Android cameras give the frames of a burst, such as
+// 00000IMG_00000_BURST20200101123456789_COVER.jpg, capturing what the frames share.
+var burstNamePattern = regexp.MustCompile(`(?i)_BURST(\d+)`)
+
+// mediaGroups are the Live Photos and bursts found among the input files by groupMedia. A nil
+// mediaGroups holds none.
+type mediaGroups struct {
+	// liveVideos maps the still of every Live Photo to its video.
+	liveVideos map[string]string
+	// liveStills maps the video of every Live Photo to its still.
+	liveStills map[string]string
+	// burstLeads maps every frame of a burst to the frame the burst is placed by.
+	burstLeads map[string]string
+}
+
+// liveVideo returns the video of the Live Photo whose still is at path.
+func (groups *mediaGroups) liveVideo(path string) (string, bool) {
+	if groups == nil {
+		return "", false
+	}
+
+	video, found := groups.liveVideos[path]
+	return video, found
+}
+
+// isLiveVideo checks if the file at path is the video of a Live Photo, which goes with its still.
+func (groups *mediaGroups) isLiveVideo(path string) bool {
+	if groups == nil {
+		return false
+	}
+
+	_, found := groups.liveStills[path]
+	return found
+}
+
+// burstLead returns the frame that places the burst the frame at path belongs to.
+func (groups *mediaGroups) burstLead(path string) (string, bool) {
+	if groups == nil {
+		return "", false
+	}
+
+	lead, found := groups.burstLeads[path]
+	return lead, found
+}
+
+// groupMedia finds the Live Photos among paths, a still and a video of the same name whose content
+// identifiers match or can not be read, and the bursts, photos sharing an iPhone burst identifier or
+// an Android burst name. A burst is placed by its cover frame, or by its first frame when none is marked.
+func groupMedia(paths []string, livePhotos, bursts bool) *mediaGroups {
+	groups := &mediaGroups{
+		liveVideos: make(map[string]string),
+		liveStills: make(map[string]string),
+		burstLeads: make(map[string]string),
+	}
+
+	frames := make(map[string][]string)
+	for _, path := range paths {
+		ext := strings.ToLower(filepath.Ext(path))
+		if livePhotos && arrayContains(livePhotoStillExtensions, ext) {
+			if video, found := findSibling(path, livePhotoVideoExtensions); found && isLivePhoto(path, video) {
+				groups.liveVideos[path] = video
+				groups.liveStills[video] = path
+			}
+		}
+
+		if bursts && IsPhoto(ext) {
+			if burst, found := burstIdentifier(path); found {
+				frames[burst] = append(frames[burst], path)
+			}
+		}
+	}
+
+	for _, burst := range frames {
+		if len(burst) < 2 {
+			continue
+		}
+
+		sort.Strings(burst)
+		lead := burst[0]
+		for _, frame := range burst {
+			if strings.Contains(strings.ToUpper(filepath.Base(frame)), "_COVER") {
+				lead = frame
+				break
+			}
+		}
+
+		for _, frame := range burst {
+			groups.burstLeads[frame] = lead
+		}
+	}
+
+	return groups
+}
+
+// isLivePhoto checks if the still and the video of the same name are a Live Photo, which they are
+// unless both hold a content identifier and the two differ.
+func isLivePhoto(still, video string) bool {
+	stillIdentifier, err := metadata.ExtractContentIdentifier(still)
+	if err != nil {
+		return true
+	}
+
+	videoIdentifier, err := metadata.ExtractContentIdentifier(video)
+	if err != nil {
+		return true
+	}
+
+	return strings.EqualFold(stillIdentifier, videoIdentifier)
+}
+
+// burstIdentifier returns what the frames of the burst the photo at path belongs to share, its iPhone
+// burst identifier or, for Android burst names, the directory and burst number.
+func burstIdentifier(path string) (string, bool) {
+	if burst, err := metadata.ExtractBurstIdentifier(path); err == nil {
+		return burst, true
+	}
+
+	if match := burstNamePattern.FindStringSubmatch(filepath.Base(path)); match != nil {
+		return filepath.Join(filepath.Dir(path), match[1]), true
+	}
+
+	return "", false
+}
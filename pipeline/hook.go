@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"encoding/hex"
+
+	"github.com/keybraker/mediarizer-2/organizer"
+)
+
+// getHookDestinationPath asks destinationFunc for the destination of the file, an empty path means skip it.
+// Paths that are absolute or leave the destination are rejected.
+func getHookDestinationPath(destinationFunc organizer.DestinationFunc, destinationPath string, fileInfo FileInfo) (string, error) {
+	mediaType := organizer.MediaType(0)
+	switch fileInfo.FileType {
+	case FileTypeImage:
+		mediaType = organizer.Image
+	case FileTypeVideo:
+		mediaType = organizer.Video
+	}
+	hashValue, _ := hex.DecodeString(fileInfo.Hash)
+
+	generatedPath, err := destinationFunc(fileInfo.Path, organizer.MediaMeta{
+		Type:            mediaType,
+		Created:         fileInfo.Created,
+		HasCreationDate: fileInfo.HasCreationDate,
+		Country:         fileInfo.Country,
+		Hash:            hashValue,
+		IsDuplicate:     fileInfo.isDuplicate,
+	})
+	if err != nil || generatedPath == "" {
+		return "", err
+	}
+
+	return organizer.JoinDestination(destinationPath, generatedPath)
+}
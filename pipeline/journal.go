@@ -0,0 +1,176 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// journalEntry is a single move recorded in a journal, as one JSON line.
+type journalEntry struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Time        time.Time `json:"time"`
+	Hash        string    `json:"hash"`
+}
+
+// Journal records every move of a run, so `mediarizer2 undo` can put the files back.
+// Entries are appended as they happen, so an interrupted run leaves a usable journal.
+type Journal struct {
+	mu        sync.Mutex
+	file      *os.File
+	hashCache hash.Map
+}
+
+// OpenJournal opens the journal at path for appending, hashing moved files through hashCache.
+func OpenJournal(path string, hashCache hash.Map) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %v", path, err)
+	}
+
+	return &Journal{file: file, hashCache: hashCache}, nil
+}
+
+// HashOf returns the hex encoded hash of the file at path, before it is moved.
+func (journal *Journal) HashOf(path string) (string, error) {
+	hashValue, err := hash.GetFileHash(path, journal.hashCache)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file hash for %s: %v", path, err)
+	}
+
+	return hex.EncodeToString(hashValue), nil
+}
+
+// Record appends the move of sourcePath to destinationPath, both made absolute.
+func (journal *Journal) Record(sourcePath, destinationPath, hashStr string) error {
+	absSource, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %v", sourcePath, err)
+	}
+
+	absDestination, err := filepath.Abs(destinationPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %v", destinationPath, err)
+	}
+
+	line, err := json.Marshal(journalEntry{Source: absSource, Destination: absDestination, Time: time.Now(), Hash: hashStr})
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry for %s: %v", sourcePath, err)
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	if _, err := journal.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal %s: %v", journal.file.Name(), err)
+	}
+
+	return nil
+}
+
+// Close flushes the journal file to disk and closes it.
+func (journal *Journal) Close() error {
+	if err := journal.file.Sync(); err != nil {
+		journal.file.Close()
+		return fmt.Errorf("failed to flush journal %s: %v", journal.file.Name(), err)
+	}
+
+	if err := journal.file.Close(); err != nil {
+		return fmt.Errorf("failed to close journal %s: %v", journal.file.Name(), err)
+	}
+
+	return nil
+}
+
+// readJournal reads the entries of the journal at path in the order they were recorded.
+func readJournal(path string) ([]journalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode line %d of journal %s: %v", line, path, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %v", path, err)
+	}
+
+	return entries, nil
+}
+
+// UndoJournal moves the files of the journal at path back, newest move first. A file is only moved
+// back while its hash still matches the journal and nothing occupies its original path, every other
+// entry is reported and left alone. It returns the number of restored files.
+func UndoJournal(path string) (int, error) {
+	entries, err := readJournal(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var restored, failed int
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := undoEntry(entries[i]); err != nil {
+			logger(LoggerTypeWarning, err.Error())
+			failed++
+		} else {
+			restored++
+		}
+	}
+
+	if failed > 0 {
+		return restored, fmt.Errorf("failed to restore %d of %d files of journal %s", failed, len(entries), path)
+	}
+
+	return restored, nil
+}
+
+// undoEntry moves the file of entry back to its source after verifying it.
+func undoEntry(entry journalEntry) error {
+	if _, err := os.Stat(entry.Source); err == nil {
+		return fmt.Errorf("not restoring %s, its original path %s is taken", entry.Destination, entry.Source)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check original path %s: %v", entry.Source, err)
+	}
+
+	hashValue, err := hash.GetFileHash(entry.Destination, &sync.Map{})
+	if err != nil {
+		return fmt.Errorf("failed to get file hash for %s: %v", entry.Destination, err)
+	}
+	if hex.EncodeToString(hashValue) != entry.Hash {
+		return fmt.Errorf("not restoring %s, it changed since it was moved", entry.Destination)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(entry.Source), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(entry.Source), err)
+	}
+
+	var renamed int64
+	if err := RenameFile(entry.Destination, entry.Source, false, &renamed, nil); err != nil {
+		return err
+	}
+
+	logger(LoggerTypeVerbose, fmt.Sprintf("restored %s to %s", entry.Destination, entry.Source))
+	return nil
+}
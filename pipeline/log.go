@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/report"
+)
+
+const (
+	LoggerTypeInfo    = "info"
+	LoggerTypeVerbose = "verbose"
+	LoggerTypeWarning = "warning"
+	LoggerTypeError   = "error"
+)
+
+// Logger, when set, receives every line a run logs, of one of the LoggerType kinds. Lines are
+// discarded otherwise.
+var Logger func(loggerType string, message string)
+
+// RecordLogger, when set, receives the structured records of a run, such as the result of every file.
+var RecordLogger func(level slog.Level, message string, args ...any)
+
+func logger(loggerType string, message string) {
+	if Logger != nil {
+		Logger(loggerType, message)
+	}
+}
+
+func logStructured(level slog.Level, message string, args ...any) {
+	if RecordLogger != nil {
+		RecordLogger(level, message, args...)
+	}
+}
+
+// logFileResult writes the result of a file to the log file, failures as errors.
+func logFileResult(entry report.Entry) {
+	level := slog.LevelInfo
+	args := []any{"path", entry.Source, "action", entry.Action}
+	if entry.Destination != "" {
+		args = append(args, "destination", entry.Destination)
+	}
+	if entry.Hash != "" {
+		args = append(args, "hash", entry.Hash)
+	}
+	if entry.Error != "" {
+		level = slog.LevelError
+		args = append(args, "error", entry.Error)
+	}
+
+	logStructured(level, "file "+entry.Action, args...)
+}
+
+// reportPanic sends a panic raised while processing path to errorQueue so the worker carries on with the next file.
+func reportPanic(path string, errorQueue chan<- error) {
+	if value := recover(); value != nil {
+		errorQueue <- hash.NewPanicError(path, value)
+	}
+}
+
+func logMoveAction(sourcePath, destinationDirectory string, isDuplicate bool, duplicateStrategy string) (string, error) {
+	colorCode := "\033[32m"
+	actionName := "Moved (original)"
+
+	fileName := filepath.Base(sourcePath)
+
+	if isDuplicate {
+		switch duplicateStrategy {
+		case "move":
+			colorCode = "\033[33m"
+			actionName = "Moved (duplicate)"
+		case "skip":
+			colorCode = "\033[34m"
+			actionName = "Skipped (duplicate)"
+			return fmt.Sprintf("\033[1m%s%s\033[0m %s\n", colorCode, actionName, fileName), nil
+		case "delete":
+			colorCode = "\033[31m"
+			actionName = "Deleted (duplicate)"
+			return fmt.Sprintf("\033[1m%s%s\033[0m %s\n", colorCode, actionName, fileName), nil
+		case "hardlink":
+			colorCode = "\033[36m"
+			actionName = "Linked (duplicate)"
+			return fmt.Sprintf("\033[1m%s%s\033[0m %s\n", colorCode, actionName, fileName), nil
+		default:
+			colorCode = "\033[35m"
+			actionName = "Unknown Operation"
+		}
+	}
+
+	const maxPathLength = 90
+	var source, destination string
+
+	fileInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	fileSizeMB := float64(fileInfo.Size()) / 1024.0 / 1024.0
+	fileSizeStr := fmt.Sprintf("%.2fMb", fileSizeMB)
+
+	sourceDir := filepath.Dir(sourcePath)
+	if len(sourceDir) > maxPathLength {
+		source = "..." + sourceDir[len(sourceDir)-maxPathLength:]
+	} else {
+		source = sourceDir
+	}
+
+	if len(destinationDirectory) > maxPathLength {
+		destination = "..." + destinationDirectory[len(destinationDirectory)-maxPathLength:]
+	} else {
+		destination = destinationDirectory
+	}
+
+	log := fmt.Sprintf(
+		"\033[1m[%s] %s%s\033[0m %s\n └─ from %s%s\033[0m\n └─── to %s%s\033[0m\n",
+		fileSizeStr, colorCode, actionName, fileName, colorCode, source, colorCode, destination,
+	)
+	return log, nil
+}
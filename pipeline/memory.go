@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// memorySampleInterval is how often a memoryMonitor reads the heap usage.
+const memorySampleInterval = time.Second
+
+// memoryMonitor tracks the peak heap usage of a run by sampling it at an interval.
+type memoryMonitor struct {
+	mu   sync.Mutex
+	peak uint64
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startMemoryMonitor samples the heap usage every memorySampleInterval until Stop is called.
+func startMemoryMonitor() *memoryMonitor {
+	monitor := &memoryMonitor{stop: make(chan struct{}), done: make(chan struct{})}
+	monitor.sample()
+
+	go func() {
+		defer close(monitor.done)
+
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				monitor.sample()
+			case <-monitor.stop:
+				return
+			}
+		}
+	}()
+
+	return monitor
+}
+
+// sample records the heap in use if it is the highest seen.
+func (monitor *memoryMonitor) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	if stats.HeapInuse > monitor.peak {
+		monitor.peak = stats.HeapInuse
+	}
+}
+
+// Stop stops sampling and returns the peak heap usage in bytes, sampled once more on the way out.
+func (monitor *memoryMonitor) Stop() uint64 {
+	close(monitor.stop)
+	<-monitor.done
+	monitor.sample()
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	return monitor.peak
+}
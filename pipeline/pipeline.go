@@ -0,0 +1,756 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/duplicate"
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/organizer"
+	"github.com/keybraker/mediarizer-2/progress"
+	"github.com/keybraker/mediarizer-2/report"
+)
+
+// Options configures the stages Run composes.
+type Options struct {
+	SourcePath      string
+	DestinationPath string
+	// ExcludePath is a directory inside the source that is neither deduplicated nor organised.
+	ExcludePath string
+	FileTypes   []string
+	Photos      bool
+	Videos      bool
+	// Filter leaves input files out by name, size and modification time as the source is walked.
+	Filter WalkFilter
+	// FollowSymlinks walks into symlinked directories and organises the targets of symlinked files,
+	// which are otherwise skipped.
+	FollowSymlinks bool
+
+	// Dedupe removes all but one copy of every group of identical source files before organising.
+	Dedupe bool
+	// Keep selects the copy of a duplicate group that survives deduplication.
+	Keep duplicate.KeepPolicy
+	// ReviewDuplicates moves the redundant copies into the duplicates directory of the destination
+	// instead of deleting them, next to a mapping of every copy to the kept original it matches.
+	ReviewDuplicates bool
+	// Equality defines which source files are duplicates, identical bytes when nil.
+	Equality duplicate.Equality
+	// FuzzyDuplicates also groups images whose perceptual hashes differ by at most FuzzyDistance
+	// bits, so resized or re-encoded copies count as duplicates.
+	FuzzyDuplicates bool
+	FuzzyDistance   int
+	// FastHash compares source files by size and a fingerprint of their first and last megabyte,
+	// only hashing the files whose fingerprints collide completely.
+	FastHash bool
+
+	// Organise moves the source files into the destination.
+	Organise     bool
+	HashOptions  hash.Options
+	IgnoreHashes map[string]bool
+	SkipIgnored  bool
+	GeoLocation  bool
+	MoveUnknown  bool
+	Format       string
+	Verbose      bool
+	// DuplicateStrategy is the action taken on files already in the destination, DuplicateMove when empty.
+	DuplicateStrategy string
+	// DuplicateFolder, when set, is where duplicates are moved to, at their organised relative path,
+	// instead of a DUPLICATE folder next to every organised folder.
+	DuplicateFolder string
+	NameTemplate    string
+	RenameOnly      bool
+	Flat            bool
+	// CameraMode organises files into camera model folders, "camera" or nested under their date with
+	// "date", and is off when empty.
+	CameraMode string
+	// Layout, when set, is the folder template files are organised into instead of the default layout.
+	Layout string
+	// Destination, when set, places every file instead of the layout and name template, for routing
+	// no layout can express. An empty path leaves the file where it is.
+	Destination organizer.DestinationFunc
+	RawPairs    bool
+	RawPrimary  string
+	// Routes send screenshots, messaging app media and downloads to layouts of their own.
+	Routes []RouteRule
+	// Sidecars moves the XMP, AAE, THM and SRT files of a media file along with it.
+	Sidecars bool
+	// LivePhotos moves the video of a Live Photo along with its still, or removes it with DiscardLiveVideos.
+	LivePhotos        bool
+	DiscardLiveVideos bool
+	// Bursts places every frame of a burst by the capture date of the frame leading it.
+	Bursts bool
+	// VerifyMedia decodes the images and probes the video containers of the source, failing the files
+	// found corrupt, or moving them into the Corrupted folder of the destination with QuarantineCorrupt.
+	VerifyMedia       bool
+	QuarantineCorrupt bool
+	// DateSources is the chain capture dates are read from, the modification time being the usual last
+	// resort, metadata.DefaultDateSources when nil.
+	DateSources []metadata.DateSource
+	// DateCorrection shifts the capture dates of cameras whose clock was off or in another timezone.
+	DateCorrection DateCorrection
+	// Transfer is how files are brought into the destination, TransferMove when empty.
+	Transfer string
+	// Mover, when set, moves the files of TransferMove into the destination instead of the
+	// organizer.RenameMover, such as to upload them. The copy transfers copy and verify files as usual.
+	Mover organizer.Mover
+	// OnCollision is how a destination path already taken is resolved, CollisionRenameSuffix when empty.
+	OnCollision string
+	// PermanentDelete deletes duplicates and discarded files rather than moving them to the trash.
+	PermanentDelete bool
+
+	// Journal, when set, records every move so the run can be undone.
+	Journal *Journal
+	// Plan, when set, records the operations of both stages instead of carrying them out.
+	Plan *Plan
+
+	// Report, when set, collects the result of every source file.
+	Report *report.Report
+	// Checkpoint, when set, records the source files completed, and those it already holds are skipped.
+	Checkpoint *Checkpoint
+	// FailFast ends the run on the first file that can not be read or hashed, or duplicate group that
+	// can not be resolved. By default they are listed in Result.Failed and the run carries on.
+	FailFast bool
+	// Limits tune the workers, open files and read rate of both stages to the storage.
+	Limits IOLimits
+	// Progress, when set, receives the progress events of both stages.
+	Progress *progress.Tracker
+
+	// SpillAfter, when positive, bounds the hash-map of the destination path to this many entries in
+	// memory, spilling the rest to a temporary database in SpillDir, and leaves the destination files
+	// out of memory by walking the path again to hash it instead of listing it first.
+	SpillAfter int
+	SpillDir   string
+
+	// HashCache is shared by both stages, so files hashed while deduplicating are not hashed again.
+	HashCache hash.Map
+	// WarnQueue and ErrorQueue receive the warnings and the errors of files, which are logged when
+	// they are nil.
+	WarnQueue  chan string
+	ErrorQueue chan error
+
+	// DestinationHashes, when set, is the hash-map of the destination shared by the runs of several
+	// sources into it, so only the first of them hashes the destination path.
+	DestinationHashes *DestinationHashes
+}
+
+// DestinationHashes is the hash-map of a destination built by the first run into it, which every
+// later run finds duplicates in and adds its own files to.
+type DestinationHashes struct {
+	hashes   hash.Map
+	spillMap *hash.SpillMap
+}
+
+// Close removes the entries of the hash-map spilled to disk, if any.
+func (shared *DestinationHashes) Close() {
+	if shared.spillMap == nil {
+		return
+	}
+
+	if err := shared.spillMap.Close(); err != nil {
+		logger(LoggerTypeError, err.Error())
+	}
+}
+
+// Spilled returns the number of entries of the shared hash-map spilled to disk.
+func (shared *DestinationHashes) Spilled() int64 {
+	if shared.spillMap == nil {
+		return 0
+	}
+
+	return shared.spillMap.Stats().Spilled
+}
+
+// Result summarises a Run.
+type Result struct {
+	// Removed lists the redundant source copies deleted by the dedupe stage.
+	Removed []string
+	// Reviewed lists the redundant source copies moved into the duplicates directory instead.
+	Reviewed []ReviewedCopy
+	// Duplicates lists the action the organise stage took on every duplicate it found.
+	Duplicates []HandledDuplicate
+	// Hash is the result of hashing the destination path in the organise stage.
+	Hash hash.Result
+	// Processed is the number of source files the organise stage handled.
+	Processed int
+	// Renamed is the number of files the organise stage renamed in place.
+	Renamed int64
+	// Failed lists the files either stage failed on.
+	Failed []FailedFile
+	// PeakHeapBytes is the most heap memory in use while the run was sampled every second.
+	PeakHeapBytes uint64
+	// SpilledHashes is the number of hash-map entries spilled to disk with Options.SpillAfter.
+	SpilledHashes int64
+}
+
+// FailedFile is a file a run failed on, and left where it was.
+type FailedFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	// Kind is report.ErrorTransient for files a later run may well get past, report.ErrorPermanent otherwise.
+	Kind string `json:"kind"`
+}
+
+// errorKind classifies err as report.ErrorTransient or report.ErrorPermanent.
+func errorKind(err error) string {
+	if hash.IsTransient(err) {
+		return report.ErrorTransient
+	}
+
+	return report.ErrorPermanent
+}
+
+// Add merges the result of another run over the same paths into result.
+func (result *Result) Add(other Result) {
+	result.Removed = append(result.Removed, other.Removed...)
+	result.Reviewed = append(result.Reviewed, other.Reviewed...)
+	result.Duplicates = append(result.Duplicates, other.Duplicates...)
+	result.Hash.Unstable = append(result.Hash.Unstable, other.Hash.Unstable...)
+	result.Hash.TimedOut = append(result.Hash.TimedOut, other.Hash.TimedOut...)
+	result.Hash.Vanished = append(result.Hash.Vanished, other.Hash.Vanished...)
+	result.Hash.CacheHits += other.Hash.CacheHits
+	result.Hash.CacheMisses += other.Hash.CacheMisses
+	result.Processed += other.Processed
+	result.Renamed += other.Renamed
+	result.Failed = append(result.Failed, other.Failed...)
+	result.PeakHeapBytes = max(result.PeakHeapBytes, other.PeakHeapBytes)
+	result.SpilledHashes += other.SpilledHashes
+}
+
+// Run hashes the source files, keeps one copy of every duplicate group and organises the survivors
+// into the destination, reporting all stages to a single progress tracker. The other copies are deleted,
+// or set aside for review with ReviewDuplicates. Cancelling ctx stops the stages once the files in
+// flight are done, and Run then fails, leaving the files it did not get to untouched.
+func Run(ctx context.Context, opts Options) (Result, error) {
+	// Every run collects its own report, which the failures of the result are taken from.
+	runReport := report.New()
+	runReport.Subscribe(logFileResult)
+	if opts.Checkpoint != nil {
+		runReport.Subscribe(func(entry report.Entry) {
+			if entry.Action != report.ActionFailed {
+				opts.Checkpoint.complete(entry.Source)
+			}
+		})
+	}
+	if opts.WarnQueue == nil {
+		opts.WarnQueue = make(chan string)
+		defer close(opts.WarnQueue)
+		go func(warnQueue <-chan string) {
+			for warning := range warnQueue {
+				logger(LoggerTypeWarning, warning)
+			}
+		}(opts.WarnQueue)
+	}
+	if opts.ErrorQueue == nil {
+		opts.ErrorQueue = make(chan error)
+		defer close(opts.ErrorQueue)
+		go func(errorQueue <-chan error) {
+			for err := range errorQueue {
+				logger(LoggerTypeError, err.Error())
+			}
+		}(opts.ErrorQueue)
+	}
+
+	monitor := startMemoryMonitor()
+	result, err := run(ctx, opts, runReport)
+	result.PeakHeapBytes = monitor.Stop()
+
+	for _, entry := range runReport.Entries() {
+		if entry.Action == report.ActionFailed {
+			result.Failed = append(result.Failed, FailedFile{Path: entry.Source, Error: entry.Error, Kind: entry.ErrorKind})
+		}
+		opts.Report.Add(entry)
+	}
+
+	return result, err
+}
+
+// organiseStage is what the creator and consumer of a run share, the options of the run and the
+// state of its organise stage.
+type organiseStage struct {
+	opts *Options
+	// fileQueue carries the files the creator read to the consumer.
+	fileQueue chan FileInfo
+	// fileHashMap maps the hashes of the files in the destination to their paths.
+	fileHashMap  hash.Map
+	groups       *mediaGroups
+	duplicates   *DuplicateLog
+	tracker      *progress.Tracker
+	runReport    *report.Report
+	throttle     *throttle
+	renamedFiles *int64
+}
+
+// moveOptions returns how the consumer moves files into the destination.
+func (stage *organiseStage) moveOptions() moveOptions {
+	return moveOptions{
+		verbose:           stage.opts.Verbose,
+		duplicateStrategy: stage.opts.DuplicateStrategy,
+		renameOnly:        stage.opts.RenameOnly,
+		transfer:          stage.opts.Transfer,
+		mover:             stage.opts.Mover,
+		onCollision:       stage.opts.OnCollision,
+		permanentDelete:   stage.opts.PermanentDelete,
+		renamedFiles:      stage.renamedFiles,
+		journal:           stage.opts.Journal,
+		throttle:          stage.throttle,
+	}
+}
+
+// run implements Run, adding the result of every source file to runReport.
+func run(ctx context.Context, opts Options, runReport *report.Report) (Result, error) {
+	var result Result
+
+	if opts.HashCache == nil {
+		opts.HashCache = &sync.Map{}
+	}
+	if opts.Progress == nil {
+		opts.Progress = progress.NewTracker()
+	}
+	if opts.DuplicateStrategy == "" {
+		opts.DuplicateStrategy = DuplicateMove
+	}
+	if opts.DateSources == nil {
+		opts.DateSources = metadata.DefaultDateSources
+	}
+	tracker := opts.Progress
+	opts.HashOptions.FailFast = opts.FailFast
+	opts.HashOptions.Context = ctx
+
+	// A single limiter keeps hashing the destination and copying the source below the same rate.
+	if opts.Limits.BytesPerSecond > 0 {
+		opts.HashOptions.Limiter = hash.NewRateLimiter(opts.Limits.BytesPerSecond)
+	}
+	if opts.Limits.Workers > 0 && opts.HashOptions.MaxConcurrency == 0 {
+		opts.HashOptions.MaxConcurrency = opts.Limits.Workers
+	}
+	opts.HashOptions.MaxOpenFiles = opts.Limits.MaxOpenFiles
+	opts.HashOptions.Retry = opts.Limits.retryPolicy()
+	throttle := newThrottle(ctx, opts.Limits, opts.HashOptions.Limiter)
+
+	// The source files are only listed for the stages that need all of them at once, the organise
+	// stage streaming them from its own walk otherwise.
+	var sourceFiles []string
+	var sourceCount int
+	if opts.Dedupe || opts.Checkpoint != nil || opts.LivePhotos || opts.Bursts {
+		sourceFiles = ListFiles(opts.SourcePath, opts.ExcludePath, opts.Filter, opts.FollowSymlinks, opts.FileTypes, opts.Photos, opts.Videos)
+		if opts.Checkpoint != nil {
+			sourceFiles = slices.DeleteFunc(sourceFiles, opts.Checkpoint.isCompleted)
+			opts.Checkpoint.addPending(sourceFiles)
+		}
+		sourceCount = len(sourceFiles)
+	} else {
+		sourceCount = CountFiles(opts.SourcePath, opts.ExcludePath, opts.Filter, opts.FollowSymlinks, opts.FileTypes, opts.Photos, opts.Videos)
+	}
+
+	// Copies under review match files organised into the destination, which must not be seen as duplicates of them.
+	reviewPath := filepath.Join(opts.DestinationPath, ReviewDirectoryName)
+	if opts.ReviewDuplicates {
+		opts.HashOptions.ExcludePaths = append(opts.HashOptions.ExcludePaths, reviewPath)
+	}
+	// Moved duplicates would otherwise be taken for originals by the next run.
+	if opts.DuplicateFolder != "" {
+		opts.HashOptions.ExcludePaths = append(opts.HashOptions.ExcludePaths, opts.DuplicateFolder)
+	}
+
+	// A destination an earlier run into it already hashed is not hashed again.
+	hashDestination := opts.Organise && (opts.DestinationHashes == nil || opts.DestinationHashes.hashes == nil)
+
+	var destinationPrescan *hash.Prescan
+	var destinationCount int64
+	if hashDestination {
+		logger(LoggerTypeInfo, "Creating file hash-map on the destination path.")
+		var err error
+		walkOptions := hash.Options{ExcludePaths: opts.HashOptions.ExcludePaths, FailFast: opts.FailFast, Context: ctx}
+		if opts.SpillAfter > 0 {
+			destinationCount, _, err = hash.EstimateScan(opts.DestinationPath, walkOptions)
+		} else if destinationPrescan, err = hash.PrescanPath(opts.DestinationPath, walkOptions); err == nil {
+			destinationCount = destinationPrescan.TotalFiles
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// setAside counts the source copies the dedupe stage removed or plans to remove.
+	var setAside int
+
+	if opts.Dedupe {
+		tracker.Add(progress.FilesDiscovered, int64(sourceCount), opts.SourcePath)
+	}
+	if opts.Organise {
+		tracker.Add(progress.FilesDiscovered, destinationCount, opts.DestinationPath)
+		tracker.Add(progress.FilesDiscovered, int64(sourceCount), opts.SourcePath)
+	}
+
+	if opts.Dedupe {
+		findOptions := duplicate.Options{Equality: opts.Equality, Algorithm: opts.HashOptions.Algorithm}
+		if _, exactBytes := opts.Equality.(duplicate.ExactBytes); exactBytes {
+			findOptions.Equality = duplicate.ExactBytes{Algorithm: opts.HashOptions.Algorithm}
+		}
+		if opts.FastHash {
+			findOptions.Strategy = duplicate.Quick
+		}
+
+		groups, failed, err := findSourceDuplicates(ctx, sourceFiles, findOptions, opts.HashCache, tracker, opts.FailFast, opts.Limits)
+		if err != nil {
+			return result, err
+		}
+		for _, fileErr := range failed {
+			opts.ErrorQueue <- fileErr
+			runReport.Add(report.Entry{Source: fileErr.Path, Action: report.ActionFailed, Error: fileErr.Error(), ErrorKind: errorKind(fileErr)})
+		}
+
+		if opts.FuzzyDuplicates {
+			groups, err = addVisualDuplicates(groups, sourceFiles, opts.FuzzyDistance)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		// No copy is removed once the run is cancelled, not knowing the groups are complete.
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		for _, group := range groups {
+			tracker.Add(progress.DuplicatesFound, int64(len(group.Paths)-1), group.Paths[0])
+		}
+
+		var groupFailures []*duplicate.GroupError
+		if opts.Plan != nil {
+			setAside, err = planDuplicates(groups, opts.Keep.Resolver(), opts.ReviewDuplicates, reviewPath, opts.Plan)
+		} else if opts.ReviewDuplicates {
+			result.Reviewed, groupFailures, err = MoveDuplicatesForReview(groups, opts.Keep.Resolver(), reviewPath, opts.Verbose, opts.Journal, throttle)
+		} else {
+			resolve := duplicate.TrashDuplicates
+			if opts.PermanentDelete {
+				resolve = duplicate.DeleteDuplicates
+			}
+			resolution := resolve(groups, opts.Keep.Resolver())
+			result.Removed, groupFailures = resolution.Removed, resolution.Failed
+		}
+		if err == nil && len(groupFailures) > 0 && opts.FailFast {
+			err = groupFailures[0]
+		}
+		if err != nil {
+			return result, err
+		}
+		setAside += len(result.Removed) + len(result.Reviewed)
+
+		reportDuplicates(runReport, groups, result.Removed, result.Reviewed)
+		for _, groupErr := range groupFailures {
+			opts.ErrorQueue <- groupErr
+			for _, path := range groupErr.Group.Paths {
+				runReport.Add(report.Entry{Source: path, Hash: groupErr.Group.Hash, Action: report.ActionFailed, Error: groupErr.Error(), ErrorKind: errorKind(groupErr)})
+			}
+		}
+
+		// Removed copies are never organised, so they count as done for the organise stage too.
+		if opts.Organise {
+			tracker.Add(progress.FilesProcessed, int64(setAside), opts.SourcePath)
+		}
+	}
+
+	if !opts.Organise {
+		return result, nil
+	}
+
+	var fileHashMap hash.Map
+	var spillMap *hash.SpillMap
+	if hashDestination {
+		hashStart := time.Now()
+
+		hashOptions := opts.HashOptions
+		hashOptions.Prescan = destinationPrescan
+		hashOptions.OnProgress = func(filePath string, size int64) {
+			tracker.Add(progress.BytesHashed, size, filePath)
+			tracker.Add(progress.FilesProcessed, 1, filePath)
+		}
+
+		if opts.SpillAfter > 0 {
+			var err error
+			if spillMap, err = hash.NewSpillMap(opts.SpillDir, opts.SpillAfter); err != nil {
+				return result, err
+			}
+			if opts.DestinationHashes != nil {
+				opts.DestinationHashes.spillMap = spillMap
+			} else {
+				defer func() {
+					if err := spillMap.Close(); err != nil {
+						logger(LoggerTypeError, err.Error())
+					}
+				}()
+			}
+			hashOptions.HashMap = spillMap
+		}
+
+		var hashedFiles int64
+		var hashResult hash.Result
+		var err error
+		fileHashMap, hashResult, err = hash.HashImagesInPath(opts.DestinationPath, opts.HashCache, &hashedFiles, hashOptions)
+		if err != nil {
+			return result, fmt.Errorf("failed to create file hash map: %v", err)
+		}
+		result.Hash = hashResult
+
+		for _, unstablePath := range hashResult.Unstable {
+			opts.WarnQueue <- fmt.Sprintf("file changed while hashing, left out of hash-map: %v", unstablePath)
+		}
+
+		for _, timedOutPath := range hashResult.TimedOut {
+			opts.WarnQueue <- fmt.Sprintf("file read timed out, left out of hash-map: %v", timedOutPath)
+		}
+
+		for _, vanishedPath := range hashResult.Vanished {
+			opts.WarnQueue <- fmt.Sprintf("file deleted while scanning, left out of hash-map: %v", vanishedPath)
+		}
+
+		for _, panicErr := range hashResult.Panicked {
+			opts.ErrorQueue <- panicErr
+		}
+
+		for _, fileErr := range hashResult.Failed {
+			opts.ErrorQueue <- fileErr
+			runReport.Add(report.Entry{Source: fileErr.Path, Action: report.ActionFailed, Error: fileErr.Error(), ErrorKind: errorKind(fileErr)})
+		}
+
+		logger(LoggerTypeInfo, fmt.Sprintf("File hash-map created in %.2f seconds.", time.Since(hashStart).Seconds()))
+
+		if opts.DestinationHashes != nil {
+			opts.DestinationHashes.hashes = fileHashMap
+		}
+	} else {
+		logger(LoggerTypeInfo, "Reusing the file hash-map of the destination path.")
+		fileHashMap, spillMap = opts.DestinationHashes.hashes, opts.DestinationHashes.spillMap
+	}
+
+	var groups *mediaGroups
+	if opts.LivePhotos || opts.Bursts {
+		groups = groupMedia(sourceFiles, opts.LivePhotos, opts.Bursts)
+	}
+
+	fileQueue := make(chan FileInfo, 100)
+	done := make(chan struct{})
+	duplicates := &DuplicateLog{}
+
+	if opts.OnCollision == "" {
+		opts.OnCollision = CollisionRenameSuffix
+	}
+
+	stage := &organiseStage{
+		opts:         &opts,
+		fileQueue:    fileQueue,
+		fileHashMap:  fileHashMap,
+		groups:       groups,
+		duplicates:   duplicates,
+		tracker:      tracker,
+		runReport:    runReport,
+		throttle:     throttle,
+		renamedFiles: &result.Renamed,
+	}
+	go creator(ctx, stage)
+	go consumer(ctx, stage, done)
+
+	<-done
+
+	result.Duplicates = duplicates.Handled()
+	result.Processed = sourceCount - setAside
+
+	if spillMap != nil {
+		// A shared hash-map spills for several runs, which is counted once all of them are done.
+		if opts.DestinationHashes == nil {
+			result.SpilledHashes = spillMap.Stats().Spilled
+		}
+		if err := spillMap.Err(); err != nil {
+			opts.ErrorQueue <- fmt.Errorf("duplicates may have been missed: %v", err)
+		}
+	}
+
+	return result, ctx.Err()
+}
+
+// findSourceDuplicates returns the duplicate groups of paths under findOptions, reporting every handled
+// file to tracker. Files compared by all their bytes are hashed into hashCache first, and those that
+// can not be hashed are returned and left out of the groups, unless failFast makes the first of them
+// the error, by a worker per CPU or limits.Workers, until ctx is cancelled. Other comparisons fail on the
+// first file they can not read.
+func findSourceDuplicates(ctx context.Context, paths []string, findOptions duplicate.Options, hashCache hash.Map, tracker *progress.Tracker, failFast bool, limits IOLimits) ([]duplicate.DuplicateGroup, []*hash.FileError, error) {
+	_, exactBytes := findOptions.Equality.(duplicate.ExactBytes)
+	if findOptions.Equality != nil && !exactBytes || findOptions.Strategy == duplicate.Quick {
+		groups, err := duplicate.FindDuplicates(paths, findOptions, hashCache)
+		tracker.Add(progress.FilesProcessed, int64(len(paths)), "")
+		return groups, nil, err
+	}
+
+	pathChan := make(chan string)
+	var mu sync.Mutex
+	var failed []*hash.FileError
+	var wg sync.WaitGroup
+
+	workers := runtime.NumCPU()
+	if limits.Workers > 0 {
+		workers = limits.Workers
+	}
+
+	for i := 0; i < limits.capWorkers(workers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathChan {
+				err := limits.retryPolicy().Do(ctx, func() error {
+					_, err := hash.GetFileHashWithAlgorithm(path, hashCache, findOptions.Algorithm)
+					return err
+				})
+				if err != nil {
+					mu.Lock()
+					failed = append(failed, &hash.FileError{Path: path, Err: fmt.Errorf("failed to get file hash for %s: %w", path, err)})
+					mu.Unlock()
+				} else if info, err := os.Stat(path); err == nil {
+					tracker.Add(progress.BytesHashed, info.Size(), path)
+				}
+				tracker.Add(progress.FilesProcessed, 1, path)
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		pathChan <- path
+	}
+	close(pathChan)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Path < failed[j].Path })
+	if len(failed) > 0 && failFast {
+		return nil, nil, failed[0]
+	}
+
+	hashed := paths
+	if len(failed) > 0 {
+		failedPaths := make(map[string]bool, len(failed))
+		for _, fileErr := range failed {
+			failedPaths[fileErr.Path] = true
+		}
+
+		hashed = nil
+		for _, path := range paths {
+			if !failedPaths[path] {
+				hashed = append(hashed, path)
+			}
+		}
+	}
+
+	groups, err := duplicate.FindDuplicates(hashed, findOptions, hashCache)
+	return groups, failed, err
+}
+
+// reportDuplicates adds the copies of groups the dedupe stage removed or moved for review to runReport.
+func reportDuplicates(runReport *report.Report, groups []duplicate.DuplicateGroup, removed []string, reviewed []ReviewedCopy) {
+	groupHashes := make(map[string]string)
+	for _, group := range groups {
+		for _, path := range group.Paths {
+			groupHashes[path] = group.Hash
+		}
+	}
+
+	for _, removedPath := range removed {
+		runReport.Add(report.Entry{Source: removedPath, Hash: groupHashes[removedPath], Action: report.ActionDuplicateRemoved})
+	}
+	for _, reviewedCopy := range reviewed {
+		runReport.Add(report.Entry{Source: reviewedCopy.Source, Destination: reviewedCopy.Path, Hash: reviewedCopy.Hash, Action: report.ActionDuplicateReviewed})
+	}
+}
+
+// planDuplicates records in plan the removal of the copies resolve picks from every group, as moves
+// into reviewPath when review is set. It returns the number of planned removals and the first group
+// that could not be resolved.
+func planDuplicates(groups []duplicate.DuplicateGroup, resolve duplicate.Resolver, review bool, reviewPath string, plan *Plan) (int, error) {
+	var planned int
+	for _, group := range groups {
+		keep, remove, err := resolve(group)
+		if err != nil {
+			return planned, &duplicate.GroupError{Group: group, Err: err}
+		}
+		planned += len(remove)
+
+		for _, path := range remove {
+			operation := PlannedOperation{Action: PlanRemoveDuplicate, Source: path, Duplicate: true, Original: keep}
+			if review {
+				operation.Action = PlanReviewDuplicate
+				operation.Destination = filepath.Join(reviewPath, reviewGroupDirectory(keep, group.Hash), filepath.Base(path))
+			}
+			plan.Add(operation)
+		}
+	}
+
+	return planned, nil
+}
+
+// addVisualDuplicates merges the groups of visually alike images among paths into groups. Identical
+// images always fall into the same visual group, so the groups they formed before are dropped.
+func addVisualDuplicates(groups []duplicate.DuplicateGroup, paths []string, distance int) ([]duplicate.DuplicateGroup, error) {
+	visualGroups, err := duplicate.FindVisualDuplicates(paths, distance)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[string]bool)
+	for _, group := range visualGroups {
+		for _, path := range group.Paths {
+			grouped[path] = true
+		}
+	}
+
+	merged := visualGroups
+	for _, group := range groups {
+		if !grouped[group.Paths[0]] {
+			merged = append(merged, group)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Paths[0] < merged[j].Paths[0] })
+
+	return merged, nil
+}
+
+// ParseEquality returns the definition of duplicates named name, "bytes" or "pixels".
+func ParseEquality(name string) (duplicate.Equality, bool) {
+	switch name {
+	case "bytes":
+		return duplicate.ExactBytes{}, true
+	case "pixels":
+		return duplicate.SamePixels{}, true
+	default:
+		return nil, false
+	}
+}
+
+// ParseKeepPolicy returns the keep policy named name, "first", "oldest", "shortest" or "largest".
+func ParseKeepPolicy(name string) (duplicate.KeepPolicy, bool) {
+	switch name {
+	case "first":
+		return duplicate.KeepFirstPath, true
+	case "oldest":
+		return duplicate.KeepOldest, true
+	case "shortest":
+		return duplicate.KeepShortestPath, true
+	case "largest":
+		return duplicate.KeepLargest, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Actions of the operations recorded in a Plan.
+const (
+	PlanMove            = "move"
+	PlanCopy            = "copy"
+	PlanSkip            = "skip"
+	PlanDelete          = "delete"
+	PlanLink            = "link"
+	PlanRemoveDuplicate = "remove-duplicate"
+	PlanReviewDuplicate = "review-duplicate"
+	// PlanInterrupted marks the plan of a run that was interrupted, which lacks the files it did not get to.
+	PlanInterrupted = "interrupted"
+)
+
+// PlannedOperation is a single change a dry run would have made.
+type PlannedOperation struct {
+	Action      string `json:"action"`
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	// Duplicate flags files found to be duplicates of a file already in the destination or the input.
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Original is the file a duplicate matches, the kept copy for the dedupe stage.
+	Original string `json:"original,omitempty"`
+}
+
+// Plan collects the operations of a dry run in place of carrying them out. It is safe for concurrent use.
+type Plan struct {
+	mu         sync.Mutex
+	operations []PlannedOperation
+	// reserved holds the destinations of planned moves, which are free on disk but taken by the plan.
+	reserved map[string]bool
+	// removed holds the input files planned to be removed by the dedupe stage.
+	removed map[string]bool
+}
+
+// NewPlan creates an empty Plan.
+func NewPlan() *Plan {
+	return &Plan{reserved: make(map[string]bool), removed: make(map[string]bool)}
+}
+
+// Add records an operation, marking its destination as taken and the files the dedupe stage removes.
+func (plan *Plan) Add(operation PlannedOperation) {
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+
+	plan.operations = append(plan.operations, operation)
+	if operation.Destination != "" {
+		plan.reserved[operation.Destination] = true
+	}
+	if operation.Action == PlanRemoveDuplicate || operation.Action == PlanReviewDuplicate {
+		plan.removed[operation.Source] = true
+	}
+}
+
+// isRemoved checks if path is planned to be removed by the dedupe stage.
+func (plan *Plan) isRemoved(path string) bool {
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+
+	return plan.removed[path]
+}
+
+// planMove records a move, or a copy as action says, of sourcePath to destinationPath, resolving a
+// destination that exists on disk or is already taken by the plan like moveFile would with onCollision.
+// It returns the planned destination, or the file standing in for the source when it is already there.
+func (plan *Plan) planMove(sourcePath, destinationPath string, isDuplicate bool, action string, onCollision string) (string, error) {
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+
+	taken := func(path string) (bool, error) {
+		if plan.reserved[path] {
+			return true, nil
+		}
+
+		return FileExists(path)
+	}
+
+	newPath, identical, err := ResolveCollision(sourcePath, destinationPath, onCollision, taken)
+	if errors.Is(err, errCollisionSkipped) {
+		plan.operations = append(plan.operations, PlannedOperation{Action: PlanSkip, Source: sourcePath, Duplicate: isDuplicate})
+		return "", err
+	} else if err != nil {
+		return "", err
+	}
+
+	if identical {
+		// The source is only removed, as its content is already at the destination.
+		identicalAction := PlanDelete
+		if action == PlanCopy {
+			identicalAction = PlanSkip
+		}
+		plan.operations = append(plan.operations, PlannedOperation{Action: identicalAction, Source: sourcePath, Duplicate: isDuplicate, Original: newPath})
+		return newPath, nil
+	}
+
+	plan.reserved[newPath] = true
+	plan.operations = append(plan.operations, PlannedOperation{
+		Action:      action,
+		Source:      sourcePath,
+		Destination: newPath,
+		Duplicate:   isDuplicate,
+	})
+
+	return newPath, nil
+}
+
+// planAction returns the action planned for the files the organise stage transfers with transfer.
+func planAction(transfer string) string {
+	if transfer == TransferCopy {
+		return PlanCopy
+	}
+
+	return PlanMove
+}
+
+// Operations returns the recorded operations ordered by source path.
+func (plan *Plan) Operations() []PlannedOperation {
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+
+	operations := append([]PlannedOperation{}, plan.operations...)
+	sort.SliceStable(operations, func(i, j int) bool { return operations[i].Source < operations[j].Source })
+
+	return operations
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/hash"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// QuarantineCorruptFiles moves the photos under sourcePath that fail to decode into quarantinePath,
+// keeping their path relative to sourcePath. Valid files are never touched. It returns the moved files.
+func QuarantineCorruptFiles(sourcePath, quarantinePath string) ([]string, error) {
+	var corruptPaths []string
+	err := filepath.WalkDir(sourcePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != sourcePath && pathsafe.Within(quarantinePath, path) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || !IsPhoto(filepath.Ext(path)) {
+			return nil
+		}
+
+		if err := hash.ValidateImage(path); errors.Is(err, hash.ErrCorrupt) {
+			corruptPaths = append(corruptPaths, path)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var quarantined []string
+	for _, corruptPath := range corruptPaths {
+		destinationPath := quarantineDestination(sourcePath, quarantinePath, corruptPath)
+		if err := os.MkdirAll(filepath.Dir(destinationPath), os.ModePerm); err != nil {
+			return quarantined, fmt.Errorf("failed to create quarantine directory %s: %v", filepath.Dir(destinationPath), err)
+		}
+
+		destinationPath, err := GenerateUniquePathName(destinationPath)
+		if err != nil {
+			return quarantined, err
+		}
+
+		var renamedFiles int64
+		if err := RenameFile(corruptPath, destinationPath, false, &renamedFiles, nil); err != nil {
+			return quarantined, err
+		}
+
+		quarantined = append(quarantined, destinationPath)
+	}
+
+	return quarantined, nil
+}
+
+// quarantineDestination returns where the corrupt file at path goes in quarantinePath, at its path
+// relative to sourcePath. Files outside sourcePath, such as the targets of followed symlinks, keep only
+// their name.
+func quarantineDestination(sourcePath, quarantinePath, path string) string {
+	relPath, err := filepath.Rel(sourcePath, path)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		relPath = filepath.Base(path)
+	}
+
+	return filepath.Join(quarantinePath, relPath)
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var rawExtensions = []string{".arw", ".cr2", ".cr3", ".dng", ".nef", ".orf", ".raf", ".rw2"}
+
+var jpegExtensions = []string{".jpg", ".jpeg"}
+
+// isRaw checks if the extension belongs to a camera RAW format.
+func isRaw(fileExt string) bool {
+	return arrayContains(rawExtensions, strings.ToLower(fileExt))
+}
+
+// findSibling returns the file next to path with the same base name and one of the extensions, in either case.
+func findSibling(path string, extensions []string) (string, bool) {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+
+	for _, extension := range extensions {
+		for _, candidate := range []string{stem + extension, stem + strings.ToUpper(extension)} {
+			if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+				return candidate, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// rawCompanion returns the RAW file shot together with the JPEG at path, if there is one.
+func rawCompanion(path string) (string, bool) {
+	if !arrayContains(jpegExtensions, strings.ToLower(filepath.Ext(path))) {
+		return "", false
+	}
+
+	return findSibling(path, rawExtensions)
+}
+
+// jpegCompanion returns the JPEG shot together with the RAW file at path, if there is one.
+func jpegCompanion(path string) (string, bool) {
+	if !isRaw(filepath.Ext(path)) {
+		return "", false
+	}
+
+	return findSibling(path, jpegExtensions)
+}
+
+// walkedFile checks if the file at path is a regular file the walk of the input hands to processing,
+// which a RAW file and its JPEG are only left to each other for.
+func walkedFile(path string, opts *Options) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	return opts.Filter.keeps(opts.SourcePath, path, fs.FileInfoToDirEntry(info)) && !opts.Checkpoint.isCompleted(path)
+}
+
+// withoutRaw returns companions without the RAW file at raw and its sidecars.
+func withoutRaw(companions []string, raw string) []string {
+	if raw == "" {
+		return companions
+	}
+
+	excluded := append([]string{raw}, FindSidecars(raw)...)
+	var kept []string
+	for _, companion := range companions {
+		if !arrayContains(excluded, companion) {
+			kept = append(kept, companion)
+		}
+	}
+
+	return kept
+}
+
+// CompanionPath returns where a companion file goes when its primary, found at primarySource, is moved
+// to primaryPath. The companion keeps what follows the name of the primary, so IMG_1234.CR2.xmp goes along
+// with IMG_1234.jpg as the renamed primary with .CR2.xmp.
+func CompanionPath(primaryPath, primarySource, companion string) string {
+	stem := strings.TrimSuffix(primarySource, filepath.Ext(primarySource))
+	suffix := filepath.Ext(companion)
+	if strings.HasPrefix(companion, stem) {
+		suffix = companion[len(stem):]
+	}
+
+	return strings.TrimSuffix(primaryPath, filepath.Ext(primaryPath)) + suffix
+}
+
+// pairTaken returns a check, for ResolveCollision, of whether the primary path or any of the paths its
+// companions would go to exist, so a primary is only placed where all of them are free.
+func pairTaken(primarySource string, companions []string) func(primaryPath string) (bool, error) {
+	return func(primaryPath string) (bool, error) {
+		paths := []string{primaryPath}
+		for _, companion := range companions {
+			paths = append(paths, CompanionPath(primaryPath, primarySource, companion))
+		}
+
+		for _, path := range paths {
+			if exists, err := FileExists(path); err != nil || exists {
+				return exists, err
+			}
+		}
+
+		return false, nil
+	}
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/duplicate"
+)
+
+// ReviewDirectoryName is the directory of the destination that redundant copies are moved into for review.
+const ReviewDirectoryName = "duplicates"
+
+// reviewMappingName is the file of the review directory recording the original of every moved copy.
+const reviewMappingName = "duplicates.jsonl"
+
+// ReviewedCopy is a redundant copy moved into the review directory instead of being deleted.
+type ReviewedCopy struct {
+	// Source is where the copy was in the input.
+	Source string `json:"source"`
+	// Path is where the copy was moved to.
+	Path string `json:"path"`
+	// Original is the input path of the kept copy it matches, which is organised by date.
+	Original string `json:"original"`
+	// Hash is the key the copy and its original share, their file hash unless another equality is used.
+	Hash string `json:"hash"`
+}
+
+// MoveDuplicatesForReview moves the copies resolve picks for removal from every group into reviewPath,
+// one directory per group named after the kept original and its hash prefix, and appends the
+// moves to the mapping file there. Groups that fail are returned and the others moved regardless.
+func MoveDuplicatesForReview(groups []duplicate.DuplicateGroup, resolve duplicate.Resolver, reviewPath string, verbose bool, journal *Journal, throttle *throttle) ([]ReviewedCopy, []*duplicate.GroupError, error) {
+	var reviewed []ReviewedCopy
+	var failed []*duplicate.GroupError
+	var renamed int64
+
+	for _, group := range groups {
+		// The group key is the file hash by default, but any Equality can group the files.
+		hashStr := group.Hash
+		resolution := duplicate.ResolveDuplicates([]duplicate.DuplicateGroup{group}, resolve, func(keep, path string) error {
+			destination := filepath.Join(reviewPath, reviewGroupDirectory(keep, hashStr), filepath.Base(path))
+
+			moved, _, err := moveFile(path, destination, true, moveOptions{verbose: verbose, duplicateStrategy: DuplicateMove, transfer: TransferMove, onCollision: CollisionRenameSuffix, renamedFiles: &renamed, journal: journal, throttle: throttle})
+			if err != nil {
+				return err
+			}
+
+			reviewed = append(reviewed, ReviewedCopy{Source: path, Path: moved, Original: keep, Hash: hashStr})
+			return nil
+		})
+		failed = append(failed, resolution.Failed...)
+	}
+
+	if err := appendReviewMapping(reviewPath, reviewed); err != nil {
+		return reviewed, failed, err
+	}
+
+	return reviewed, failed, nil
+}
+
+// reviewGroupDirectory names the review directory of a group after its kept original and hash prefix.
+func reviewGroupDirectory(keep, hashStr string) string {
+	keepName := filepath.Base(keep)
+	return strings.TrimSuffix(keepName, filepath.Ext(keepName)) + "_" + hashStr[:min(12, len(hashStr))]
+}
+
+// appendReviewMapping appends a JSON line per reviewed copy to the mapping file of reviewPath,
+// so the mapping of earlier runs into the same destination is kept.
+func appendReviewMapping(reviewPath string, reviewed []ReviewedCopy) error {
+	if len(reviewed) == 0 {
+		return nil
+	}
+
+	mappingPath := filepath.Join(reviewPath, reviewMappingName)
+	file, err := os.OpenFile(mappingPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open duplicate mapping %s: %v", mappingPath, err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, reviewedCopy := range reviewed {
+		if err := encoder.Encode(reviewedCopy); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write duplicate mapping %s: %v", mappingPath, err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write duplicate mapping %s: %v", mappingPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/mediatype"
+	"github.com/keybraker/mediarizer-2/metadata"
+)
+
+// Kinds of files that did not come from a camera, which routes send to folders of their own.
+const (
+	KindScreenshot = "screenshot"
+	KindMessaging  = "messaging"
+	KindDownload   = "download"
+)
+
+// Classes every media file falls in, which routes send to folders of their own as well.
+const (
+	KindPhoto           = "photo"
+	KindAnimated        = "animated"
+	KindScreenRecording = "screen-recording"
+	KindVideo           = "video"
+)
+
+var routeKinds = []string{KindScreenshot, KindMessaging, KindDownload, KindPhoto, KindAnimated, KindScreenRecording, KindVideo}
+
+// screenshotNamePattern matches the names Android, iOS simulators, macOS and Windows give screenshots.
+var screenshotNamePattern = regexp.MustCompile(`(?i)^(screenshot|screen shot|simulator screen shot)[ _-]`)
+
+// messagingNamePattern matches the names WhatsApp, Telegram and Signal give the media they save, such
+// as IMG-20200101-WA0001.jpg, WhatsApp Image 2021-01-01 at 12.00.00.jpeg or photo_2021-01-01_12-34-56.jpg.
+var messagingNamePattern = regexp.MustCompile(`(?i)(-WA\d{4}|^WhatsApp (Image|Video) |^(photo|video)_\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}|^signal-\d{4}-\d{2}-\d{2})`)
+
+// screenRecordingNamePattern matches the names iOS, macOS, Android and GNOME give screen recordings, such
+// as RPReplay_Final1612345678.MP4, Screen Recording 2024-01-01 at 10.00.00.mov or screen-20240101-101010.mp4.
+var screenRecordingNamePattern = regexp.MustCompile(`(?i)^(rpreplay_|screen[ _]recording|screenrecord|screencast|screen-\d{8})`)
+
+// cameraVideoSizes are the frame sizes cameras record video in, the larger side first. Screens, of
+// phones in particular, are mostly recorded at other sizes.
+var cameraVideoSizes = [][2]int{
+	{640, 480}, {720, 480}, {720, 576}, {1280, 720}, {1440, 1080}, {1920, 1080}, {1920, 1440},
+	{2560, 1440}, {2704, 1520}, {2704, 2028}, {2720, 1530}, {3840, 2160}, {4000, 3000}, {4096, 2160}, {5312, 2988}, {7680, 4320},
+}
+
+// downloadFolderNames are the folders browsers save downloaded files into.
+var downloadFolderNames = []string{"download", "downloads"}
+
+// RouteRule sends the files of a kind to the folders layout expands to for them.
+type RouteRule struct {
+	kind   string
+	layout string
+}
+
+// ParseRoutes splits a comma separated list of kind=layout rules, checking every kind is known and
+// every layout is valid.
+func ParseRoutes(list string) ([]RouteRule, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var routes []RouteRule
+	for _, rule := range strings.Split(list, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		kind, layout, found := strings.Cut(rule, "=")
+		kind, layout = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(layout)
+		if !found || layout == "" {
+			return nil, fmt.Errorf("invalid route %q, expected kind=layout", rule)
+		}
+		if !arrayContains(routeKinds, kind) {
+			return nil, fmt.Errorf("invalid route kind %q (%s)", kind, strings.Join(routeKinds, ", "))
+		}
+		if err := ValidateLayout(layout); err != nil {
+			return nil, err
+		}
+
+		routes = append(routes, RouteRule{kind: kind, layout: layout})
+	}
+
+	return routes, nil
+}
+
+// routeLayout returns the layout of the first of routes whose kind the file is of.
+func routeLayout(routes []RouteRule, fileInfo FileInfo) (string, bool) {
+	if len(routes) == 0 || fileInfo.FileType == FileTypeUnknown {
+		return "", false
+	}
+
+	for _, route := range routes {
+		if isKind(fileInfo.Path, route.kind) {
+			return route.layout, true
+		}
+	}
+
+	return "", false
+}
+
+// isKind checks if the file at path is of kind, judged by its name, the folder it is in and, for PNG
+// files without EXIF metadata, which cameras do not write, as screenshots. Photos and videos are told
+// apart from animated images and screen recordings by their content.
+func isKind(path, kind string) bool {
+	name := filepath.Base(path)
+
+	switch kind {
+	case KindScreenshot:
+		if screenshotNamePattern.MatchString(name) {
+			return true
+		}
+		if strings.ToLower(filepath.Ext(name)) != ".png" {
+			return false
+		}
+		_, _, err := metadata.ExtractCamera(path)
+		return err != nil
+	case KindMessaging:
+		return messagingNamePattern.MatchString(name)
+	case KindDownload:
+		return arrayContains(downloadFolderNames, strings.ToLower(filepath.Base(filepath.Dir(path))))
+	case KindPhoto:
+		return IsPhoto(filepath.Ext(name)) && !isAnimatedImage(path)
+	case KindAnimated:
+		return IsPhoto(filepath.Ext(name)) && isAnimatedImage(path)
+	case KindScreenRecording:
+		return IsVideo(filepath.Ext(name)) && isScreenRecording(path)
+	case KindVideo:
+		return IsVideo(filepath.Ext(name)) && !isScreenRecording(path)
+	}
+
+	return false
+}
+
+// isAnimatedImage checks if the image at path is an animated GIF, PNG or WebP, unreadable images
+// counting as still ones.
+func isAnimatedImage(path string) bool {
+	animated, _ := mediatype.IsAnimated(path)
+	return animated
+}
+
+// isScreenRecording checks if the video at path is a screen recording, judged by its name or, for
+// QuickTime and MP4 videos without the make and model phones write, a frame size cameras do not record in.
+func isScreenRecording(path string) bool {
+	if screenRecordingNamePattern.MatchString(filepath.Base(path)) {
+		return true
+	}
+
+	if cameraMake, cameraModel, err := metadata.ExtractCamera(path); err == nil && (cameraMake != "" || cameraModel != "") {
+		return false
+	}
+
+	width, height, err := metadata.ExtractVideoDimensions(path)
+	if err != nil {
+		return false
+	}
+	if width < height {
+		width, height = height, width
+	}
+
+	for _, size := range cameraVideoSizes {
+		if width == size[0] && height == size[1] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarExtensions are the files that describe a media file of the same name rather than being media
+// themselves: Lightroom and darktable XMP metadata, Apple AAE edits, and video thumbnails and subtitles.
+var sidecarExtensions = []string{".xmp", ".aae", ".thm", ".srt"}
+
+// isSidecar checks if the extension belongs to a sidecar file.
+func isSidecar(fileExt string) bool {
+	return arrayContains(sidecarExtensions, strings.ToLower(fileExt))
+}
+
+// sidecarParent returns the media file the sidecar at path belongs to, named either like the media file
+// with its extension replaced, IMG_1234.xmp, or with the sidecar extension appended, IMG_1234.CR2.xmp.
+// When several media files share the name, RAW files take the sidecar, as Lightroom writes it for them.
+func sidecarParent(path string) (string, bool) {
+	if !isSidecar(filepath.Ext(path)) {
+		return "", false
+	}
+
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	if isMediaExtension(filepath.Ext(stem)) {
+		if info, err := os.Stat(stem); err == nil && info.Mode().IsRegular() {
+			return stem, true
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return "", false
+	}
+
+	var parent string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.TrimSuffix(name, filepath.Ext(name)) != filepath.Base(stem) || !isMediaExtension(filepath.Ext(name)) {
+			continue
+		}
+
+		if parent == "" || isRaw(filepath.Ext(name)) && !isRaw(filepath.Ext(parent)) {
+			parent = filepath.Join(filepath.Dir(path), name)
+		}
+	}
+
+	return parent, parent != ""
+}
+
+// isMediaExtension checks if the extension belongs to a photo or video format.
+func isMediaExtension(fileExt string) bool {
+	return fileExt != "" && (IsPhoto(fileExt) || IsVideo(fileExt))
+}
+
+// FindSidecars returns the sidecar files that belong to the media file at path.
+func FindSidecars(path string) []string {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+
+	var sidecars []string
+	var found []os.FileInfo
+	for _, base := range []string{stem, path} {
+		for _, extension := range sidecarExtensions {
+			for _, candidate := range []string{base + extension, base + strings.ToUpper(extension)} {
+				info, err := os.Stat(candidate)
+				if err != nil || !info.Mode().IsRegular() || isSameFileAsAny(info, found) {
+					continue
+				}
+
+				if parent, ok := sidecarParent(candidate); ok && parent == path {
+					sidecars = append(sidecars, candidate)
+					found = append(found, info)
+				}
+			}
+		}
+	}
+
+	return sidecars
+}
+
+// isSameFileAsAny checks if info describes one of the files, which case insensitive file systems
+// return for both spellings of an extension.
+func isSameFileAsAny(info os.FileInfo, files []os.FileInfo) bool {
+	for _, file := range files {
+		if os.SameFile(info, file) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,261 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/metadata"
+	"github.com/keybraker/mediarizer-2/organizer"
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+const defaultDateLayout = "20060102_150405"
+
+const unknownCameraName = "unknown-camera"
+
+// CameraAliases maps raw camera makes and models, lower cased, to the names their folders and file
+// names use instead. It is loaded with LoadCameraAliases before the run.
+var CameraAliases map[string]string
+
+// Folder names of files whose country or city is not known.
+const (
+	unknownCountryName = "unknown-country"
+	unknownCityName    = "unknown-city"
+)
+
+// expandTemplate replaces every {token} or {token:argument} placeholder of template with the value resolve returns for it.
+func expandTemplate(template string, resolve func(token, argument string) (string, error)) (string, error) {
+	var expanded strings.Builder
+
+	for {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			expanded.WriteString(template)
+			break
+		}
+
+		end := strings.Index(template[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated placeholder in template %q", template)
+		}
+		end += start
+
+		expanded.WriteString(template[:start])
+
+		token, argument, _ := strings.Cut(template[start+1:end], ":")
+		value, err := resolve(token, argument)
+		if err != nil {
+			return "", err
+		}
+		expanded.WriteString(value)
+
+		template = template[end+1:]
+	}
+
+	return expanded.String(), nil
+}
+
+// ApplyNameTemplate renames the file part of generatedPath using nameTemplate.
+// Files without an EXIF creation date keep their original name.
+func ApplyNameTemplate(generatedPath string, fileInfo FileInfo, nameTemplate string) (string, error) {
+	if nameTemplate == "" || !fileInfo.HasCreationDate {
+		return generatedPath, nil
+	}
+
+	originalName := filepath.Base(fileInfo.Path)
+	ext := filepath.Ext(originalName)
+
+	var cameraMake, cameraModel string
+	cameraLoaded := false
+	loadCamera := func() {
+		if !cameraLoaded {
+			cameraMake, cameraModel, _ = metadata.ExtractCamera(fileInfo.Path)
+			cameraLoaded = true
+		}
+	}
+
+	fileName, err := expandTemplate(nameTemplate, func(token, argument string) (string, error) {
+		switch token {
+		case "date":
+			if argument == "" {
+				argument = defaultDateLayout
+			}
+			return fileInfo.Created.Format(argument), nil
+		case "camera", "model":
+			loadCamera()
+			return cameraName(cameraModel), nil
+		case "make":
+			loadCamera()
+			return sanitizePathComponent(cameraAlias(cameraMake)), nil
+		case "name":
+			return strings.TrimSuffix(originalName, ext), nil
+		case "ext":
+			return ext, nil
+		default:
+			return "", fmt.Errorf("unknown placeholder {%s} in name template", token)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fileName = sanitizePathComponent(fileName)
+	if fileName == "" {
+		return generatedPath, nil
+	}
+
+	return filepath.Join(filepath.Dir(generatedPath), fileName), nil
+}
+
+// GetLayoutDestinationPath places the file in the folders layout expands to for it, such as
+// "{year}/{month}/{day}", "{make}/{model}", "{country}/{city}" or "{type}/{year}-{month}". Months
+// are written in the format style, and camera makes and models by their alias. Countries are reverse geocoded from the GPS coordinates and cities
+// read from the IPTC location of the file. Files of unknown type go to the unknown folder as usual.
+func GetLayoutDestinationPath(destinationPath string, fileInfo FileInfo, layout string, format string) (string, error) {
+	fileName := filepath.Base(fileInfo.Path)
+	if fileInfo.FileType == FileTypeUnknown {
+		return fmt.Sprintf("%s/unknown/%s", destinationPath, fileName), nil
+	}
+
+	var cameraMake, cameraModel string
+	cameraLoaded := false
+
+	folders, err := expandTemplate(layout, func(token, argument string) (string, error) {
+		if (token == "camera" || token == "camera-model" || token == "model" || token == "make") && !cameraLoaded {
+			cameraMake, cameraModel, _ = metadata.ExtractCamera(fileInfo.Path)
+			cameraLoaded = true
+		}
+
+		switch token {
+		case "year":
+			return fmt.Sprintf("%04d", fileInfo.Created.Year()), nil
+		case "month":
+			return sanitizePathComponent(organizer.MonthName(fileInfo.Created.Month(), format)), nil
+		case "day":
+			return fmt.Sprintf("%02d", fileInfo.Created.Day()), nil
+		case "date":
+			if argument == "" {
+				argument = "2006-01-02"
+			}
+			return sanitizePathComponent(fileInfo.Created.Format(argument)), nil
+		case "type":
+			if fileInfo.FileType == FileTypeVideo {
+				return "videos", nil
+			}
+			return "images", nil
+		case "camera", "camera-model", "model":
+			return cameraName(cameraModel), nil
+		case "make":
+			if name := sanitizePathComponent(cameraAlias(cameraMake)); name != "" {
+				return name, nil
+			}
+			return "unknown-make", nil
+		case "country":
+			country := fileInfo.Country
+			if country == "" {
+				var err error
+				if country, err = GetCountry(fileInfo.Path); err != nil {
+					return "", err
+				}
+			}
+			if name := sanitizePathComponent(country); name != "" {
+				return name, nil
+			}
+			return unknownCountryName, nil
+		case "city":
+			city, _ := metadata.ExtractCity(fileInfo.Path)
+			if name := sanitizePathComponent(city); name != "" {
+				return name, nil
+			}
+			return unknownCityName, nil
+		default:
+			return "", fmt.Errorf("unknown placeholder {%s} in layout", token)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(destinationPath, filepath.FromSlash(folders), fileName), nil
+}
+
+// ValidateLayout checks that layout only uses known placeholders and stays inside the destination.
+func ValidateLayout(layout string) error {
+	generatedPath, err := GetLayoutDestinationPath("destination", FileInfo{Path: "file", FileType: FileTypeImage}, layout, "word")
+	if err != nil {
+		return err
+	}
+
+	if !pathsafe.Within("destination", generatedPath) || filepath.IsAbs(filepath.FromSlash(layout)) {
+		return fmt.Errorf("layout %q leaves the output directory", layout)
+	}
+
+	return nil
+}
+
+// cameraFolderName returns the camera model of the file as a path component, or "unknown-camera" when it has none.
+func cameraFolderName(path string) string {
+	_, cameraModel, _ := metadata.ExtractCamera(path)
+	return cameraName(cameraModel)
+}
+
+// cameraName sanitizes the alias of cameraModel, falling back to "unknown-camera" when nothing is left.
+func cameraName(cameraModel string) string {
+	if name := sanitizePathComponent(cameraAlias(cameraModel)); name != "" {
+		return name
+	}
+
+	return unknownCameraName
+}
+
+// cameraAlias returns the alias of a camera make or model, or the make or model when it has none.
+func cameraAlias(value string) string {
+	if alias, found := CameraAliases[strings.ToLower(strings.TrimSpace(value))]; found {
+		return alias
+	}
+
+	return value
+}
+
+// LoadCameraAliases reads a file of "raw make or model = alias" lines, such as "iPhone 13 mini = Anna's
+// phone". Empty lines and lines starting with # are skipped.
+func LoadCameraAliases(filePath string) (map[string]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open camera alias file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	aliases := make(map[string]string)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		camera, alias, found := strings.Cut(line, "=")
+		camera, alias = strings.TrimSpace(camera), strings.TrimSpace(alias)
+		if !found || camera == "" || sanitizePathComponent(alias) == "" {
+			return nil, fmt.Errorf("invalid camera alias %q in camera alias file %s", line, filePath)
+		}
+
+		aliases[strings.ToLower(camera)] = alias
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read camera alias file %s: %v", filePath, err)
+	}
+
+	return aliases, nil
+}
+
+// sanitizePathComponent makes value safe to use as a single path component, which it never hides
+// behind a leading dot.
+func sanitizePathComponent(value string) string {
+	return pathsafe.Name(strings.TrimLeft(strings.TrimSpace(value), "."))
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+// IOLimits tunes how hard a run works the storage it reads from and writes to.
+type IOLimits struct {
+	// Workers is the number of files hashed, read and moved at once, half the CPUs by default.
+	Workers int
+	// MaxOpenFiles, when positive, caps the files all stages hold open at once.
+	MaxOpenFiles int
+	// BytesPerSecond, when positive, caps the combined rate the destination is hashed and files are copied at.
+	BytesPerSecond int64
+	// Retries is the number of times reading, hashing or transferring a file is retried after a
+	// transient error, waiting RetryBackoff before the first retry and twice as long before every next.
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+// retryPolicy returns the retries of limits for the hash stage.
+func (limits IOLimits) retryPolicy() hash.RetryPolicy {
+	return hash.RetryPolicy{Attempts: limits.Retries, Backoff: limits.RetryBackoff}
+}
+
+// workerCount returns the number of workers of the organise stage.
+func (limits IOLimits) workerCount() int {
+	if limits.Workers > 0 {
+		return limits.Workers
+	}
+
+	return max(runtime.NumCPU()/2, 1)
+}
+
+// capWorkers returns workers, lowered to MaxOpenFiles for stages whose workers hold a file open each.
+func (limits IOLimits) capWorkers(workers int) int {
+	if limits.MaxOpenFiles > 0 && workers > limits.MaxOpenFiles {
+		return limits.MaxOpenFiles
+	}
+
+	return workers
+}
+
+// throttle enforces IOLimits across the workers of the creator and consumer, which run at once.
+// A nil throttle does not limit anything.
+type throttle struct {
+	ctx     context.Context
+	workers int
+	limiter *hash.RateLimiter
+	retry   hash.RetryPolicy
+
+	mu        sync.Mutex
+	available *sync.Cond
+	capacity  int
+	free      int
+}
+
+// newThrottle creates a throttle for limits, sharing limiter with the hash stage. Cancelling ctx
+// stops the waits between retries.
+func newThrottle(ctx context.Context, limits IOLimits, limiter *hash.RateLimiter) *throttle {
+	t := &throttle{
+		ctx:      ctx,
+		workers:  limits.workerCount(),
+		limiter:  limiter,
+		retry:    limits.retryPolicy(),
+		capacity: limits.MaxOpenFiles,
+		free:     limits.MaxOpenFiles,
+	}
+	t.available = sync.NewCond(&t.mu)
+
+	return t
+}
+
+// workerCount returns the number of workers each of the creator and consumer runs.
+func (t *throttle) workerCount() int {
+	if t == nil {
+		return IOLimits{}.workerCount()
+	}
+
+	return t.workers
+}
+
+// acquire blocks until n files may be opened. The n slots are taken at once, so workers that
+// each need several never hold some while waiting for the rest.
+func (t *throttle) acquire(n int) int {
+	if t == nil || t.capacity <= 0 {
+		return 0
+	}
+	n = min(n, t.capacity)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for t.free < n {
+		t.available.Wait()
+	}
+	t.free -= n
+
+	return n
+}
+
+// release returns n slots taken by acquire.
+func (t *throttle) release(n int) {
+	if t == nil || n == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.free += n
+	t.mu.Unlock()
+
+	t.available.Broadcast()
+}
+
+// reader returns reader paced to the rate limit, if there is one.
+func (t *throttle) reader(reader io.Reader) io.Reader {
+	if t == nil || t.limiter == nil {
+		return reader
+	}
+
+	return t.limiter.Reader(reader)
+}
+
+// retrying calls fn until it succeeds or fails with an error that is not transient, at most as often
+// as the retries of the limits allow.
+func (t *throttle) retrying(fn func() error) error {
+	if t == nil {
+		return fn()
+	}
+
+	return t.retry.Do(t.ctx, fn)
+}
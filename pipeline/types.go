@@ -0,0 +1,60 @@
+package pipeline
+
+import "time"
+
+type FileType int
+
+const (
+	Unknown FileType = iota
+	Image
+	Video
+)
+
+type FileInfo struct {
+	Path            string
+	FileType        FileType
+	Created         time.Time
+	Country         string
+	HasCreationDate bool
+	// DateSource names where Created was read from, empty when the file is not organised by date.
+	DateSource  string
+	Hash        string
+	Companions  []string
+	isDuplicate bool
+	// original is the file the duplicate matches.
+	original string
+	// Discarded are files of the group left out of the destination, removed once the file is organised.
+	Discarded []string
+	// corruption is why the file failed to decode, which quarantines it instead of organising it.
+	corruption string
+}
+
+const (
+	FileTypeUnknown FileType = iota
+	FileTypeFolder
+	FileTypeImage
+	FileTypeVideo
+	FileTypeExcluded
+)
+
+type PhotoType int
+
+const (
+	JPG PhotoType = iota
+	JPEG
+	PNG
+	GIF
+	RAW
+	HEIC
+	WEBP
+	AVIF
+)
+
+type VideoType int
+
+const (
+	MP4 VideoType = iota
+	AVI
+	MOV
+	MKV
+)
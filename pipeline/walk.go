@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keybraker/mediarizer-2/pathsafe"
+)
+
+// fileID identifies a file by its device and inode, which all hard links of the file share.
+type fileID struct {
+	device uint64
+	inode  uint64
+}
+
+// walkInput calls fn for every regular file under rootPath in lexical order, leaving out the directories
+// under excludePath and the files and directories filter leaves out, or with the error of a path that
+// can not be read. Symlinks are skipped unless followSymlinks, which enters every directory once so
+// link loops end, and passes symlinked files by the path of their target. Files are passed once, hard
+// links of a file already passed are skipped. The walk stops at the first error fn returns.
+func walkInput(rootPath string, excludePath string, filter WalkFilter, followSymlinks bool, fn func(path string, d fs.DirEntry, err error) error) error {
+	visitedDirs := make(map[fileID]bool)
+	seenFiles := make(map[fileID]bool)
+
+	var walkDir func(dirPath string) error
+	walkDir = func(dirPath string) error {
+		if followSymlinks {
+			if info, err := os.Stat(dirPath); err == nil {
+				if id, ok := fileIdentity(dirPath, info); ok {
+					if visitedDirs[id] {
+						return nil
+					}
+					visitedDirs[id] = true
+				}
+			}
+		}
+
+		// The entries read before a failure are still walked.
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			if err := fn(dirPath, nil, err); err != nil {
+				return err
+			}
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dirPath, entry.Name())
+			filePath := path
+
+			if entry.Type()&fs.ModeSymlink != 0 {
+				if !followSymlinks {
+					continue
+				}
+
+				info, err := os.Stat(path)
+				if err != nil {
+					if err := fn(path, entry, err); err != nil {
+						return err
+					}
+					continue
+				}
+				entry = fs.FileInfoToDirEntry(info)
+
+				if !info.IsDir() {
+					if filePath, err = filepath.EvalSymlinks(path); err != nil {
+						if err := fn(path, entry, err); err != nil {
+							return err
+						}
+						continue
+					}
+				}
+			}
+
+			if entry.IsDir() {
+				if pathsafe.Within(excludePath, path) || filter.skipsDir(rootPath, path) {
+					continue
+				}
+				if err := walkDir(path); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if !entry.Type().IsRegular() || !filter.keeps(rootPath, path, entry) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				if err := fn(path, entry, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if id, ok := fileIdentity(filePath, info); ok {
+				if seenFiles[id] {
+					continue
+				}
+				seenFiles[id] = true
+			}
+
+			if err := fn(filePath, entry, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return walkDir(rootPath)
+}
+
+func arrayContains(stringArray []string, stringCandidate string) bool {
+	for _, string := range stringArray {
+		if string == stringCandidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CountFiles counts the files under rootPath that will be organised, leaving out those under excludePath
+// and those filter leaves out, following symlinks with followSymlinks. The files are not held in memory.
+func CountFiles(rootPath string, excludePath string, filter WalkFilter, followSymlinks bool, fileTypes []string, organisePhotos bool, organiseVideos bool) int {
+	count := 0
+	walkMedia(rootPath, excludePath, filter, followSymlinks, fileTypes, organisePhotos, organiseVideos, func(string) {
+		count++
+	})
+
+	return count
+}
+
+// ListFiles returns the files under rootPath that will be organised, leaving out those under excludePath
+// and those filter leaves out, following symlinks with followSymlinks.
+func ListFiles(rootPath string, excludePath string, filter WalkFilter, followSymlinks bool, fileTypes []string, organisePhotos bool, organiseVideos bool) []string {
+	var paths []string
+	walkMedia(rootPath, excludePath, filter, followSymlinks, fileTypes, organisePhotos, organiseVideos, func(path string) {
+		paths = append(paths, path)
+	})
+
+	return paths
+}
+
+// walkMedia calls fn with every file under rootPath that will be organised, as it is walked.
+func walkMedia(rootPath string, excludePath string, filter WalkFilter, followSymlinks bool, fileTypes []string, organisePhotos bool, organiseVideos bool, fn func(path string)) {
+	walkInput(rootPath, excludePath, filter, followSymlinks, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if (organisePhotos && IsPhoto(ext) || organiseVideos && IsVideo(ext)) && (len(fileTypes) == 0 || arrayContains(fileTypes, ext)) {
+			fn(path)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Bar renders the counters of a Tracker to a writer, with the throughput of the run and the time
+// it is estimated to take. On a terminal it redraws a single line, otherwise it writes a plain
+// status line every interval.
+type Bar struct {
+	w        io.Writer
+	label    string
+	tracker  *Tracker
+	interval time.Duration
+	isTTY    bool
+
+	start time.Time
+	stop  chan struct{}
+	done  sync.WaitGroup
+}
+
+// NewBar creates a bar for tracker, labelled with label, writing to w.
+func NewBar(w io.Writer, label string, tracker *Tracker) *Bar {
+	bar := &Bar{
+		w:        w,
+		label:    label,
+		tracker:  tracker,
+		interval: 5 * time.Second,
+		isTTY:    isTerminal(w),
+	}
+
+	if bar.isTTY {
+		bar.interval = 100 * time.Millisecond
+	}
+
+	return bar
+}
+
+// Start begins rendering in the background until Stop is called.
+func (bar *Bar) Start() {
+	bar.start = time.Now()
+	bar.stop = make(chan struct{})
+	bar.done.Add(1)
+
+	go func() {
+		defer bar.done.Done()
+
+		ticker := time.NewTicker(bar.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-bar.stop:
+				return
+			case <-ticker.C:
+				bar.render()
+			}
+		}
+	}()
+}
+
+// Stop stops the background rendering and clears the bar from the terminal, so the lines
+// logged after the run are not mixed with it.
+func (bar *Bar) Stop() {
+	close(bar.stop)
+	bar.done.Wait()
+
+	if bar.isTTY {
+		fmt.Fprint(bar.w, "\r\033[K")
+	} else {
+		bar.render()
+	}
+}
+
+// render writes the current state once.
+func (bar *Bar) render() {
+	counters := bar.tracker.Snapshot()
+	elapsed := time.Since(bar.start)
+
+	done, total := counters.FilesProcessed, counters.FilesDiscovered
+
+	fraction := 0.0
+	if total > 0 {
+		fraction = float64(done) / float64(total)
+	}
+
+	var filesPerSecond, bytesPerSecond float64
+	if elapsed > 0 {
+		filesPerSecond = float64(done) / elapsed.Seconds()
+		bytesPerSecond = float64(counters.BytesHashed) / elapsed.Seconds()
+	}
+
+	status := fmt.Sprintf("%s %d/%d (%.2f%%), %d moved, %d duplicates, %.1f files/s, %.2fMb/s, ETA %s",
+		bar.label, done, total, fraction*100, counters.FilesMoved, counters.DuplicatesFound,
+		filesPerSecond, bytesPerSecond/1024.0/1024.0, formatETA(elapsed, done, total))
+
+	if !bar.isTTY {
+		fmt.Fprintln(bar.w, status)
+		return
+	}
+
+	fmt.Fprintf(bar.w, "\r[%s] %s\033[K", drawBar(fraction), status)
+}
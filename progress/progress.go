@@ -0,0 +1,147 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybraker/mediarizer-2/hash"
+)
+
+const barWidth = 30
+
+// Printer renders the live stats of a scan to a writer. On a terminal it redraws a single
+// progress bar line, otherwise it writes a plain status line every interval.
+type Printer struct {
+	w        io.Writer
+	label    string
+	stats    *hash.Stats
+	interval time.Duration
+	isTTY    bool
+
+	start time.Time
+	stop  chan struct{}
+	done  sync.WaitGroup
+}
+
+// NewPrinter creates a printer for stats, labelled with label, writing to w.
+func NewPrinter(w io.Writer, label string, stats *hash.Stats) *Printer {
+	printer := &Printer{
+		w:        w,
+		label:    label,
+		stats:    stats,
+		interval: 5 * time.Second,
+		isTTY:    isTerminal(w),
+	}
+
+	if printer.isTTY {
+		printer.interval = 100 * time.Millisecond
+	}
+
+	return printer
+}
+
+// Start begins rendering in the background until Stop is called.
+func (printer *Printer) Start() {
+	printer.start = time.Now()
+	printer.stop = make(chan struct{})
+	printer.done.Add(1)
+
+	go func() {
+		defer printer.done.Done()
+
+		ticker := time.NewTicker(printer.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-printer.stop:
+				return
+			case <-ticker.C:
+				printer.render()
+			}
+		}
+	}()
+}
+
+// Stop renders the final state and stops the background rendering.
+func (printer *Printer) Stop() {
+	close(printer.stop)
+	printer.done.Wait()
+	printer.render()
+
+	if printer.isTTY {
+		fmt.Fprintln(printer.w)
+	}
+}
+
+// render writes the current state once.
+func (printer *Printer) render() {
+	snapshot := printer.stats.Snapshot()
+	elapsed := time.Since(printer.start)
+
+	done, total := snapshot.FilesHashed, snapshot.FilesTotal
+	if snapshot.BytesTotal > 0 {
+		done, total = snapshot.BytesHashed, snapshot.BytesTotal
+	}
+
+	fraction := 0.0
+	if total > 0 {
+		fraction = float64(done) / float64(total)
+	}
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(snapshot.BytesHashed) / elapsed.Seconds()
+	}
+
+	status := fmt.Sprintf("%s %d/%d files (%.2f%%), %.2fMb/s, ETA %s",
+		printer.label, snapshot.FilesHashed, snapshot.FilesTotal, fraction*100, rate/1024.0/1024.0, formatETA(elapsed, done, total))
+
+	if !printer.isTTY {
+		fmt.Fprintln(printer.w, status)
+		return
+	}
+
+	fmt.Fprintf(printer.w, "\r[%s] %s\033[K", drawBar(fraction), status)
+}
+
+// formatETA estimates the time left from the rate done of total was reached in elapsed.
+func formatETA(elapsed time.Duration, done, total int64) string {
+	if done <= 0 || total <= done {
+		return "-"
+	}
+
+	remaining := time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+	return remaining.Round(time.Second).String()
+}
+
+// drawBar returns a progress bar filled to fraction.
+func drawBar(fraction float64) string {
+	filled := int(fraction * barWidth)
+	if filled > barWidth {
+		filled = barWidth
+	} else if filled < 0 {
+		filled = 0
+	}
+
+	return strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled)
+}
+
+// isTerminal checks if w is a character device such as an interactive terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,127 @@
+package progress
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the kind of progress an Event reports.
+type EventType int
+
+const (
+	// FilesDiscovered reports files found for a stage to handle. Stages that go over the same
+	// files discover them again, so the count is of files per stage rather than distinct files.
+	FilesDiscovered EventType = iota
+	// FilesProcessed reports files a stage has finished with, whatever it did with them.
+	FilesProcessed
+	// BytesHashed reports the size of files hashed or looked up in the hash cache.
+	BytesHashed
+	// FilesMoved reports files moved into the destination.
+	FilesMoved
+	// DuplicatesFound reports files found to be copies of another file.
+	DuplicatesFound
+)
+
+var eventTypeNames = map[EventType]string{
+	FilesDiscovered: "files-discovered",
+	FilesProcessed:  "files-processed",
+	BytesHashed:     "bytes-hashed",
+	FilesMoved:      "files-moved",
+	DuplicatesFound: "duplicates-found",
+}
+
+func (eventType EventType) String() string {
+	if name, found := eventTypeNames[eventType]; found {
+		return name
+	}
+
+	return fmt.Sprintf("EventType(%d)", int(eventType))
+}
+
+// Event is a single progress update. Path names the file it is about, when there is one.
+type Event struct {
+	Type  EventType
+	Count int64
+	Path  string
+}
+
+// Counters are the totals of the events a Tracker received.
+type Counters struct {
+	FilesDiscovered int64
+	FilesProcessed  int64
+	BytesHashed     int64
+	FilesMoved      int64
+	DuplicatesFound int64
+}
+
+// Tracker adds up the progress events of a run and passes them on to its listeners.
+// It is safe for concurrent use.
+type Tracker struct {
+	counters Counters
+
+	mu        sync.RWMutex
+	listeners []func(Event)
+}
+
+// NewTracker creates a Tracker with no events and no listeners.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Subscribe calls listener for every event emitted from now on. Listeners are called from the
+// goroutine emitting the event, so they must be quick and safe for concurrent use.
+func (tracker *Tracker) Subscribe(listener func(Event)) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.listeners = append(tracker.listeners, listener)
+}
+
+// Emit adds event to the counters and passes it to the listeners.
+func (tracker *Tracker) Emit(event Event) {
+	if counter := tracker.counter(event.Type); counter != nil {
+		atomic.AddInt64(counter, event.Count)
+	}
+
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+
+	for _, listener := range tracker.listeners {
+		listener(event)
+	}
+}
+
+// Add emits an event of eventType for count files or bytes of path.
+func (tracker *Tracker) Add(eventType EventType, count int64, path string) {
+	tracker.Emit(Event{Type: eventType, Count: count, Path: path})
+}
+
+// Snapshot returns a consistent enough copy of the counters for display.
+func (tracker *Tracker) Snapshot() Counters {
+	return Counters{
+		FilesDiscovered: atomic.LoadInt64(&tracker.counters.FilesDiscovered),
+		FilesProcessed:  atomic.LoadInt64(&tracker.counters.FilesProcessed),
+		BytesHashed:     atomic.LoadInt64(&tracker.counters.BytesHashed),
+		FilesMoved:      atomic.LoadInt64(&tracker.counters.FilesMoved),
+		DuplicatesFound: atomic.LoadInt64(&tracker.counters.DuplicatesFound),
+	}
+}
+
+// counter returns the counter events of eventType add up in.
+func (tracker *Tracker) counter(eventType EventType) *int64 {
+	switch eventType {
+	case FilesDiscovered:
+		return &tracker.counters.FilesDiscovered
+	case FilesProcessed:
+		return &tracker.counters.FilesProcessed
+	case BytesHashed:
+		return &tracker.counters.BytesHashed
+	case FilesMoved:
+		return &tracker.counters.FilesMoved
+	case DuplicatesFound:
+		return &tracker.counters.DuplicatesFound
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,156 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/keybraker/mediarizer-2/atomicfile"
+)
+
+// Actions recorded for the files of a run.
+const (
+	ActionMoved             = "moved"
+	ActionCopied            = "copied"
+	ActionDuplicateMoved    = "duplicate-moved"
+	ActionDuplicateCopied   = "duplicate-copied"
+	ActionDuplicateSkipped  = "duplicate-skipped"
+	ActionDuplicateDeleted  = "duplicate-deleted"
+	ActionDuplicateLinked   = "duplicate-linked"
+	ActionDuplicateRemoved  = "duplicate-removed"
+	ActionDuplicateReviewed = "duplicate-reviewed"
+	ActionCollisionSkipped  = "collision-skipped"
+	ActionAlreadyPresent    = "already-present"
+	ActionDiscarded         = "discarded"
+	ActionQuarantined       = "quarantined"
+	ActionFailed            = "failed"
+	// ActionInterrupted marks the report of a run that was interrupted, which lacks the files it did not get to.
+	ActionInterrupted = "interrupted"
+)
+
+// Kinds of the errors files failed with.
+const (
+	// ErrorTransient is an error that may not happen again, such as a network share timing out,
+	// so running again may well get past it.
+	ErrorTransient = "transient"
+	// ErrorPermanent is an error that happens every time, such as a missing file or a denied permission.
+	ErrorPermanent = "permanent"
+)
+
+// Entry is the result of a single file of a run.
+type Entry struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	// DateSource names where the capture date the file was organised by came from.
+	DateSource string `json:"dateSource,omitempty"`
+	Action     string `json:"action"`
+	Error      string `json:"error,omitempty"`
+	// ErrorKind tells failed files whose error is transient from those whose error is permanent.
+	ErrorKind string `json:"errorKind,omitempty"`
+}
+
+// csvHeader names the columns WriteCSV writes, in the order of the fields of Entry.
+var csvHeader = []string{"source", "destination", "hash", "date_source", "action", "error", "error_kind"}
+
+// Report collects the per-file results of a run. It is safe for concurrent use,
+// and a nil Report discards everything added to it.
+type Report struct {
+	mu        sync.Mutex
+	entries   []Entry
+	listeners []func(Entry)
+}
+
+// New creates an empty Report.
+func New() *Report {
+	return &Report{}
+}
+
+// Subscribe calls listener for every entry added from now on. Listeners are called from the
+// goroutine adding the entry, so they must be quick and safe for concurrent use.
+func (report *Report) Subscribe(listener func(Entry)) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.listeners = append(report.listeners, listener)
+}
+
+// Add records entry and passes it to the listeners.
+func (report *Report) Add(entry Entry) {
+	if report == nil {
+		return
+	}
+
+	report.mu.Lock()
+	report.entries = append(report.entries, entry)
+	listeners := report.listeners
+	report.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(entry)
+	}
+}
+
+// Entries returns the recorded entries ordered by source path, so reports of runs over the same
+// files can be diffed.
+func (report *Report) Entries() []Entry {
+	if report == nil {
+		return nil
+	}
+
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	entries := append([]Entry{}, report.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Source < entries[j].Source })
+
+	return entries
+}
+
+// WriteJSON writes the entries as a JSON array to w.
+func (report *Report) WriteJSON(w io.Writer) error {
+	entries := report.Entries()
+	if entries == nil {
+		entries = []Entry{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+// WriteCSV writes the entries to w as CSV with a header row.
+func (report *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, entry := range report.Entries() {
+		if err := writer.Write([]string{entry.Source, entry.Destination, entry.Hash, entry.DateSource, entry.Action, entry.Error, entry.ErrorKind}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteFile writes the report to path, as CSV when its extension is .csv and as JSON otherwise.
+func (report *Report) WriteFile(path string) error {
+	write := report.WriteJSON
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		write = report.WriteCSV
+	}
+
+	if err := atomicfile.Write(path, write); err != nil {
+		return fmt.Errorf("failed to write report %s: %v", path, err)
+	}
+
+	return nil
+}
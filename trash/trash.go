@@ -0,0 +1,6 @@
+package trash
+
+import "errors"
+
+// ErrUnsupported is returned where no trash is known to move files to.
+var ErrUnsupported = errors.New("trash is not supported on this platform")
@@ -0,0 +1,60 @@
+//go:build darwin
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Move moves the file at path into the Trash of the user, ~/.Trash, or for files on other volumes
+// the .Trashes/<uid> directory of their volume, which the Finder shows as the same Trash.
+func Move(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %v", path, err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to find the trash: %v", err)
+	}
+
+	err = moveInto(filepath.Join(home, ".Trash"), absPath)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	// Files on other volumes can not be renamed into the home Trash, their own trash takes them.
+	topDir, err := mountPoint(absPath)
+	if err != nil {
+		return err
+	}
+
+	return moveInto(filepath.Join(topDir, ".Trashes", strconv.Itoa(os.Getuid())), absPath)
+}
+
+// moveInto renames the file at absPath into trashPath, numbering its name like the Finder when taken.
+func moveInto(trashPath, absPath string) error {
+	if err := os.MkdirAll(trashPath, 0700); err != nil {
+		return fmt.Errorf("failed to create trash directory %s: %v", trashPath, err)
+	}
+
+	name := uniqueName(filepath.Base(absPath), " ", func(name string) bool {
+		_, err := os.Lstat(filepath.Join(trashPath, name))
+		return err == nil
+	})
+
+	if err := os.Rename(absPath, filepath.Join(trashPath, name)); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		return fmt.Errorf("failed to move %s to the trash: %v", absPath, err)
+	}
+
+	return nil
+}
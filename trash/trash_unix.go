@@ -0,0 +1,64 @@
+//go:build !windows
+
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// device returns the device the file at path is on.
+func device(path string) (uint64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("failed to get device of %s", path)
+	}
+
+	return uint64(stat.Dev), nil
+}
+
+// mountPoint returns the top directory of the filesystem absPath is on, the last of its parents on
+// the same device.
+func mountPoint(absPath string) (string, error) {
+	dev, err := device(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(absPath)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+
+		parentDev, err := device(parent)
+		if err != nil || parentDev != dev {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
+
+// uniqueName returns the first of name, then name with separator and 2, 3 and so on before its
+// extension, taken returns false for.
+func uniqueName(name, separator string, taken func(name string) bool) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 2; taken(candidate); i++ {
+		candidate = stem + separator + strconv.Itoa(i) + ext
+	}
+
+	return candidate
+}
@@ -0,0 +1,64 @@
+//go:build windows && (amd64 || arm64)
+
+package trash
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// Operation and flags of SHFileOperationW moving files to the Recycle Bin without asking.
+const (
+	foDelete          = 0x0003
+	fofSilent         = 0x0004
+	fofNoConfirmation = 0x0010
+	fofAllowUndo      = 0x0040
+	fofNoErrorUI      = 0x0400
+)
+
+var procSHFileOperation = syscall.NewLazyDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// shFileOpStruct is the SHFILEOPSTRUCTW of 64-bit windows, which is not packed.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// Move moves the file at path to the Recycle Bin, from where Explorer can restore it.
+func Move(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %v", path, err)
+	}
+
+	// The list of files is ended by an empty path.
+	from, err := syscall.UTF16FromString(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to move %s to the recycle bin: %v", path, err)
+	}
+	from = append(from, 0)
+
+	operation := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+
+	result, _, _ := procSHFileOperation.Call(uintptr(unsafe.Pointer(&operation)))
+	if result != 0 {
+		return fmt.Errorf("failed to move %s to the recycle bin: error 0x%x", path, result)
+	}
+	if operation.fAnyOperationsAborted != 0 {
+		return fmt.Errorf("failed to move %s to the recycle bin: aborted", path)
+	}
+
+	return nil
+}
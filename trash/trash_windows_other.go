@@ -0,0 +1,8 @@
+//go:build windows && !(amd64 || arm64)
+
+package trash
+
+// Move is not supported on 32-bit windows, whose packed SHFILEOPSTRUCTW is not laid out like Go structs.
+func Move(path string) error {
+	return ErrUnsupported
+}
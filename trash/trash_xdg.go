@@ -0,0 +1,108 @@
+//go:build !windows && !darwin
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Move moves the file at path into the trash of the user following the freedesktop.org trash
+// specification, so file managers can restore it. Files on other filesystems than the home directory
+// go to the .Trash-<uid> directory at the top of their filesystem.
+func Move(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %v", path, err)
+	}
+
+	homeTrash, err := homeTrashPath()
+	if err != nil {
+		return err
+	}
+
+	err = moveInto(homeTrash, absPath, absPath)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	// Files on other filesystems can not be renamed into the home trash, their own trash takes them.
+	topDir, err := mountPoint(absPath)
+	if err != nil {
+		return err
+	}
+
+	relPath, err := filepath.Rel(topDir, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s relative to %s: %v", absPath, topDir, err)
+	}
+
+	return moveInto(filepath.Join(topDir, ".Trash-"+strconv.Itoa(os.Getuid())), absPath, relPath)
+}
+
+// homeTrashPath returns the trash directory of the user, $XDG_DATA_HOME/Trash.
+func homeTrashPath() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		return filepath.Join(dataHome, "Trash"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the trash: %v", err)
+	}
+
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// moveInto renames the file at absPath into the files directory of trashPath, after reserving its
+// name with an info file recording infoPath, where it is restored to, and when it was trashed.
+func moveInto(trashPath, absPath, infoPath string) error {
+	filesPath, infoDir := filepath.Join(trashPath, "files"), filepath.Join(trashPath, "info")
+	for _, dir := range []string{filesPath, infoDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create trash directory %s: %v", dir, err)
+		}
+	}
+
+	var infoFile *os.File
+	name := uniqueName(filepath.Base(absPath), ".", func(name string) bool {
+		if _, err := os.Lstat(filepath.Join(filesPath, name)); err == nil {
+			return true
+		}
+
+		file, err := os.OpenFile(filepath.Join(infoDir, name+".trashinfo"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return true
+		}
+
+		infoFile = file
+		return false
+	})
+	infoPathName := filepath.Join(infoDir, name+".trashinfo")
+
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", (&url.URL{Path: infoPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	_, err := infoFile.WriteString(info)
+	if closeErr := infoFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(infoPathName)
+		return fmt.Errorf("failed to write trash info %s: %v", infoPathName, err)
+	}
+
+	if err := os.Rename(absPath, filepath.Join(filesPath, name)); err != nil {
+		os.Remove(infoPathName)
+		if errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		return fmt.Errorf("failed to move %s to the trash: %v", absPath, err)
+	}
+
+	return nil
+}